@@ -2,4 +2,4 @@ module github.com/guobinqiu/sqlparser
 
 go 1.13
 
-require github.com/huandu/go-clone v1.2.1
+require gopkg.in/yaml.v2 v2.4.0
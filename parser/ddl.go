@@ -0,0 +1,1694 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+//CreateTableStmt create table name (columns, constraints) [on filegroup]
+type CreateTableStmt struct {
+	Span
+	Table       *TableName
+	Columns     []*ColumnDef
+	Constraints []*Constraint
+	declare     Token //declare @t table
+	keywords    map[string]Token
+}
+
+//ColumnDef 列定义
+type ColumnDef struct {
+	Name        Token
+	Type        string //mssql类型
+	Collation   Token  //pgsql的排序规则不同, 翻译时去掉
+	Identity    *Identity
+	NotNull     bool
+	Null        bool //写了null
+	Default     Expr
+	DefaultName Token //constraint name default ...
+	Constraints []*Constraint
+	Computed    Expr //计算列name as (expr), pgsql中注释掉
+	Persisted   bool
+}
+
+//Identity identity[(seed, increment)]
+type Identity struct {
+	Seed      Expr
+	Increment Expr
+}
+
+//Constraint 主键, 唯一, 外键, check约束和alter table中的default约束. 列上的约束没有Columns
+type Constraint struct {
+	Name       Token
+	Kind       string //primary key, unique, foreign key, check, default
+	Clustered  string //clustered, nonclustered, pgsql中去掉
+	Columns    []Token
+	RefTable   *TableName
+	RefColumns []Token
+	Actions    []string //on delete cascade, on update set null
+	Check      Expr
+	Default    Expr //default expr for column
+}
+
+func isCreateTable(doc *SqlDocument) bool {
+	defer doc.tk.Reset(doc.tk.Mark())
+	if !doc.peekWord("create") {
+		return false
+	}
+	doc.tk.Pop()
+	return doc.peekWord("table")
+}
+
+func parseCreateTable(doc *SqlDocument) (SqlStatement, error) {
+	stmt := &CreateTableStmt{keywords: map[string]Token{}}
+	stmt.keywords["create"], _ = doc.tk.PopToken()
+	stmt.keywords["table"], _ = doc.tk.PopToken()
+	var err error
+	if stmt.Table, err = parseTableName(doc); err != nil {
+		return nil, err
+	}
+	if err = parseColumns(doc, stmt); err != nil {
+		return nil, err
+	}
+	return stmt, parseStorageOptions(doc)
+}
+
+func isDeclareTable(doc *SqlDocument) bool {
+	defer doc.tk.Reset(doc.tk.Mark())
+	if !doc.peekWord("declare") {
+		return false
+	}
+	doc.tk.Pop()
+	if token, _ := doc.tk.PopToken(); token.Kind != TokenVariable {
+		return false
+	}
+	if doc.peekWord("as") {
+		doc.tk.Pop()
+	}
+	return doc.peekWord("table")
+}
+
+//declare @t table (...), pgsql中为临时表v_t
+func parseDeclareTable(doc *SqlDocument) (SqlStatement, error) {
+	stmt := &CreateTableStmt{keywords: map[string]Token{}}
+	stmt.declare, _ = doc.tk.PopToken()
+	name, _ := doc.tk.PopToken()
+	stmt.Table = &TableName{Parts: []Token{name}}
+	if doc.peekWord("as") {
+		stmt.keywords["as"], _ = doc.tk.PopToken()
+	}
+	stmt.keywords["table"], _ = doc.tk.PopToken()
+	if err := parseColumns(doc, stmt); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+//解析列和约束, 并记录列的类型和默认值约束
+func parseColumns(doc *SqlDocument, stmt *CreateTableStmt) error {
+	var err error
+	if stmt.Columns, stmt.Constraints, err = parseTableElements(doc); err != nil {
+		return err
+	}
+	delete(doc.columns, tableKey(stmt.Table))
+	for _, v := range stmt.Columns {
+		if v.Computed != nil {
+			doc.warn(v.Name, "computed column %s is not supported by pgsql, commented out", v.Name.Text)
+			continue
+		}
+		doc.addColumn(stmt.Table, v)
+		doc.addDefault(stmt.Table, v.DefaultName, v.Name)
+	}
+	return nil
+}
+
+//计算列只在create table中注释掉, 其它地方不支持
+func checkComputed(doc *SqlDocument, columns ...*ColumnDef) error {
+	for _, v := range columns {
+		if v.Computed != nil {
+			return doc.tk.errorAt(v.Name, fmt.Errorf("computed column %s is not supported", v.Name.Text))
+		}
+	}
+	return nil
+}
+
+//(columns, constraints), 用于create table和表值函数的returns @t table (...)
+func parseTableElements(doc *SqlDocument) ([]*ColumnDef, []*Constraint, error) {
+	if err := doc.expect("("); err != nil {
+		return nil, nil, err
+	}
+	var columns []*ColumnDef
+	var constraints []*Constraint
+	for {
+		if isConstraint(doc) {
+			constraint, err := parseConstraint(doc, true)
+			if err != nil {
+				return nil, nil, err
+			}
+			constraints = append(constraints, constraint)
+		} else {
+			column, err := parseColumnDef(doc)
+			if err != nil {
+				return nil, nil, err
+			}
+			columns = append(columns, column)
+		}
+		token, _ := doc.tk.Peek()
+		if token == ")" {
+			break
+		}
+		if token != "," {
+			return nil, nil, doc.parseError(",", ")")
+		}
+		doc.tk.Pop()
+	}
+	doc.tk.Pop()
+	return columns, constraints, nil
+}
+
+//on [primary], textimage_on [primary], with (data_compression = page), pgsql中没有, 直接跳过
+func parseStorageOptions(doc *SqlDocument) error {
+	for {
+		switch {
+		case doc.peekWord("on") || doc.peekWord("textimage_on"):
+			doc.tk.Pop()
+			token, _ := doc.tk.PeekToken()
+			if !isName(token) && token.Kind != TokenKeyword && token.Kind != TokenString {
+				return doc.parseError("filegroup")
+			}
+			doc.tk.Pop()
+			if token, _ := doc.tk.Peek(); token == "(" { //分区方案ps(column)
+				if _, err := parseNameList(doc); err != nil {
+					return err
+				}
+			}
+		case doc.peekWord("with"):
+			mark := doc.tk.Mark()
+			doc.tk.Pop()
+			if token, _ := doc.tk.Peek(); token != "(" { //下一条语句的with
+				doc.tk.Reset(mark)
+				return nil
+			}
+			if _, err := parseOptions(doc); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+//Option with (name = value, ...)中的一项
+type Option struct {
+	Name  Token
+	Value Token
+}
+
+//(name = value, ...)
+func parseOptions(doc *SqlDocument) ([]*Option, error) {
+	if err := doc.expect("("); err != nil {
+		return nil, err
+	}
+	var options []*Option
+	for {
+		option := &Option{}
+		if option.Name, _ = doc.tk.PeekToken(); !isName(option.Name) && option.Name.Kind != TokenKeyword {
+			return nil, doc.parseError("option")
+		}
+		doc.tk.Pop()
+		if err := doc.expect("="); err != nil {
+			return nil, err
+		}
+		if option.Value, _ = doc.tk.PeekToken(); option.Value.Kind == TokenPunct || option.Value.Kind == TokenEOF {
+			return nil, doc.parseError("value")
+		}
+		doc.tk.Pop()
+		options = append(options, option)
+		if token, _ := doc.tk.Peek(); token != "," {
+			break
+		}
+		doc.tk.Pop()
+	}
+	if err := doc.expect(")"); err != nil {
+		return nil, err
+	}
+	return options, nil
+}
+
+//当前是否为表上的约束
+func isConstraint(doc *SqlDocument) bool {
+	for _, word := range []string{"constraint", "primary", "unique", "foreign", "check"} {
+		if doc.peekWord(word) {
+			return true
+		}
+	}
+	return false
+}
+
+//name type [collate x] [identity(1, 1)] [not null] [default expr] [constraints]
+func parseColumnDef(doc *SqlDocument) (*ColumnDef, error) {
+	column := &ColumnDef{}
+	name, _ := doc.tk.PeekToken()
+	if !isName(name) {
+		return nil, doc.parseError("column")
+	}
+	doc.tk.Pop()
+	column.Name = name
+	var err error
+	if doc.peekWord("as") {
+		doc.tk.Pop()
+		if column.Computed, err = parseExpr(doc); err != nil {
+			return nil, err
+		}
+		if doc.peekWord("persisted") {
+			doc.tk.Pop()
+			column.Persisted = true
+		}
+	} else if column.Type, err = parseDataType(doc); err != nil {
+		return nil, err
+	}
+	for {
+		var name Token
+		if doc.peekWord("constraint") {
+			doc.tk.Pop()
+			if name, _ = doc.tk.PeekToken(); !isName(name) {
+				return nil, doc.parseError("name")
+			}
+			doc.tk.Pop()
+		}
+		switch token, _ := doc.tk.Peek(); strings.ToLower(token) {
+		case "collate":
+			doc.tk.Pop()
+			if column.Collation, _ = doc.tk.PeekToken(); !isName(column.Collation) {
+				return nil, doc.parseError("collation")
+			}
+			doc.tk.Pop()
+		case "identity":
+			doc.tk.Pop()
+			if column.Identity, err = parseIdentity(doc); err != nil {
+				return nil, err
+			}
+		case "not":
+			doc.tk.Pop()
+			if doc.peekWord("for") { //not for replication
+				if _, err := doc.popKeyword("for", "replication"); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if err := doc.expect("null"); err != nil {
+				return nil, err
+			}
+			column.NotNull = true
+		case "null":
+			doc.tk.Pop()
+			column.Null = true
+		case "default":
+			doc.tk.Pop()
+			if column.Default, err = parseExpr(doc); err != nil {
+				return nil, err
+			}
+			column.DefaultName = name
+		case "primary", "unique", "check", "foreign", "references":
+			constraint, err := parseConstraint(doc, false)
+			if err != nil {
+				return nil, err
+			}
+			constraint.Name = name
+			column.Constraints = append(column.Constraints, constraint)
+		case "rowguidcol", "sparse", "filestream":
+			doc.tk.Pop()
+		default:
+			if name.Text != "" {
+				return nil, doc.parseError("constraint")
+			}
+			return column, nil
+		}
+	}
+}
+
+//(seed, increment), 不写时为(1, 1)
+func parseIdentity(doc *SqlDocument) (*Identity, error) {
+	identity := &Identity{}
+	if token, _ := doc.tk.Peek(); token != "(" {
+		return identity, nil
+	}
+	doc.tk.Pop()
+	args, err := parseExprList(doc)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) != 2 {
+		return nil, doc.parseError("increment")
+	}
+	if err := doc.expect(")"); err != nil {
+		return nil, err
+	}
+	identity.Seed, identity.Increment = args[0], args[1]
+	return identity, nil
+}
+
+//[constraint name] primary key [clustered] (columns), unique (columns),
+//foreign key (columns) references table (columns) [on delete cascade], check (expr).
+//列上的约束没有(columns), 外键可以省略foreign key
+func parseConstraint(doc *SqlDocument, table bool) (*Constraint, error) {
+	constraint := &Constraint{}
+	if doc.peekWord("constraint") {
+		doc.tk.Pop()
+		if constraint.Name, _ = doc.tk.PeekToken(); !isName(constraint.Name) {
+			return nil, doc.parseError("name")
+		}
+		doc.tk.Pop()
+	}
+	token, _ := doc.tk.Peek()
+	var err error
+	switch word := strings.ToLower(token); word {
+	case "primary", "unique":
+		if word == "primary" {
+			_, err = doc.popKeyword("primary", "key")
+		} else {
+			doc.tk.Pop()
+		}
+		if err != nil {
+			return nil, err
+		}
+		constraint.Kind = map[string]string{"primary": "primary key", "unique": "unique"}[word]
+		if doc.peekWord("clustered") || doc.peekWord("nonclustered") {
+			token, _ := doc.tk.PopToken()
+			constraint.Clustered = strings.ToLower(token.Text)
+		}
+		if table {
+			if constraint.Columns, err = parseIndexColumns(doc); err != nil {
+				return nil, err
+			}
+		}
+		if err := parseStorageOptions(doc); err != nil {
+			return nil, err
+		}
+	case "foreign", "references":
+		constraint.Kind = "foreign key"
+		if word == "foreign" {
+			if _, err := doc.popKeyword("foreign", "key"); err != nil {
+				return nil, err
+			}
+			if constraint.Columns, err = parseNameList(doc); err != nil {
+				return nil, err
+			}
+		} else if table {
+			return nil, doc.parseError("foreign")
+		}
+		if err := doc.expect("references"); err != nil {
+			return nil, err
+		}
+		if constraint.RefTable, err = parseTableName(doc); err != nil {
+			return nil, err
+		}
+		if token, _ := doc.tk.Peek(); token == "(" {
+			if constraint.RefColumns, err = parseNameList(doc); err != nil {
+				return nil, err
+			}
+		}
+		if constraint.Actions, err = parseReferentialActions(doc); err != nil {
+			return nil, err
+		}
+	case "check":
+		doc.tk.Pop()
+		constraint.Kind = "check"
+		if doc.peekWord("not") { //check not for replication
+			if _, err := doc.popKeyword("not", "for", "replication"); err != nil {
+				return nil, err
+			}
+		}
+		if err := doc.expect("("); err != nil {
+			return nil, err
+		}
+		if constraint.Check, err = parseExpr(doc); err != nil {
+			return nil, err
+		}
+		if err := doc.expect(")"); err != nil {
+			return nil, err
+		}
+	case "default": //alter table add default expr for column
+		if !table {
+			return nil, doc.parseError("primary", "unique", "foreign", "check")
+		}
+		doc.tk.Pop()
+		constraint.Kind = "default"
+		if constraint.Default, err = parseExpr(doc); err != nil {
+			return nil, err
+		}
+		if err := doc.expect("for"); err != nil {
+			return nil, err
+		}
+		column, _ := doc.tk.PeekToken()
+		if !isName(column) {
+			return nil, doc.parseError("column")
+		}
+		doc.tk.Pop()
+		constraint.Columns = []Token{column}
+	default:
+		return nil, doc.parseError("primary", "unique", "foreign", "check")
+	}
+	return constraint, nil
+}
+
+//(a, b desc), pgsql的主键和唯一约束不能指定顺序, 去掉asc, desc
+func parseIndexColumns(doc *SqlDocument) ([]Token, error) {
+	if err := doc.expect("("); err != nil {
+		return nil, err
+	}
+	var columns []Token
+	for {
+		token, _ := doc.tk.PeekToken()
+		if !isName(token) {
+			return nil, doc.parseError("column")
+		}
+		columns = append(columns, token)
+		doc.tk.Pop()
+		if doc.peekWord("asc") || doc.peekWord("desc") {
+			doc.tk.Pop()
+		}
+		if token, _ := doc.tk.Peek(); token != "," {
+			break
+		}
+		doc.tk.Pop()
+	}
+	if err := doc.expect(")"); err != nil {
+		return nil, err
+	}
+	return columns, nil
+}
+
+//on delete cascade, on update no action, on delete set null, not for replication
+func parseReferentialActions(doc *SqlDocument) ([]string, error) {
+	var actions []string
+	for {
+		if doc.peekWord("not") {
+			if _, err := doc.popKeyword("not", "for", "replication"); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if !doc.peekWord("on") {
+			return actions, nil
+		}
+		doc.tk.Pop()
+		token, _ := doc.tk.Peek()
+		event := strings.ToLower(token)
+		if event != "delete" && event != "update" {
+			return nil, doc.parseError("delete", "update")
+		}
+		doc.tk.Pop()
+		token, _ = doc.tk.Peek()
+		action := strings.ToLower(token)
+		switch action {
+		case "cascade":
+		case "no":
+			doc.tk.Pop()
+			action += " action"
+			token, _ = doc.tk.Peek()
+			if !strings.EqualFold(token, "action") {
+				return nil, doc.parseError("action")
+			}
+		case "set":
+			doc.tk.Pop()
+			token, _ = doc.tk.Peek()
+			if !strings.EqualFold(token, "null") && !strings.EqualFold(token, "default") {
+				return nil, doc.parseError("null", "default")
+			}
+			action += " " + strings.ToLower(token)
+		default:
+			return nil, doc.parseError("cascade", "no", "set")
+		}
+		doc.tk.Pop()
+		actions = append(actions, "on "+event+" "+action)
+	}
+}
+
+func (stmt *CreateTableStmt) PgSql() string {
+	w := newSqlWriter(stmt.Span, true)
+	stmt.writeSql(w)
+	return w.String() + ";"
+}
+
+func (stmt *CreateTableStmt) MsSql() string {
+	w := newSqlWriter(stmt.Span, false)
+	stmt.writeSql(w)
+	return w.String()
+}
+
+//每列一行, pgsql中计算列注释掉写在最后
+func (stmt *CreateTableStmt) writeSql(w *sqlWriter) {
+	if stmt.declare.Text != "" && !w.pg {
+		w.token(stmt.declare)
+		stmt.Table.writeSql(w)
+		if as, ok := stmt.keywords["as"]; ok {
+			w.token(as)
+		}
+		writeKeyword(w, stmt.keywords, "table")
+	} else {
+		writeKeyword(w, stmt.keywords, "create")
+		if w.pg && (stmt.Table.isTemp() || stmt.declare.Text != "") {
+			w.write("temp")
+		}
+		writeKeyword(w, stmt.keywords, "table")
+		stmt.Table.writeSql(w)
+	}
+	w.write("(")
+	w.indent = "    "
+	n := 0
+	var computed []*ColumnDef
+	for _, v := range stmt.Columns {
+		if v.Computed != nil && w.pg {
+			computed = append(computed, v)
+			continue
+		}
+		if n > 0 {
+			w.write(",")
+		}
+		n++
+		w.newline()
+		v.writeSql(w)
+	}
+	for _, v := range stmt.Constraints {
+		if n > 0 {
+			w.write(",")
+		}
+		n++
+		w.newline()
+		v.writeSql(w)
+	}
+	for _, v := range computed {
+		w.newline()
+		w.quietly(func() {
+			w.write("-- " + v.Name.Text + " as " + exprSql(v.Computed, false))
+			if v.Persisted {
+				w.write("persisted")
+			}
+		})
+	}
+	w.indent = ""
+	w.newline()
+	w.write(")")
+}
+
+func (column *ColumnDef) writeSql(w *sqlWriter) {
+	w.token(column.Name)
+	if column.Computed != nil {
+		w.write("as")
+		column.Computed.writeSql(w)
+		if column.Persisted {
+			w.write("persisted")
+		}
+	} else if w.pg {
+		w.write(pgType(column.Type, w.opts))
+	} else {
+		w.write(column.Type)
+	}
+	if column.Collation.Text != "" && !w.pg {
+		w.write("collate")
+		w.token(column.Collation)
+	}
+	if column.Identity != nil {
+		column.Identity.writeSql(w)
+	}
+	if column.NotNull {
+		w.write("not null")
+	} else if column.Null {
+		w.write("null")
+	}
+	if column.Default != nil {
+		if column.DefaultName.Text != "" && !w.pg {
+			w.write("constraint")
+			w.token(column.DefaultName)
+		}
+		w.write("default")
+		if v, ok := boolLiteral(column.Default); ok && w.pg && pgType(column.Type, w.opts) == "boolean" {
+			w.write(v)
+		} else {
+			column.Default.writeSql(w)
+		}
+	}
+	for _, v := range column.Constraints {
+		v.writeSql(w)
+	}
+}
+
+//bit的默认值0和1, 在pgsql中为boolean
+func boolLiteral(expr Expr) (string, bool) {
+	v, _, ok := bitLiteral(expr)
+	return v, ok
+}
+
+//带括号的0和1, 返回翻译后的值和数字的token
+func bitLiteral(expr Expr) (string, Token, bool) {
+	for {
+		paren, ok := expr.(*ParenExpr)
+		if !ok {
+			break
+		}
+		expr = paren.Expr
+	}
+	if lit, ok := expr.(*Literal); ok {
+		switch lit.Token.Text {
+		case "0", "'0'":
+			return "false", lit.Token, true
+		case "1", "'1'":
+			return "true", lit.Token, true
+		}
+	}
+	return "", Token{}, false
+}
+
+//typ为bit时0和1翻译为false和true
+func bitValue(doc *SqlDocument, expr Expr, typ string) Expr {
+	if v, token, ok := bitLiteral(expr); ok && typ != "" && pgType(typ, doc.opts) == "boolean" {
+		return &BitLiteral{Expr: expr, Value: v, token: token}
+	}
+	return expr
+}
+
+//pgsql: generated by default as identity [(start with seed increment by increment)]
+func (identity *Identity) writeSql(w *sqlWriter) {
+	if w.pg {
+		w.write("generated by default as identity")
+		if identity.Seed != nil {
+			w.write("(start with")
+			identity.Seed.writeSql(w)
+			w.write("increment by")
+			identity.Increment.writeSql(w)
+			w.write(")")
+		}
+		return
+	}
+	w.write("identity")
+	if identity.Seed != nil {
+		w.append("(")
+		identity.Seed.writeSql(w)
+		w.write(",")
+		identity.Increment.writeSql(w)
+		w.write(")")
+	}
+}
+
+//列上的外键只有references
+func (constraint *Constraint) writeSql(w *sqlWriter) {
+	if constraint.Name.Text != "" {
+		w.write("constraint")
+		w.token(constraint.Name)
+	}
+	if constraint.Kind != "foreign key" || len(constraint.Columns) > 0 {
+		w.write(constraint.Kind)
+	}
+	if constraint.Clustered != "" && !w.pg {
+		w.write(constraint.Clustered)
+	}
+	if constraint.Kind == "check" {
+		w.write("(")
+		constraint.Check.writeSql(w)
+		w.write(")")
+		return
+	}
+	if constraint.Kind == "default" {
+		constraint.Default.writeSql(w)
+		w.write("for")
+		w.token(constraint.Columns[0])
+		return
+	}
+	if len(constraint.Columns) > 0 {
+		w.write("(")
+		for i, v := range constraint.Columns {
+			if i > 0 {
+				w.write(",")
+			}
+			w.token(v)
+		}
+		w.write(")")
+	}
+	if constraint.RefTable != nil {
+		w.write("references")
+		constraint.RefTable.writeSql(w)
+		if len(constraint.RefColumns) > 0 {
+			writeNameList(w, constraint.RefColumns)
+		}
+		for _, v := range constraint.Actions {
+			w.write(v)
+		}
+	}
+}
+
+//IdentityInsertCmd set identity_insert table on|off.
+//pgsql的generated by default as identity列可以直接插入, on时之后对table的insert加overriding system value
+type IdentityInsertCmd struct {
+	Span
+	Table    *TableName
+	On       bool
+	Column   Token //create table中的identity列, 未知时为空
+	keywords map[string]Token
+}
+
+func isIdentityInsert(doc *SqlDocument) bool {
+	defer doc.tk.Reset(doc.tk.Mark())
+	if !doc.peekWord("set") {
+		return false
+	}
+	doc.tk.Pop()
+	return doc.peekWord("identity_insert")
+}
+
+func parseIdentityInsert(doc *SqlDocument) (SqlStatement, error) {
+	cmd := &IdentityInsertCmd{keywords: map[string]Token{}}
+	cmd.keywords["set"], _ = doc.tk.PopToken()
+	cmd.keywords["identity_insert"], _ = doc.tk.PopToken()
+	var err error
+	if cmd.Table, err = parseTableName(doc); err != nil {
+		return nil, err
+	}
+	switch {
+	case doc.peekWord("on"):
+		cmd.On = true
+	case !doc.peekWord("off"):
+		return nil, doc.parseError("on", "off")
+	}
+	cmd.keywords["on"], _ = doc.tk.PopToken()
+	if doc.identityOn == nil {
+		doc.identityOn = map[string]bool{}
+	}
+	doc.identityOn[tableKey(cmd.Table)] = cmd.On
+	cmd.Column = doc.identityColumn(cmd.Table)
+	if !cmd.On && cmd.Column.Text == "" {
+		doc.warn(cmd.keywords["on"], "identity column of %s is unknown, sequence not synchronized after identity_insert", cmd.Table.Parts[len(cmd.Table.Parts)-1].Text)
+	}
+	return cmd, nil
+}
+
+//pgsql没有对应的设置, 保留为注释. off时按max(id)重置序列, 否则之后的insert会生成重复的值
+func (cmd *IdentityInsertCmd) PgSql() string {
+	if cmd.On || cmd.Column.Text == "" {
+		return "-- " + cmd.MsSql()
+	}
+	reseed := &CheckIdentCmd{Span: cmd.Span, Table: cmd.Table, Reseed: "reseed", Column: cmd.Column}
+	return "-- " + cmd.MsSql() + "\n" + reseed.PgSql()
+}
+
+func (cmd *IdentityInsertCmd) MsSql() string {
+	w := newSqlWriter(cmd.Span, false)
+	writeKeyword(w, cmd.keywords, "set")
+	writeKeyword(w, cmd.keywords, "identity_insert")
+	cmd.Table.writeSql(w)
+	writeKeyword(w, cmd.keywords, "on")
+	return w.String()
+}
+
+//CheckIdentCmd dbcc checkident (table [, noreseed | , reseed [, value]]) [with no_infomsgs]
+type CheckIdentCmd struct {
+	Span
+	Table    *TableName
+	Reseed   string //reseed, noreseed, 不写时为空
+	Value    Expr
+	Column   Token //create table中的identity列, 未知时为空
+	name     Token //'schema.table'形式的表名
+	keywords map[string]Token
+}
+
+func isCheckIdent(doc *SqlDocument) bool {
+	defer doc.tk.Reset(doc.tk.Mark())
+	if !doc.peekWord("dbcc") {
+		return false
+	}
+	doc.tk.Pop()
+	return doc.peekWord("checkident")
+}
+
+func parseCheckIdent(doc *SqlDocument) (SqlStatement, error) {
+	cmd := &CheckIdentCmd{keywords: map[string]Token{}}
+	cmd.keywords["dbcc"], _ = doc.tk.PopToken()
+	cmd.keywords["checkident"], _ = doc.tk.PopToken()
+	if err := doc.expect("("); err != nil {
+		return nil, err
+	}
+	var err error
+	if token, _ := doc.tk.PeekToken(); token.Kind == TokenString {
+		sub := NewSqlDocument(stringValue(token.Text))
+		if cmd.Table, err = parseTableName(sub); err != nil || !sub.eof() {
+			return nil, doc.parseError("table")
+		}
+		cmd.name, _ = doc.tk.PopToken()
+	} else if cmd.Table, err = parseTableName(doc); err != nil {
+		return nil, err
+	}
+	if token, _ := doc.tk.Peek(); token == "," {
+		doc.tk.Pop()
+		if !doc.peekWord("reseed") && !doc.peekWord("noreseed") {
+			return nil, doc.parseError("reseed", "noreseed")
+		}
+		cmd.keywords["reseed"], _ = doc.tk.PopToken()
+		cmd.Reseed = strings.ToLower(cmd.keywords["reseed"].Text)
+		if token, _ := doc.tk.Peek(); token == "," && cmd.Reseed == "reseed" {
+			doc.tk.Pop()
+			if cmd.Value, err = parseExpr(doc); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := doc.expect(")"); err != nil {
+		return nil, err
+	}
+	mark := doc.tk.Mark()
+	if doc.peekWord("with") {
+		with, _ := doc.tk.PopToken()
+		if doc.peekWord("no_infomsgs") {
+			cmd.keywords["with"] = with
+			cmd.keywords["no_infomsgs"], _ = doc.tk.PopToken()
+		} else { //下一条语句的with
+			doc.tk.Reset(mark)
+		}
+	}
+	cmd.Column = doc.identityColumn(cmd.Table)
+	if cmd.Value != nil && cmd.Column.Text != "" && isConstant(cmd.Value) {
+		doc.warn(cmd.keywords["reseed"], "reseed: next identity value is the reseed value in pgsql, mssql adds the increment when the table has rows")
+	}
+	return cmd, nil
+}
+
+//reseed n: alter table t alter column id restart with n, 下一个值为n. mssql中表里有数据时下一个值为n + increment.
+//不知道identity列时从pg_attribute中查找. reseed: 按max(id)重置序列. 其余情况保留为注释
+func (cmd *CheckIdentCmd) PgSql() string {
+	if cmd.Reseed != "reseed" || cmd.Value == nil && cmd.Column.Text == "" {
+		return "-- " + cmd.MsSql()
+	}
+	w := newSqlWriter(cmd.Span, true)
+	if cmd.Value != nil && cmd.Column.Text != "" && isConstant(cmd.Value) {
+		w.write("alter table")
+		cmd.Table.writeSql(w)
+		w.write("alter column")
+		w.token(cmd.Column)
+		w.write("restart with")
+		cmd.Value.writeSql(w)
+		return w.String() + ";"
+	}
+	table := newSqlWriter(Span{opts: w.opts}, true)
+	cmd.Table.writeSql(table)
+	if cmd.Value != nil && !isConstant(cmd.Value) { //变量只能在plpgsql中使用
+		w.write("perform")
+	} else {
+		w.write("select")
+	}
+	w.write("setval(pg_get_serial_sequence(")
+	w.write(pgString(table.String()))
+	w.write(",")
+	if cmd.Column.Text != "" {
+		w.write(pgString(pgName(pgToken(cmd.Column, w.opts))))
+	} else {
+		w.write("attname")
+	}
+	w.write("),")
+	if cmd.Value != nil {
+		cmd.Value.writeSql(w)
+	} else {
+		w.write("coalesce(max(")
+		w.token(cmd.Column)
+		w.write("), 0) + 1")
+	}
+	w.write(", false)")
+	switch {
+	case cmd.Column.Text == "":
+		w.write("from pg_attribute where attrelid =")
+		w.write(pgString(table.String()) + "::regclass")
+		w.write("and attidentity <> ''")
+	case cmd.Value == nil:
+		w.write("from")
+		cmd.Table.writeSql(w)
+	}
+	return w.String() + ";"
+}
+
+func (cmd *CheckIdentCmd) MsSql() string {
+	w := newSqlWriter(cmd.Span, false)
+	writeKeyword(w, cmd.keywords, "dbcc")
+	writeKeyword(w, cmd.keywords, "checkident")
+	w.append("(")
+	if cmd.name.Text != "" {
+		w.token(cmd.name)
+	} else {
+		cmd.Table.writeSql(w)
+	}
+	if cmd.Reseed != "" {
+		w.write(",")
+		writeKeyword(w, cmd.keywords, "reseed")
+	}
+	if cmd.Value != nil {
+		w.write(",")
+		cmd.Value.writeSql(w)
+	}
+	w.write(")")
+	if _, ok := cmd.keywords["with"]; ok {
+		writeKeyword(w, cmd.keywords, "with")
+		writeKeyword(w, cmd.keywords, "no_infomsgs")
+	}
+	return w.String()
+}
+
+//表名的最后一部分, 用于记录表中的列和identity_insert
+func tableKey(table *TableName) string {
+	return strings.ToLower(identValue(table.Parts[len(table.Parts)-1].Text))
+}
+
+//记录表中的列, 用于查找identity列和列的类型
+func (doc *SqlDocument) addColumn(table *TableName, column *ColumnDef) {
+	if doc.columns == nil {
+		doc.columns = map[string][]*ColumnDef{}
+	}
+	key := tableKey(table)
+	doc.columns[key] = append(doc.columns[key], column)
+}
+
+//有名字的default约束
+func (doc *SqlDocument) addDefault(table *TableName, name, column Token) {
+	if name.Text == "" {
+		return
+	}
+	if doc.defaults == nil {
+		doc.defaults = map[string]Token{}
+	}
+	doc.defaults[tableKey(table)+"."+strings.ToLower(identValue(name.Text))] = column
+}
+
+//create table中的列, 没有时为nil
+func (doc *SqlDocument) column(table *TableName, name Token) *ColumnDef {
+	for _, v := range doc.columns[tableKey(table)] {
+		if strings.EqualFold(identValue(v.Name.Text), identValue(name.Text)) {
+			return v
+		}
+	}
+	return nil
+}
+
+//变量或者from中的表的列的mssql类型, 不知道或者列名有歧义时为空
+func (doc *SqlDocument) valueType(expr Expr) string {
+	switch v := expr.(type) {
+	case *VariableRef:
+		return v.Type
+	case *ColumnRef:
+		parts := v.Parts
+		var found *ColumnDef
+		for _, table := range doc.scope {
+			if len(parts) > 1 && !isTable(table, parts[len(parts)-2]) {
+				continue
+			}
+			if column := doc.column(table, parts[len(parts)-1]); column != nil {
+				if found != nil {
+					return ""
+				}
+				found = column
+			}
+		}
+		if found != nil {
+			return found.Type
+		}
+	}
+	return ""
+}
+
+//解析where之前把from中的表加到查找列的范围中, 返回的函数恢复外层的范围
+func (doc *SqlDocument) pushScope(tables []*TableName) func() {
+	outer := doc.scope
+	doc.scope = append(tables[:len(tables):len(tables)], outer...)
+	return func() { doc.scope = outer }
+}
+
+//表中的identity列, 没有时为空
+func (doc *SqlDocument) identityColumn(table *TableName) Token {
+	for _, v := range doc.columns[tableKey(table)] {
+		if v.Identity != nil {
+			return v.Name
+		}
+	}
+	return Token{}
+}
+
+//数字或者负数
+func isConstant(expr Expr) bool {
+	if unary, ok := expr.(*UnaryExpr); ok {
+		expr = unary.Expr
+	}
+	_, ok := expr.(*Literal)
+	return ok
+}
+
+//pgsql标识符的实际名字, 没有引号时转为小写
+func pgName(ident string) string {
+	if strings.HasPrefix(ident, `"`) {
+		return strings.Replace(ident[1:len(ident)-1], `""`, `"`, -1)
+	}
+	return strings.ToLower(ident)
+}
+
+//AlterTableStmt alter table name [with check | with nocheck] add ... | alter column ... | drop ... | [no]check constraint ... | set (...)
+type AlterTableStmt struct {
+	Span
+	Table    *TableName
+	With     string //with check, with nocheck. with nocheck add的外键和check约束在pgsql中为not valid
+	Actions  []*AlterAction
+	Options  []*Option //set (lock_escalation = table)
+	keywords map[string]Token
+}
+
+//AlterAction alter table中的一项操作. mssql的一条语句只有一种操作, 但可以有多个列或约束
+type AlterAction struct {
+	Kind       string      //add, alter column, drop column, drop constraint, check constraint, nocheck constraint
+	Column     *ColumnDef  //add和alter column的列, alter column只有类型, 排序规则和null, not null
+	Constraint *Constraint //add的约束
+	Name       Token       //drop和[no]check constraint的列名或约束名, 可以是all
+	IfExists   bool
+	typ        string //add default约束所在列的类型, 不知道时为空
+	column     Token  //drop constraint删除的default约束所在的列
+}
+
+func isAlterTable(doc *SqlDocument) bool {
+	defer doc.tk.Reset(doc.tk.Mark())
+	if !doc.peekWord("alter") {
+		return false
+	}
+	doc.tk.Pop()
+	return doc.peekWord("table")
+}
+
+func parseAlterTable(doc *SqlDocument) (SqlStatement, error) {
+	stmt := &AlterTableStmt{keywords: map[string]Token{}}
+	stmt.keywords["alter"], _ = doc.tk.PopToken()
+	stmt.keywords["table"], _ = doc.tk.PopToken()
+	var err error
+	if stmt.Table, err = parseTableName(doc); err != nil {
+		return nil, err
+	}
+	if doc.peekWord("with") {
+		doc.tk.Pop()
+		if !doc.peekWord("check") && !doc.peekWord("nocheck") {
+			return nil, doc.parseError("check", "nocheck")
+		}
+		token, _ := doc.tk.PopToken()
+		stmt.With = "with " + strings.ToLower(token.Text)
+	}
+	token, _ := doc.tk.PeekToken()
+	switch word := strings.ToLower(token.Text); word {
+	case "add":
+		doc.tk.Pop()
+		for {
+			action := &AlterAction{Kind: "add"}
+			if isConstraint(doc) || doc.peekWord("default") {
+				if action.Constraint, err = parseConstraint(doc, true); err != nil {
+					return nil, err
+				}
+				if action.Constraint.Kind == "default" {
+					if column := doc.column(stmt.Table, action.Constraint.Columns[0]); column != nil {
+						action.typ = column.Type
+					}
+					doc.addDefault(stmt.Table, action.Constraint.Name, action.Constraint.Columns[0])
+				}
+			} else {
+				if action.Column, err = parseColumnDef(doc); err != nil {
+					return nil, err
+				}
+				if err := checkComputed(doc, action.Column); err != nil {
+					return nil, err
+				}
+				doc.addColumn(stmt.Table, action.Column)
+				doc.addDefault(stmt.Table, action.Column.DefaultName, action.Column.Name)
+			}
+			stmt.Actions = append(stmt.Actions, action)
+			if token, _ := doc.tk.Peek(); token != "," {
+				break
+			}
+			doc.tk.Pop()
+		}
+	case "alter":
+		action := &AlterAction{Kind: "alter column"}
+		if action.Column, err = parseAlterColumn(doc); err != nil {
+			return nil, err
+		}
+		stmt.Actions = append(stmt.Actions, action)
+	case "drop":
+		doc.tk.Pop()
+		kind := "drop constraint"
+		for {
+			if doc.peekWord("column") {
+				doc.tk.Pop()
+				kind = "drop column"
+			} else if doc.peekWord("constraint") {
+				doc.tk.Pop()
+				kind = "drop constraint"
+			}
+			action := &AlterAction{Kind: kind}
+			if doc.peekWord("if") {
+				if _, err := doc.popKeyword("if", "exists"); err != nil {
+					return nil, err
+				}
+				action.IfExists = true
+			}
+			if action.Name, _ = doc.tk.PeekToken(); !isName(action.Name) {
+				return nil, doc.parseError("name")
+			}
+			doc.tk.Pop()
+			if kind == "drop constraint" {
+				action.column = doc.defaults[tableKey(stmt.Table)+"."+strings.ToLower(identValue(action.Name.Text))]
+			}
+			stmt.Actions = append(stmt.Actions, action)
+			if token, _ := doc.tk.Peek(); token != "," {
+				break
+			}
+			doc.tk.Pop()
+		}
+	case "check", "nocheck":
+		doc.tk.Pop()
+		if err := doc.expect("constraint"); err != nil {
+			return nil, err
+		}
+		for {
+			action := &AlterAction{Kind: word + " constraint"}
+			if action.Name, _ = doc.tk.PeekToken(); !isName(action.Name) && !strings.EqualFold(action.Name.Text, "all") {
+				return nil, doc.parseError("constraint")
+			}
+			doc.tk.Pop()
+			stmt.Actions = append(stmt.Actions, action)
+			if token, _ := doc.tk.Peek(); token != "," {
+				break
+			}
+			doc.tk.Pop()
+		}
+	case "set":
+		doc.tk.Pop()
+		if stmt.Options, err = parseOptions(doc); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, doc.parseError("add", "alter", "drop", "check", "nocheck", "set")
+	}
+	if stmt.commented() {
+		doc.warn(token, "alter table %s is not supported by pgsql, commented out", strings.ToLower(token.Text))
+	}
+	return stmt, nil
+}
+
+//alter column name type [collate x] [null | not null]
+func parseAlterColumn(doc *SqlDocument) (*ColumnDef, error) {
+	if _, err := doc.popKeyword("alter", "column"); err != nil {
+		return nil, err
+	}
+	column := &ColumnDef{}
+	if column.Name, _ = doc.tk.PeekToken(); !isName(column.Name) {
+		return nil, doc.parseError("column")
+	}
+	doc.tk.Pop()
+	var err error
+	if column.Type, err = parseDataType(doc); err != nil {
+		return nil, err
+	}
+	if doc.peekWord("collate") {
+		doc.tk.Pop()
+		if column.Collation, _ = doc.tk.PeekToken(); !isName(column.Collation) {
+			return nil, doc.parseError("collation")
+		}
+		doc.tk.Pop()
+	}
+	if doc.peekWord("not") {
+		if _, err := doc.popKeyword("not", "null"); err != nil {
+			return nil, err
+		}
+		column.NotNull = true
+	} else if doc.peekWord("null") {
+		doc.tk.Pop()
+		column.Null = true
+	}
+	return column, nil
+}
+
+func (stmt *AlterTableStmt) PgSql() string {
+	if stmt.commented() {
+		return "-- " + stmt.MsSql()
+	}
+	w := newSqlWriter(stmt.Span, true)
+	stmt.writeSql(w)
+	return w.String() + ";"
+}
+
+//nocheck constraint和set (...)在pgsql中没有对应的语句, 保留为注释
+func (stmt *AlterTableStmt) commented() bool {
+	if len(stmt.Actions) == 0 {
+		return true
+	}
+	for _, v := range stmt.Actions {
+		switch {
+		case v.Kind == "nocheck constraint",
+			v.Kind == "check constraint" && (stmt.With != "with check" || strings.EqualFold(v.Name.Text, "all")):
+			return true
+		}
+	}
+	return false
+}
+
+func (stmt *AlterTableStmt) MsSql() string {
+	w := newSqlWriter(stmt.Span, false)
+	stmt.writeSql(w)
+	return w.String()
+}
+
+func (stmt *AlterTableStmt) writeSql(w *sqlWriter) {
+	writeKeyword(w, stmt.keywords, "alter")
+	writeKeyword(w, stmt.keywords, "table")
+	stmt.Table.writeSql(w)
+	if !w.pg {
+		w.write(stmt.With)
+	}
+	if stmt.Options != nil {
+		w.write("set (")
+		for i, v := range stmt.Options {
+			if i > 0 {
+				w.write(",")
+			}
+			w.token(v.Name)
+			w.write("=")
+			w.token(v.Value)
+		}
+		w.write(")")
+	}
+	for i, v := range stmt.Actions {
+		if i > 0 {
+			w.write(",")
+		}
+		if w.pg {
+			v.writePgSql(w, stmt.With == "with nocheck")
+		} else if i == 0 {
+			v.writeSql(w, nil)
+		} else {
+			v.writeSql(w, stmt.Actions[i-1])
+		}
+	}
+}
+
+//prev为同一语句中的前一项, 相同的操作只写一次
+func (action *AlterAction) writeSql(w *sqlWriter, prev *AlterAction) {
+	switch action.Kind {
+	case "add":
+		if prev == nil {
+			w.write("add")
+		}
+		if action.Column != nil {
+			action.Column.writeSql(w)
+		} else {
+			action.Constraint.writeSql(w)
+		}
+		return
+	case "alter column":
+		w.write("alter column")
+		action.Column.writeSql(w)
+		return
+	case "drop column", "drop constraint":
+		if prev == nil {
+			w.write("drop")
+		}
+		if prev == nil || prev.Kind != action.Kind {
+			w.write(strings.TrimPrefix(action.Kind, "drop "))
+		}
+		if action.IfExists {
+			w.write("if exists")
+		}
+	default:
+		if prev == nil {
+			w.write(action.Kind)
+		}
+	}
+	w.token(action.Name)
+}
+
+//pgsql中每一项都要写操作. alter column拆成类型和set/drop not null, default约束为alter column set default
+func (action *AlterAction) writePgSql(w *sqlWriter, noCheck bool) {
+	switch action.Kind {
+	case "add":
+		if action.Column != nil {
+			w.write("add column")
+			action.Column.writeSql(w)
+			return
+		}
+		constraint := action.Constraint
+		if constraint.Kind == "default" {
+			w.write("alter column")
+			w.token(constraint.Columns[0])
+			w.write("set default")
+			if v, ok := boolLiteral(constraint.Default); ok && pgType(action.typ, w.opts) == "boolean" {
+				w.write(v)
+			} else {
+				constraint.Default.writeSql(w)
+			}
+			return
+		}
+		w.write("add")
+		constraint.writeSql(w)
+		if noCheck && (constraint.Kind == "foreign key" || constraint.Kind == "check") {
+			w.write("not valid")
+		}
+	case "alter column":
+		column := action.Column
+		w.write("alter column")
+		w.token(column.Name)
+		w.write("type")
+		w.write(pgType(column.Type, w.opts))
+		if column.NotNull || column.Null {
+			w.write(", alter column")
+			w.quietly(func() { w.token(column.Name) })
+			if column.NotNull {
+				w.write("set not null")
+			} else {
+				w.write("drop not null")
+			}
+		}
+	case "check constraint":
+		w.write("validate constraint")
+		w.token(action.Name)
+	case "drop constraint":
+		if action.column.Text == "" {
+			w.write("drop constraint")
+			if action.IfExists {
+				w.write("if exists")
+			}
+			w.token(action.Name)
+			return
+		}
+		w.leading(action.Name)
+		w.write("alter column")
+		w.quietly(func() { w.token(action.column) })
+		w.write("drop default")
+		w.trailing(action.Name)
+	default:
+		w.write(action.Kind)
+		if action.IfExists {
+			w.write("if exists")
+		}
+		w.token(action.Name)
+	}
+}
+
+//RenameCmd [exec] sp_rename 'name', 'newname' [, 'column' | 'index' | 'object' | 'database']
+type RenameCmd struct {
+	Span
+	Name    *TableName //[schema.]table[.column|.index], 从字符串中解析
+	NewName string
+	Type    string //column, index, object, database, 不写时为空
+	exec    Token
+	proc    *TableName
+	args    []Token
+}
+
+func isRename(doc *SqlDocument) bool {
+	defer doc.tk.Reset(doc.tk.Mark())
+	if doc.peekWord("exec") || doc.peekWord("execute") {
+		doc.tk.Pop()
+	}
+	proc, err := parseTableName(doc)
+	return err == nil && strings.EqualFold(identValue(proc.Parts[len(proc.Parts)-1].Text), "sp_rename")
+}
+
+func parseRename(doc *SqlDocument) (SqlStatement, error) {
+	cmd := &RenameCmd{}
+	if doc.peekWord("exec") || doc.peekWord("execute") {
+		cmd.exec, _ = doc.tk.PopToken()
+	}
+	cmd.proc, _ = parseTableName(doc)
+	for {
+		arg, _ := doc.tk.PeekToken()
+		if arg.Kind != TokenString {
+			return nil, doc.parseError("string")
+		}
+		if len(cmd.args) == 0 {
+			sub := NewSqlDocument(stringValue(arg.Text))
+			var err error
+			if cmd.Name, err = parseTableName(sub); err != nil || !sub.eof() {
+				return nil, doc.parseError("name")
+			}
+		}
+		doc.tk.Pop()
+		cmd.args = append(cmd.args, arg)
+		if token, _ := doc.tk.Peek(); token != "," || len(cmd.args) == 3 {
+			break
+		}
+		doc.tk.Pop()
+	}
+	if len(cmd.args) < 2 {
+		return nil, doc.parseError(",")
+	}
+	cmd.NewName = stringValue(cmd.args[1].Text)
+	if len(cmd.args) == 3 {
+		cmd.Type = strings.ToLower(stringValue(cmd.args[2].Text))
+	}
+	return cmd, nil
+}
+
+//列: alter table t rename column a to b, 索引: alter index ix rename to b, 表: alter table t rename to b
+func (cmd *RenameCmd) PgSql() string {
+	parts := cmd.Name.Parts
+	w := newSqlWriter(cmd.Span, true)
+	switch {
+	case cmd.Type == "column" && len(parts) > 1:
+		w.write("alter table")
+		(&TableName{Parts: parts[:len(parts)-1]}).writeSql(w)
+		w.write("rename column")
+		w.token(parts[len(parts)-1])
+	case cmd.Type == "index" && len(parts) > 1:
+		w.write("alter index")
+		if len(parts) > 2 { //pgsql的索引属于schema
+			parts = []Token{parts[len(parts)-3], parts[len(parts)-1]}
+		} else {
+			parts = parts[1:]
+		}
+		(&TableName{Parts: parts}).writeSql(w)
+		w.write("rename")
+	case cmd.Type == "" || cmd.Type == "object":
+		w.write("alter table")
+		cmd.Name.writeSql(w)
+		w.write("rename")
+	case cmd.Type == "database":
+		w.write("alter database")
+		cmd.Name.writeSql(w)
+		w.write("rename")
+	default:
+		return "-- " + cmd.MsSql()
+	}
+	w.write("to")
+	//新名字不解析方括号, 原样作为名字
+	w.write(pgToken(Token{Kind: TokenQuotedIdent, Text: "[" + strings.Replace(cmd.NewName, "]", "]]", -1) + "]"}, w.opts))
+	return w.String() + ";"
+}
+
+func (cmd *RenameCmd) MsSql() string {
+	w := newSqlWriter(cmd.Span, false)
+	if cmd.exec.Text != "" {
+		w.token(cmd.exec)
+	}
+	cmd.proc.writeSql(w)
+	for i, v := range cmd.args {
+		if i > 0 {
+			w.write(",")
+		}
+		w.token(v)
+	}
+	return w.String()
+}
+
+//CreateIndexStmt create [unique] [clustered | nonclustered] index name on table (columns)
+//[include (columns)] [where filter] [with (options)] [on filegroup]
+type CreateIndexStmt struct {
+	Span
+	Unique    bool
+	Clustered string //clustered, nonclustered
+	Name      Token
+	Table     *TableName
+	Columns   []*IndexColumn
+	Include   []Token
+	Where     Expr
+	Options   []*Option //pgsql中只保留fillfactor
+	keywords  map[string]Token
+}
+
+//IndexColumn 索引中的列
+type IndexColumn struct {
+	Name  Token
+	Order string //asc, desc, 不写时为空
+}
+
+func isCreateIndex(doc *SqlDocument) bool {
+	defer doc.tk.Reset(doc.tk.Mark())
+	if !doc.peekWord("create") {
+		return false
+	}
+	doc.tk.Pop()
+	if doc.peekWord("unique") {
+		doc.tk.Pop()
+	}
+	if doc.peekWord("clustered") || doc.peekWord("nonclustered") {
+		doc.tk.Pop()
+	}
+	return doc.peekWord("index")
+}
+
+func parseCreateIndex(doc *SqlDocument) (SqlStatement, error) {
+	stmt := &CreateIndexStmt{keywords: map[string]Token{}}
+	stmt.keywords["create"], _ = doc.tk.PopToken()
+	if doc.peekWord("unique") {
+		stmt.keywords["unique"], _ = doc.tk.PopToken()
+		stmt.Unique = true
+	}
+	if doc.peekWord("clustered") || doc.peekWord("nonclustered") {
+		stmt.keywords["clustered"], _ = doc.tk.PopToken()
+		stmt.Clustered = strings.ToLower(stmt.keywords["clustered"].Text)
+	}
+	stmt.keywords["index"], _ = doc.tk.PopToken()
+	if stmt.Name, _ = doc.tk.PeekToken(); !isName(stmt.Name) {
+		return nil, doc.parseError("name")
+	}
+	doc.tk.Pop()
+	if err := doc.expect("on"); err != nil {
+		return nil, err
+	}
+	var err error
+	if stmt.Table, err = parseTableName(doc); err != nil {
+		return nil, err
+	}
+	if err := doc.expect("("); err != nil {
+		return nil, err
+	}
+	for {
+		column := &IndexColumn{}
+		if column.Name, _ = doc.tk.PeekToken(); !isName(column.Name) {
+			return nil, doc.parseError("column")
+		}
+		doc.tk.Pop()
+		if doc.peekWord("asc") || doc.peekWord("desc") {
+			token, _ := doc.tk.PopToken()
+			column.Order = strings.ToLower(token.Text)
+		}
+		stmt.Columns = append(stmt.Columns, column)
+		if token, _ := doc.tk.Peek(); token != "," {
+			break
+		}
+		doc.tk.Pop()
+	}
+	if err := doc.expect(")"); err != nil {
+		return nil, err
+	}
+	if doc.peekWord("include") {
+		doc.tk.Pop()
+		if stmt.Include, err = parseNameList(doc); err != nil {
+			return nil, err
+		}
+	}
+	if doc.peekWord("where") {
+		doc.tk.Pop()
+		if stmt.Where, err = parseExpr(doc); err != nil {
+			return nil, err
+		}
+	}
+	mark := doc.tk.Mark()
+	if doc.peekWord("with") {
+		doc.tk.Pop()
+		if token, _ := doc.tk.Peek(); token != "(" { //下一条语句的with
+			doc.tk.Reset(mark)
+		} else if stmt.Options, err = parseOptions(doc); err != nil {
+			return nil, err
+		}
+	}
+	for _, v := range stmt.Options {
+		if !strings.EqualFold(v.Name.Text, "fillfactor") {
+			doc.warn(v.Name, "index option %s is not supported by pgsql, ignored", v.Name.Text)
+		}
+	}
+	return stmt, parseStorageOptions(doc)
+}
+
+//clustered在文档的ClusterIndexes为true时翻译为cluster语句
+func (stmt *CreateIndexStmt) PgSql() string {
+	w := newSqlWriter(stmt.Span, true)
+	stmt.writeSql(w)
+	w.append(";")
+	if stmt.Clustered == "clustered" && w.opts.cluster() {
+		w.append("\n")
+		w.write("cluster")
+		w.quietly(func() {
+			stmt.Table.writeSql(w)
+			w.write("using")
+			w.token(stmt.Name)
+		})
+		w.append(";")
+	}
+	return w.String()
+}
+
+func (stmt *CreateIndexStmt) MsSql() string {
+	w := newSqlWriter(stmt.Span, false)
+	stmt.writeSql(w)
+	return w.String()
+}
+
+//pgsql的顺序为include, with, where
+func (stmt *CreateIndexStmt) writeSql(w *sqlWriter) {
+	writeKeyword(w, stmt.keywords, "create")
+	if stmt.Unique {
+		writeKeyword(w, stmt.keywords, "unique")
+	}
+	if stmt.Clustered != "" && !w.pg {
+		writeKeyword(w, stmt.keywords, "clustered")
+	}
+	writeKeyword(w, stmt.keywords, "index")
+	w.token(stmt.Name)
+	w.write("on")
+	stmt.Table.writeSql(w)
+	w.write("(")
+	for i, v := range stmt.Columns {
+		if i > 0 {
+			w.write(",")
+		}
+		w.token(v.Name)
+		if v.Order == "desc" || v.Order != "" && !w.pg {
+			w.write(v.Order)
+		}
+	}
+	w.write(")")
+	if stmt.Include != nil {
+		w.write("include (")
+		for i, v := range stmt.Include {
+			if i > 0 {
+				w.write(",")
+			}
+			w.token(v)
+		}
+		w.write(")")
+	}
+	if stmt.Where != nil && !w.pg {
+		w.write("where")
+		stmt.Where.writeSql(w)
+	}
+	var options []*Option
+	for _, v := range stmt.Options {
+		if !w.pg || strings.EqualFold(v.Name.Text, "fillfactor") {
+			options = append(options, v)
+		}
+	}
+	if options != nil {
+		w.write("with (")
+		for i, v := range options {
+			if i > 0 {
+				w.write(",")
+			}
+			if w.pg {
+				w.write(strings.ToLower(v.Name.Text))
+			} else {
+				w.token(v.Name)
+			}
+			w.write("=")
+			w.token(v.Value)
+		}
+		w.write(")")
+	}
+	if stmt.Where != nil && w.pg {
+		w.write("where")
+		stmt.Where.writeSql(w)
+	}
+}
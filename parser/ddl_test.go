@@ -0,0 +1,333 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCreateTable(t *testing.T) {
+	s := `CREATE TABLE [dbo].[Orders](
+	[Id] [int] IDENTITY(1,1) NOT NULL,
+	[Name] [nvarchar](max) NULL, -- name
+	Code nvarchar(20) collate Chinese_PRC_CI_AS not null constraint uq_code unique,
+	Flag bit not null constraint df_flag default ((0)),
+	Created datetime default getdate(),
+	Price money check (Price > 0),
+	CustomerId uniqueidentifier references Customers(Id) on delete cascade,
+	Photo image,
+	Age tinyint,
+	Updated datetimeoffset(7) not null,
+	CONSTRAINT [PK_Orders] PRIMARY KEY CLUSTERED ([Id] ASC) WITH (PAD_INDEX = OFF) ON [PRIMARY],
+	constraint fk_x foreign key (CustomerId, Code) references Customers (Id, Code) on update no action
+) ON [PRIMARY] TEXTIMAGE_ON [PRIMARY]`
+	stmt, ok := parseOne(t, s).(*CreateTableStmt)
+	if !ok {
+		t.Fatal("expected CreateTableStmt")
+	}
+	if len(stmt.Columns) != 10 || len(stmt.Constraints) != 2 {
+		t.Fatalf("expected 10 columns and 2 constraints, got %d and %d", len(stmt.Columns), len(stmt.Constraints))
+	}
+	if c := stmt.Columns[0]; c.Type != "[int]" || c.Identity == nil || !c.NotNull {
+		t.Errorf("wrong column: %#v", c)
+	}
+	if c := stmt.Constraints[0]; c.Kind != "primary key" || c.Clustered != "clustered" || len(c.Columns) != 1 {
+		t.Errorf("wrong constraint: %#v", c)
+	}
+
+	expected := `CREATE TABLE dbo.orders (
+    id int generated by default as identity (start with 1 increment by 1) not null,
+    name text null,
+    -- name
+    Code varchar(20) not null constraint uq_code unique,
+    Flag boolean not null default false,
+    Created timestamp default now(),
+    Price numeric(19,4) check (Price > 0),
+    CustomerId uuid references Customers(Id) on delete cascade,
+    Photo bytea,
+    Age smallint,
+    Updated timestamptz(7) not null,
+    constraint pk_orders primary key (id),
+    constraint fk_x foreign key (CustomerId, Code) references Customers(Id, Code) on update no action
+);`
+	if sql := stmt.PgSql(); sql != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, sql)
+	}
+	expected = `CREATE TABLE [dbo].[Orders] (
+    [Id] [int] identity(1, 1) not null,
+    [Name] [nvarchar](max) null,
+    -- name
+    Code nvarchar(20) collate Chinese_PRC_CI_AS not null constraint uq_code unique,
+    Flag bit not null constraint df_flag default ((0)),
+    Created datetime default getdate(),
+    Price money check (Price > 0),
+    CustomerId uniqueidentifier references Customers(Id) on delete cascade,
+    Photo image,
+    Age tinyint,
+    Updated datetimeoffset(7) not null,
+    constraint [PK_Orders] primary key clustered ([Id]),
+    constraint fk_x foreign key (CustomerId, Code) references Customers(Id, Code) on update no action
+)`
+	if sql := stmt.MsSql(); sql != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, sql)
+	}
+}
+
+func TestCreateTableErrors(t *testing.T) {
+	for _, s := range []string{
+		"create table t (a int constraint)",
+		"create table t (a int, primary key)",
+		"create table t (a int references t2(b) on delete nothing)",
+		"create table t (a int",
+		"set identity_insert t",
+		"dbcc checkident('t', reseed, )",
+		"dbcc checkident('t.', reseed)",
+		"alter table t add",
+		"alter table t with nocheck",
+		"alter table t alter column a",
+		"alter table t drop column",
+		"alter table t add constraint df default 0",
+		"exec sp_rename 't'",
+		"exec sp_rename @name, 'b'",
+		"create index ix on t",
+		"create unique index ix on t (a desc",
+		"create index ix on t (a) include a",
+	} {
+		doc := NewSqlDocument(s)
+		if _, err := Parse(doc); err == nil {
+			t.Errorf("%s: expected error", s)
+		}
+	}
+}
+
+func TestIdentity(t *testing.T) {
+	s := `create table [Orders] (Id int identity(1000, 5) not null primary key, Name varchar(10))
+set identity_insert dbo.Orders on
+insert into Orders (Id, Name) values (1, 'a')
+SET IDENTITY_INSERT dbo.Orders OFF
+insert into Orders (Name) values ('b')
+dbcc checkident ('dbo.Orders', reseed, 100)
+DBCC CHECKIDENT('Orders', RESEED) WITH NO_INFOMSGS
+dbcc checkident(Customers, reseed, 0)
+dbcc checkident('Orders', noreseed)`
+	doc := NewSqlDocument(s)
+	if _, err := Parse(doc); err != nil {
+		t.Fatal(err)
+	}
+	expected := `create table orders (
+    Id int generated by default as identity (start with 1000 increment by 5) not null primary key,
+    Name varchar(10)
+);
+-- set identity_insert dbo.Orders on
+insert into Orders(Id, Name) overriding system value values (1, 'a');
+-- SET IDENTITY_INSERT dbo.Orders OFF
+select setval(pg_get_serial_sequence('dbo.Orders', 'id'), coalesce(max(Id), 0) + 1, false) from dbo.Orders;
+insert into Orders(Name) values ('b');
+alter table dbo.Orders alter column Id restart with 100;
+select setval(pg_get_serial_sequence('Orders', 'id'), coalesce(max(Id), 0) + 1, false) from Orders;
+select setval(pg_get_serial_sequence('Customers', attname), 0, false) from pg_attribute where attrelid = 'Customers'::regclass and attidentity <> '';
+-- dbcc checkident('Orders', noreseed)`
+	if sql := doc.PgSql(); sql != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, sql)
+	}
+	if sql := doc.SqlStatements[6].MsSql(); sql != "DBCC CHECKIDENT('Orders', RESEED) WITH NO_INFOMSGS" {
+		t.Errorf("got %s", sql)
+	}
+	if len(doc.Warnings) != 1 || doc.Warnings[0].Line != 6 {
+		t.Errorf("wrong warnings: %v", doc.Warnings)
+	}
+	doc = NewSqlDocument("set identity_insert t on\ninsert into t (id) values (1)\nset identity_insert t off")
+	if _, err := Parse(doc); err != nil {
+		t.Fatal(err)
+	}
+	if sql := doc.SqlStatements[2].PgSql(); sql != "-- set identity_insert t off" || len(doc.Warnings) != 1 {
+		t.Errorf("got %s, %v", sql, doc.Warnings)
+	}
+}
+
+func TestAlterTable(t *testing.T) {
+	s := `create table Orders (Id int identity not null, Flag bit)
+ALTER TABLE [dbo].[Orders] ADD [Code] nvarchar(20) NULL, Amount money not null default 0
+alter table Orders add constraint pk_orders primary key clustered (Id)
+ALTER TABLE [dbo].[Orders]  WITH NOCHECK ADD  CONSTRAINT [FK_Orders_Customers] FOREIGN KEY([CustomerId]) REFERENCES [dbo].[Customers] ([Id])
+ALTER TABLE [dbo].[Orders] NOCHECK CONSTRAINT [FK_Orders_Customers]
+ALTER TABLE [dbo].[Orders] WITH CHECK CHECK CONSTRAINT [FK_Orders_Customers]
+ALTER TABLE [dbo].[Orders] ADD  CONSTRAINT [DF_Orders_Flag]  DEFAULT ((0)) FOR [Flag]
+alter table Orders add default getdate() for Created, check (Amount > 0)
+alter table Orders alter column Code nvarchar(50) not null
+alter table Orders alter column Amount decimal(18, 2) null
+alter table Orders drop column Code, Amount, constraint if exists pk_orders
+ALTER TABLE [dbo].[Orders] SET (LOCK_ESCALATION = TABLE)`
+	doc := NewSqlDocument(s)
+	if _, err := Parse(doc); err != nil {
+		t.Fatal(err)
+	}
+	expected := `create table Orders (
+    Id int generated by default as identity not null,
+    Flag boolean
+);
+ALTER TABLE dbo.orders add column code varchar(20) null, add column Amount numeric(19,4) not null default 0;
+alter table Orders add constraint pk_orders primary key (Id);
+ALTER TABLE dbo.orders add constraint fk_orders_customers foreign key (customerid) references dbo.customers(id) not valid;
+-- ALTER TABLE [dbo].[Orders] nocheck constraint [FK_Orders_Customers]
+ALTER TABLE dbo.orders validate constraint fk_orders_customers;
+ALTER TABLE dbo.orders alter column flag set default false;
+alter table Orders alter column Created set default now(), add check (Amount > 0);
+alter table Orders alter column Code type varchar(50), alter column Code set not null;
+alter table Orders alter column Amount type decimal(18, 2), alter column Amount drop not null;
+alter table Orders drop column Code, drop column Amount, drop constraint if exists pk_orders;
+-- ALTER TABLE [dbo].[Orders] set (LOCK_ESCALATION = TABLE)`
+	if sql := doc.PgSql(); sql != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, sql)
+	}
+	if sql := doc.SqlStatements[10].MsSql(); sql != "alter table Orders drop column Code, Amount, constraint if exists pk_orders" {
+		t.Errorf("got %s", sql)
+	}
+}
+
+func TestRename(t *testing.T) {
+	cases := map[string]string{
+		"exec sp_rename 'dbo.Orders.Code', 'OrderCode', 'COLUMN'":        "alter table dbo.Orders rename column Code to ordercode;",
+		"EXEC sys.sp_rename N'dbo.Orders.ix_code', N'IX Code', N'INDEX'": `alter index dbo.ix_code rename to "ix code";`,
+		"sp_rename 'Orders', 'SalesOrders'":                              "alter table Orders rename to salesorders;",
+		"exec sp_rename 'Orders', 'SalesOrders', 'userdatatype'":         "-- exec sp_rename 'Orders', 'SalesOrders', 'userdatatype'",
+	}
+	for s, expected := range cases {
+		stmt := parseOne(t, s)
+		if sql := stmt.PgSql(); sql != expected {
+			t.Errorf("%s\nexpected:\n%s\ngot:\n%s", s, expected, sql)
+		}
+		if sql := stmt.MsSql(); sql != s {
+			t.Errorf("expected:\n%s\ngot:\n%s", s, sql)
+		}
+	}
+}
+
+func TestCreateIndex(t *testing.T) {
+	s := `CREATE UNIQUE NONCLUSTERED INDEX [IX_Orders_Code] ON [dbo].[Orders]
+(
+	[Code] ASC,
+	[Created] DESC
+)
+INCLUDE ([Name], Amount)
+WHERE ([Deleted] = (0))
+WITH (PAD_INDEX = OFF, FILLFACTOR = 80, ONLINE = ON, DATA_COMPRESSION = PAGE) ON [PRIMARY]
+GO
+create clustered index ix_c on Orders (Created)`
+	doc := NewSqlDocument(s)
+	if _, err := Parse(doc); err != nil {
+		t.Fatal(err)
+	}
+	expected := `CREATE UNIQUE INDEX ix_orders_code on dbo.orders (code, created desc) include (name, Amount) with (fillfactor = 80) where (deleted = (0));
+create index ix_c on Orders (Created);`
+	if sql := doc.PgSql(); sql != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, sql)
+	}
+	expected = "CREATE UNIQUE NONCLUSTERED INDEX [IX_Orders_Code] on [dbo].[Orders] ([Code] asc, [Created] desc) include ([Name], Amount) where ([Deleted] = (0)) with (PAD_INDEX = OFF, FILLFACTOR = 80, ONLINE = ON, DATA_COMPRESSION = PAGE)"
+	if sql := doc.SqlStatements[0].MsSql(); sql != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, sql)
+	}
+	var warnings []string
+	for _, v := range doc.Warnings {
+		warnings = append(warnings, v.String())
+	}
+	if len(warnings) != 3 || warnings[0] != "line 8, column 7: index option PAD_INDEX is not supported by pgsql, ignored" {
+		t.Errorf("wrong warnings: %q", warnings)
+	}
+
+	doc = NewSqlDocument("create clustered index ix_c on Orders (Created)")
+	doc.ClusterIndexes = true
+	if _, err := Parse(doc); err != nil {
+		t.Fatal(err)
+	}
+	expected = "create index ix_c on Orders (Created);\ncluster Orders using ix_c;"
+	if sql := doc.SqlStatements[0].PgSql(); sql != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, sql)
+	}
+}
+
+func TestBitLiteral(t *testing.T) {
+	s := `create table Items (Id int identity, Active bit, Qty int)
+insert into Items values (1, 1), (0, 0)
+insert into Items (Qty, Active) values (1, (0))
+update Items set Active = 0 where Qty = 1 and Active = 1
+select Id from Items i where i.Active <> 0 and Qty = 0
+declare @b bit = 0
+set @b = 1
+if @b = 1 print 'yes'`
+	doc := NewSqlDocument(s)
+	if _, err := Parse(doc); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"insert into Items values (true, 1), (false, 0);",
+		"insert into Items(Qty, Active) values (1, false);",
+		"update Items set Active = false where Qty = 1 and Active = true;",
+		"select Id from Items as i where i.Active <> false and Qty = 0;",
+	}
+	for i, v := range expected {
+		if sql := doc.SqlStatements[i+1].PgSql(); sql != v {
+			t.Errorf("expected:\n%s\ngot:\n%s", v, sql)
+		}
+	}
+	if sql := doc.SqlStatements[2].MsSql(); sql != "insert into Items(Qty, Active) values (1, (0))" {
+		t.Errorf("got %s", sql)
+	}
+	sql := doc.PgSql()
+	if !strings.Contains(sql, "v_b := true;") || !strings.Contains(sql, "IF v_b = true THEN") {
+		t.Errorf("got:\n%s", sql)
+	}
+}
+
+func TestComputedColumn(t *testing.T) {
+	s := `create table Items (Price money, Total as (Price * 2) persisted, Qty int)
+alter table Items add Tax as Price / 10`
+	doc := NewSqlDocument(s)
+	doc.Recover = true
+	Parse(doc)
+	expected := "create table Items (\n    Price numeric(19,4),\n    Qty int\n    -- Total as (Price * 2) persisted\n);"
+	if sql := doc.SqlStatements[0].PgSql(); sql != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, sql)
+	}
+	if len(doc.Warnings) != 1 || doc.Warnings[0].Message != "computed column Total is not supported by pgsql, commented out" {
+		t.Errorf("wrong warnings: %v", doc.Warnings)
+	}
+	if len(doc.Errors) != 1 || doc.Errors[0].Err.Error() != "computed column Tax is not supported" {
+		t.Errorf("wrong errors: %v", doc.Errors)
+	}
+}
+
+func TestTableVariable(t *testing.T) {
+	s := `declare @t as table (Id int primary key, Active bit)
+insert into @t values (1, 1)
+select * from @t t where t.Active = 0`
+	doc := NewSqlDocument(s)
+	if _, err := Parse(doc); err != nil {
+		t.Fatal(err)
+	}
+	expected := "create temp table v_t (\n    Id int primary key,\n    Active boolean\n);\ninsert into v_t values (1, true);\nselect * from v_t as t where t.Active = false;"
+	if sql := doc.PgSql(); sql != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, sql)
+	}
+	expected = "declare @t as table (\n    Id int primary key,\n    Active bit\n)"
+	if sql := doc.SqlStatements[0].MsSql(); sql != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, sql)
+	}
+}
+
+func TestDropDefaultConstraint(t *testing.T) {
+	s := `create table Orders (Id int, Flag bit constraint df_flag default 0, Amount money)
+alter table Orders add constraint [DF_Amount] default 0 for Amount
+alter table Orders drop constraint df_amount, DF_Flag, pk_orders
+alter table Orders nocheck constraint all`
+	doc := NewSqlDocument(s)
+	if _, err := Parse(doc); err != nil {
+		t.Fatal(err)
+	}
+	expected := "alter table Orders alter column Amount drop default, alter column Flag drop default, drop constraint pk_orders;"
+	if sql := doc.SqlStatements[2].PgSql(); sql != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, sql)
+	}
+	if len(doc.Warnings) != 1 || doc.Warnings[0].String() != "line 4, column 20: alter table nocheck is not supported by pgsql, commented out" {
+		t.Errorf("wrong warnings: %v", doc.Warnings)
+	}
+}
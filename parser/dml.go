@@ -0,0 +1,723 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+//InsertStmt insert into table(columns) values (...), (...) 或者 insert into table select ...
+type InsertStmt struct {
+	Span
+	Table      *TableName
+	Columns    []Token
+	Values     [][]Expr
+	Select     *SelectStmt
+	Overriding bool //set identity_insert on之后的insert, pgsql中加overriding system value
+	Output     *OutputClause
+	keywords   map[string]Token
+	returns    []*ColumnDef //多语句表值函数中insert into @t, pgsql中为return query或return next
+}
+
+func isInsert(doc *SqlDocument) bool {
+	return doc.peekWord("insert")
+}
+
+func parseInsert(doc *SqlDocument) (SqlStatement, error) {
+	stmt := &InsertStmt{keywords: map[string]Token{}}
+	stmt.keywords["insert"], _ = doc.tk.PopToken()
+	if doc.peekWord("into") {
+		stmt.keywords["into"], _ = doc.tk.PopToken()
+	}
+	table, err := parseTableName(doc)
+	if err != nil {
+		return nil, err
+	}
+	stmt.Table = table
+	stmt.Overriding = doc.identityOn[tableKey(table)]
+	if doc.routine != nil && doc.routine.isReturnTable(table) {
+		stmt.returns = doc.routine.Columns
+	}
+	if token, _ := doc.tk.Peek(); token == "(" {
+		columns, err := parseNameList(doc)
+		if err != nil {
+			return nil, err
+		}
+		stmt.Columns = columns
+	}
+	if doc.peekWord("output") {
+		if stmt.Output, err = parseOutput(doc, false); err != nil {
+			return nil, err
+		}
+	}
+
+	if doc.peekWord("select") || doc.peekWord("with") {
+		sub, err := parseSelectStmt(doc)
+		if err != nil {
+			return nil, err
+		}
+		stmt.Select = sub
+		return stmt, nil
+	}
+	if doc.peekWord("default") {
+		keyword, err := doc.popKeyword("default", "values")
+		if err != nil {
+			return nil, err
+		}
+		stmt.keywords["default values"] = keyword
+		return stmt, nil
+	}
+	if stmt.keywords["values"], err = doc.popKeyword("values"); err != nil {
+		return nil, err
+	}
+	for {
+		if err := doc.expect("("); err != nil {
+			return nil, err
+		}
+		row, err := parseExprList(doc)
+		if err != nil {
+			return nil, err
+		}
+		if err := doc.expect(")"); err != nil {
+			return nil, err
+		}
+		stmt.Values = append(stmt.Values, row)
+		if token, _ := doc.tk.Peek(); token != "," {
+			break
+		}
+		doc.tk.Pop()
+	}
+	//bit列的0和1
+	for _, row := range stmt.Values {
+		for i, v := range row {
+			if column := stmt.column(doc, i); column != nil {
+				row[i] = bitValue(doc, v, column.Type)
+			}
+		}
+	}
+	return stmt, nil
+}
+
+//第i个值对应的列, 没有写列名时按表中列的顺序, 跳过identity列
+func (stmt *InsertStmt) column(doc *SqlDocument, i int) *ColumnDef {
+	columns := stmt.returns
+	if columns == nil {
+		columns = doc.columns[tableKey(stmt.Table)]
+	}
+	if len(stmt.Columns) == 0 {
+		for _, v := range columns {
+			if v.Identity != nil && !stmt.Overriding {
+				continue
+			}
+			if i == 0 {
+				return v
+			}
+			i--
+		}
+		return nil
+	}
+	for _, v := range columns {
+		if i < len(stmt.Columns) && strings.EqualFold(identValue(v.Name.Text), identValue(stmt.Columns[i].Text)) {
+			return v
+		}
+	}
+	return nil
+}
+
+func (stmt *InsertStmt) PgSql() string {
+	w := newSqlWriter(stmt.Span, true)
+	if stmt.returns != nil {
+		stmt.writeReturn(w)
+		return w.String()
+	}
+	stmt.writeSql(w)
+	return w.String() + ";"
+}
+
+//insert into @t select ... => return query select ...,
+//insert into @t values (...) => 给返回的列赋值后return next, 没有给值的列为null
+func (stmt *InsertStmt) writeReturn(w *sqlWriter) {
+	if stmt.Select != nil {
+		w.write("RETURN QUERY")
+		stmt.Select.writeSql(w)
+		w.append(";")
+		return
+	}
+	rows := stmt.Values
+	if rows == nil { //default values
+		rows = [][]Expr{nil}
+	}
+	for i, row := range rows {
+		if i > 0 {
+			w.newline()
+		}
+		for j, column := range stmt.returns {
+			index := j
+			if len(stmt.Columns) > 0 {
+				index = -1
+				for k, v := range stmt.Columns {
+					if strings.EqualFold(identValue(v.Text), identValue(column.Name.Text)) {
+						index = k
+					}
+				}
+			}
+			w.quietly(func() { w.token(column.Name) })
+			w.write(":=")
+			if index >= 0 && index < len(row) {
+				row[index].writeSql(w)
+			} else {
+				w.write("NULL")
+			}
+			w.append(";")
+			w.newline()
+		}
+		w.write("RETURN NEXT;")
+	}
+}
+
+func (stmt *InsertStmt) MsSql() string {
+	w := newSqlWriter(stmt.Span, false)
+	stmt.writeSql(w)
+	return w.String()
+}
+
+//pgsql的insert必须有into
+func (stmt *InsertStmt) writeSql(w *sqlWriter) {
+	writeKeyword(w, stmt.keywords, "insert")
+	if _, ok := stmt.keywords["into"]; ok || w.pg {
+		writeKeyword(w, stmt.keywords, "into")
+	}
+	stmt.Table.writeSql(w)
+	if len(stmt.Columns) > 0 {
+		writeNameList(w, stmt.Columns)
+	}
+	if stmt.Overriding && w.pg {
+		w.write("overriding system value")
+	}
+	if !w.pg {
+		stmt.Output.writeSql(w, stmt.Table, false)
+	}
+	switch {
+	case stmt.Select != nil:
+		stmt.Select.writeSql(w)
+	case stmt.Values == nil:
+		writeKeyword(w, stmt.keywords, "default values")
+	default:
+		writeKeyword(w, stmt.keywords, "values")
+		for i, row := range stmt.Values {
+			if i > 0 {
+				w.write(",")
+			}
+			w.write("(")
+			writeExprList(w, row)
+			w.write(")")
+		}
+	}
+	if w.pg {
+		stmt.Output.writeSql(w, stmt.Table, false)
+	}
+}
+
+//UpdateStmt update [top (n)] table set column = expr, ... [from ...] [where ...]
+type UpdateStmt struct {
+	Span
+	Top      *TopClause
+	Table    *TableName
+	Sets     []*SetClause
+	Output   *OutputClause
+	From     []TableRef
+	Where    Expr
+	target   *dmlTarget
+	keywords map[string]Token
+}
+
+//SetClause update中的column = expr, column += expr
+type SetClause struct {
+	Column []Token //table.column
+	Op     Token
+	Value  Expr
+}
+
+func isUpdate(doc *SqlDocument) bool {
+	return doc.peekWord("update")
+}
+
+func parseUpdate(doc *SqlDocument) (SqlStatement, error) {
+	stmt := &UpdateStmt{keywords: map[string]Token{}}
+	stmt.keywords["update"], _ = doc.tk.PopToken()
+	var err error
+	if doc.peekWord("top") {
+		if stmt.Top, err = parseTop(doc); err != nil {
+			return nil, err
+		}
+	}
+	if stmt.Table, err = parseTargetTable(doc); err != nil {
+		return nil, err
+	}
+	if stmt.keywords["set"], err = doc.popKeyword("set"); err != nil {
+		return nil, err
+	}
+	for {
+		set, err := parseSetClause(doc)
+		if err != nil {
+			return nil, err
+		}
+		stmt.Sets = append(stmt.Sets, set)
+		if token, _ := doc.tk.Peek(); token != "," {
+			break
+		}
+		doc.tk.Pop()
+	}
+	if doc.peekWord("output") {
+		if stmt.Output, err = parseOutput(doc, true); err != nil {
+			return nil, err
+		}
+	}
+	if doc.peekWord("from") {
+		stmt.keywords["from"], _ = doc.tk.PopToken()
+		if stmt.From, err = parseTableSources(doc); err != nil {
+			return nil, err
+		}
+	}
+	defer doc.pushScope(append([]*TableName{stmt.Table}, tableNames(stmt.From)...))()
+	if doc.peekWord("where") {
+		stmt.keywords["where"], _ = doc.tk.PopToken()
+		if stmt.Where, err = parseExpr(doc); err != nil {
+			return nil, err
+		}
+	}
+	stmt.target = resolveTarget(doc, stmt.Table, stmt.From)
+	for _, v := range stmt.Sets {
+		if column := doc.column(stmt.target.table, v.Column[len(v.Column)-1]); column != nil && v.Op.Text == "=" {
+			v.Value = bitValue(doc, v.Value, column.Type)
+		}
+	}
+	return stmt, nil
+}
+
+//dmlTarget update和delete在pgsql中的目标表.
+//mssql的from中可以再出现目标表(或者用别名指定目标表), pgsql中目标表不能在from/using中再出现,
+//要从from中去掉, 内连接的条件移到where中
+type dmlTarget struct {
+	table  *TableName //from中的目标表, 带别名
+	from   []TableRef //去掉目标表后的from
+	conds  []Expr     //连接条件
+	inFrom bool       //mssql的from中有目标表
+}
+
+func resolveTarget(doc *SqlDocument, table *TableName, from []TableRef) *dmlTarget {
+	target := &dmlTarget{table: table, from: from}
+	name := table.Parts[len(table.Parts)-1]
+	//带架构的目标表只匹配没有别名的表
+	matches := func(ref TableRef) bool {
+		v, ok := ref.(*TableName)
+		return ok && v.Args == nil && (len(table.Parts) == 1 || v.Alias.Text == "") && isTable(v, name)
+	}
+	for i, ref := range from {
+		var leaves []TableRef
+		var conds []Expr
+		inner := flattenJoin(ref, &leaves, &conds)
+		var found *TableName
+		for _, leaf := range leaves {
+			if found == nil && matches(leaf) {
+				found = leaf.(*TableName)
+			}
+		}
+		if found == nil {
+			continue
+		}
+		if !inner {
+			doc.warn(name, "target table %s is outer joined in from, not supported by pgsql", name.Text)
+			return target
+		}
+		rest := append([]TableRef{}, from[:i]...)
+		for _, leaf := range leaves {
+			if leaf != found {
+				rest = append(rest, leaf)
+			}
+		}
+		target.table, target.from, target.conds, target.inFrom = found, append(rest, from[i+1:]...), conds, true
+		return target
+	}
+	return target
+}
+
+//展开内连接和交叉连接的表和连接条件, 有外连接或者apply时返回false
+func flattenJoin(ref TableRef, leaves *[]TableRef, conds *[]Expr) bool {
+	join, ok := ref.(*JoinExpr)
+	if !ok {
+		*leaves = append(*leaves, ref)
+		return true
+	}
+	typ := strings.ToLower(strings.Join(strings.Fields(join.Type.Text), " "))
+	inner := typ == "join" || typ == "inner join" || typ == "cross join"
+	left := flattenJoin(join.Left, leaves, conds)
+	right := flattenJoin(join.Right, leaves, conds)
+	if join.On != nil {
+		*conds = append(*conds, join.On)
+	}
+	return inner && left && right
+}
+
+//update和delete的目标表, 不能有别名, 别名只能在from中指定
+func parseTargetTable(doc *SqlDocument) (*TableName, error) {
+	table, err := parseTableName(doc)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkReturnTable(doc, table); err != nil {
+		return nil, err
+	}
+	if err := parseTableHints(doc, table); err != nil {
+		return nil, err
+	}
+	return table, nil
+}
+
+//OutputClause output inserted.col, deleted.col, ..., pgsql中为returning
+type OutputClause struct {
+	Items   []*SelectItem
+	keyword Token
+}
+
+//output ..., 不支持output into. update中的deleted.col在pgsql中为old.col
+func parseOutput(doc *SqlDocument, update bool) (*OutputClause, error) {
+	output := &OutputClause{}
+	output.keyword, _ = doc.tk.PopToken()
+	mark := doc.tk.Mark()
+	for {
+		item, err := parseSelectItem(doc)
+		if err != nil {
+			return nil, err
+		}
+		output.Items = append(output.Items, item)
+		if token, _ := doc.tk.Peek(); token != "," {
+			break
+		}
+		doc.tk.Pop()
+	}
+	if token, _ := doc.tk.PeekToken(); strings.EqualFold(token.Text, "into") {
+		return nil, doc.tk.errorAt(token, fmt.Errorf("output into is not supported"))
+	}
+	tokens := doc.tk.tokens[mark:doc.tk.Mark()]
+	for i, token := range tokens {
+		if update && i+1 < len(tokens) && tokens[i+1].Text == "." && strings.EqualFold(identValue(token.Text), "deleted") {
+			doc.warn(token, "deleted in output is old in returning, requires pgsql 18")
+			break
+		}
+	}
+	return output, nil
+}
+
+//mssql中写在原来的位置, pgsql中在语句最后写returning, inserted和deleted换成目标表
+func (output *OutputClause) writeSql(w *sqlWriter, table *TableName, update bool) {
+	if output == nil {
+		return
+	}
+	items := func() {
+		for i, v := range output.Items {
+			if i > 0 {
+				w.write(",")
+			}
+			v.writeSql(w)
+		}
+	}
+	if !w.pg {
+		w.token(output.keyword)
+		items()
+		return
+	}
+	name := table.Alias
+	if name.Text == "" {
+		name = table.Parts[len(table.Parts)-1]
+	}
+	w.pseudo = map[string]Token{"inserted": name, "deleted": name}
+	if update {
+		w.pseudo["deleted"] = Token{Kind: TokenIdent, Text: "old"}
+	}
+	w.leading(output.keyword)
+	w.write("returning")
+	w.trailing(output.keyword)
+	items()
+	w.pseudo = nil
+}
+
+func parseSetClause(doc *SqlDocument) (*SetClause, error) {
+	set := &SetClause{}
+	for {
+		token, _ := doc.tk.PeekToken()
+		if !isName(token) {
+			return nil, doc.parseError("column")
+		}
+		set.Column = append(set.Column, token)
+		doc.tk.Pop()
+		if dot, _ := doc.tk.Peek(); dot != "." {
+			break
+		}
+		doc.tk.Pop()
+	}
+	op, _ := doc.tk.PeekToken()
+	if op.Text != "=" && compoundOps[op.Text] == "" {
+		return nil, doc.parseError("=")
+	}
+	set.Op = op
+	doc.tk.Pop()
+	value, err := parseExpr(doc)
+	if err != nil {
+		return nil, err
+	}
+	set.Value = value
+	return set, nil
+}
+
+func (stmt *UpdateStmt) PgSql() string {
+	w := newSqlWriter(stmt.Span, true)
+	stmt.writeSql(w)
+	return w.String() + ";"
+}
+
+func (stmt *UpdateStmt) MsSql() string {
+	w := newSqlWriter(stmt.Span, false)
+	stmt.writeSql(w)
+	return w.String()
+}
+
+func (stmt *UpdateStmt) writeSql(w *sqlWriter) {
+	writeKeyword(w, stmt.keywords, "update")
+	if stmt.Top != nil && !w.pg {
+		stmt.Top.writeSql(w)
+	}
+	table, from := stmt.Table, stmt.From
+	if w.pg {
+		table, from = stmt.target.table, stmt.target.from
+	}
+	table.writeSql(w)
+	writeKeyword(w, stmt.keywords, "set")
+	for i, v := range stmt.Sets {
+		if i > 0 {
+			w.write(",")
+		}
+		v.writeSql(w)
+	}
+	if !w.pg {
+		stmt.Output.writeSql(w, table, true)
+	}
+	if len(from) > 0 {
+		writeKeyword(w, stmt.keywords, "from")
+		writeTableSources(w, from)
+	}
+	writeWhere(w, stmt.keywords, stmt.Where, stmt.Top, stmt.target, stmt.From)
+	if w.pg {
+		stmt.Output.writeSql(w, table, true)
+	}
+}
+
+//pgsql中set的列不能带表名, col += expr => col = col + expr
+func (set *SetClause) writeSql(w *sqlWriter) {
+	if !w.pg {
+		for i, v := range set.Column {
+			if i > 0 {
+				w.write(".")
+			}
+			w.token(v)
+		}
+		w.token(set.Op)
+		set.Value.writeSql(w)
+		return
+	}
+	column := set.Column[len(set.Column)-1]
+	w.token(column)
+	op := compoundOps[set.Op.Text]
+	if op == "" {
+		w.token(set.Op)
+		set.Value.writeSql(w)
+		return
+	}
+	if op == "+" && isStringExpr(set.Value) {
+		op = "||"
+	}
+	w.leading(set.Op)
+	w.write("=")
+	w.trailing(set.Op)
+	w.quietly(func() { w.token(column) })
+	w.write(op)
+	_, binary := set.Value.(*BinaryExpr)
+	writeOperand(w, set.Value, binary)
+}
+
+//DeleteStmt delete [top (n)] [from] table [from ...] [where ...]
+type DeleteStmt struct {
+	Span
+	Top      *TopClause
+	Table    *TableName
+	Output   *OutputClause
+	From     []TableRef //第二个from, pgsql中为using
+	Where    Expr
+	target   *dmlTarget
+	keywords map[string]Token
+}
+
+func isDelete(doc *SqlDocument) bool {
+	return doc.peekWord("delete")
+}
+
+func parseDelete(doc *SqlDocument) (SqlStatement, error) {
+	stmt := &DeleteStmt{keywords: map[string]Token{}}
+	stmt.keywords["delete"], _ = doc.tk.PopToken()
+	var err error
+	if doc.peekWord("top") {
+		if stmt.Top, err = parseTop(doc); err != nil {
+			return nil, err
+		}
+	}
+	if doc.peekWord("from") {
+		stmt.keywords["from"], _ = doc.tk.PopToken()
+	}
+	if stmt.Table, err = parseTargetTable(doc); err != nil {
+		return nil, err
+	}
+	if doc.peekWord("output") {
+		if stmt.Output, err = parseOutput(doc, false); err != nil {
+			return nil, err
+		}
+	}
+	if doc.peekWord("from") {
+		stmt.keywords["using"], _ = doc.tk.PopToken()
+		if stmt.From, err = parseTableSources(doc); err != nil {
+			return nil, err
+		}
+	}
+	defer doc.pushScope(append([]*TableName{stmt.Table}, tableNames(stmt.From)...))()
+	if doc.peekWord("where") {
+		stmt.keywords["where"], _ = doc.tk.PopToken()
+		if stmt.Where, err = parseExpr(doc); err != nil {
+			return nil, err
+		}
+	}
+	stmt.target = resolveTarget(doc, stmt.Table, stmt.From)
+	return stmt, nil
+}
+
+func (stmt *DeleteStmt) PgSql() string {
+	w := newSqlWriter(stmt.Span, true)
+	stmt.writeSql(w)
+	return w.String() + ";"
+}
+
+func (stmt *DeleteStmt) MsSql() string {
+	w := newSqlWriter(stmt.Span, false)
+	stmt.writeSql(w)
+	return w.String()
+}
+
+//pgsql的delete必须有from, 第二个from为using
+func (stmt *DeleteStmt) writeSql(w *sqlWriter) {
+	writeKeyword(w, stmt.keywords, "delete")
+	if stmt.Top != nil && !w.pg {
+		stmt.Top.writeSql(w)
+	}
+	if _, ok := stmt.keywords["from"]; ok || w.pg {
+		writeKeyword(w, stmt.keywords, "from")
+	}
+	table, from := stmt.Table, stmt.From
+	if w.pg {
+		table, from = stmt.target.table, stmt.target.from
+	}
+	table.writeSql(w)
+	if !w.pg {
+		stmt.Output.writeSql(w, table, false)
+	}
+	if len(from) > 0 {
+		if using := stmt.keywords["using"]; w.pg {
+			w.leading(using)
+			w.write("using")
+			w.trailing(using)
+		} else {
+			w.token(using)
+		}
+		writeTableSources(w, from)
+	}
+	writeWhere(w, stmt.keywords, stmt.Where, stmt.Top, stmt.target, stmt.From)
+	if w.pg {
+		stmt.Output.writeSql(w, table, false)
+	}
+}
+
+//pgsql的update和delete没有top, 用ctid限制行数:
+//where ... and ctid in (select ctid from table where ... limit n)
+//from中的目标表去掉后连接条件也写在where中
+func writeWhere(w *sqlWriter, keywords map[string]Token, where Expr, top *TopClause, target *dmlTarget, from []TableRef) {
+	if !w.pg {
+		if where != nil {
+			writeKeyword(w, keywords, "where")
+			where.writeSql(w)
+		}
+		return
+	}
+	conds := target.conds
+	if where != nil {
+		conds = append(conds[:len(conds):len(conds)], where)
+	}
+	if len(conds) == 0 && top == nil {
+		return
+	}
+	writeKeyword(w, keywords, "where")
+	for i, v := range conds {
+		if i > 0 {
+			w.write("and")
+		}
+		if e, ok := v.(*BinaryExpr); ok && strings.EqualFold(e.Op.Text, "or") && (top != nil || len(conds) > 1) {
+			w.write("(")
+			v.writeSql(w)
+			w.write(")")
+		} else {
+			v.writeSql(w)
+		}
+	}
+	if top == nil {
+		return
+	}
+	if len(conds) > 0 {
+		w.write("and")
+	}
+	table := target.table
+	//有from时ctid要加上表名
+	ctid := func() {
+		w.quietly(func() {
+			if len(from) == 0 {
+				w.write("ctid")
+				return
+			}
+			name := table.Alias
+			if name.Text == "" {
+				name = table.Parts[len(table.Parts)-1]
+			}
+			w.token(name)
+			w.append(".ctid")
+		})
+	}
+	ctid()
+	w.write("in (select")
+	ctid()
+	//子查询用mssql的from, 目标表已经在from中时不再重复
+	sources := func(w *sqlWriter) {
+		w.quietly(func() {
+			w.write("from")
+			if target.inFrom {
+				writeTableSources(w, from)
+			} else {
+				table.writeSql(w)
+				for _, v := range from {
+					w.write(",")
+					v.writeSql(w)
+				}
+			}
+			if where != nil {
+				w.write("where")
+				where.writeSql(w)
+			}
+		})
+	}
+	sources(w)
+	top.writePgSql(w, sources)
+	w.write(")")
+}
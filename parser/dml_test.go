@@ -0,0 +1,101 @@
+package parser
+
+import (
+	"testing"
+)
+
+func TestInsertStmt(t *testing.T) {
+	cases := map[string]string{
+		"insert t1 values (1, 'a'), (2, 'b')":            "insert into t1 values (1, 'a'), (2, 'b');",
+		"insert into t1(a, [B]) select a, b from t2":     "insert into t1(a, b) select a, b from t2;",
+		"insert into #t default values":                  "insert into t default values;",
+		"insert into t1 (a) values (dateadd(dd, 1, @d))": "insert into t1(a) values (v_d + interval '1 day');",
+		"insert t1 (a) output inserted.id values (1)":    "insert into t1(a) values (1) returning t1.id;",
+	}
+	for s, expected := range cases {
+		if sql := parseOne(t, s).PgSql(); sql != expected {
+			t.Errorf("%s\nexpected:\n%s\ngot:\n%s", s, expected, sql)
+		}
+	}
+}
+
+func TestUpdateStmt(t *testing.T) {
+	cases := map[string]string{
+		"update t set a = 1, t.b += 'x' where id = 1":                                                     "update t set a = 1, b = b || 'x' where id = 1;",
+		"update t set a = a + 1 from t join x on t.id = x.id":                                             "update t set a = a + 1 from x where t.id = x.id;",
+		"update a set v = b.v from t a, x b where a.id = b.id or b.id = 0":                                "update t as a set v = b.v from x as b where a.id = b.id or b.id = 0;",
+		"update a set v = 1 from y join t a on a.id = y.id join x on x.id = a.x where x.v = 1 or y.v = 1": "update t as a set v = 1 from y, x where a.id = y.id and x.id = a.x and (x.v = 1 or y.v = 1);",
+		"update top (10) t set a = 1 where a = 0 or b = 1":                                                "update t set a = 1 where (a = 0 or b = 1) and ctid in (select ctid from t where a = 0 or b = 1 limit 10);",
+		"UPDATE TOP (5) PERCENT t SET a = 1":                                                              "UPDATE t SET a = 1 where ctid in (select ctid from t limit (select ceil(count(*) * 5 / 100.0) from t));",
+		"update top (@n) t set a = 1 from t join x on t.id = x.id":                                        "update t set a = 1 from x where t.id = x.id and t.ctid in (select t.ctid from t join x on t.id = x.id limit v_n);",
+		"update t with (rowlock) set a *= 2 -- double\nwhere b is null":                                   "update t set a = a * 2 -- double\nwhere b is null;",
+		"update t set a = 1 output inserted.a, deleted.a old_a where b = 2":                               "update t set a = 1 where b = 2 returning t.a, old.a as old_a;",
+	}
+	for s, expected := range cases {
+		stmt := parseOne(t, s)
+		if _, ok := stmt.(*UpdateStmt); !ok {
+			t.Fatalf("%s: expected UpdateStmt, got %#v", s, stmt)
+		}
+		if sql := stmt.PgSql(); sql != expected {
+			t.Errorf("%s\nexpected:\n%s\ngot:\n%s", s, expected, sql)
+		}
+		if sql := stmt.MsSql(); sql != s {
+			t.Errorf("expected:\n%s\ngot:\n%s", s, sql)
+		}
+	}
+}
+
+func TestUpdateOuterJoinTarget(t *testing.T) {
+	doc := NewSqlDocument("update t set a = 1 from t left join x on t.id = x.id")
+	if _, err := Parse(doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Warnings) != 1 {
+		t.Fatalf("expected 1 warning, got %v", doc.Warnings)
+	}
+}
+
+func TestDeleteStmt(t *testing.T) {
+	cases := map[string]string{
+		"delete t where a = 1":                                "delete from t where a = 1;",
+		"delete top (3) from t where a = 1":                   "delete from t where a = 1 and ctid in (select ctid from t where a = 1 limit 3);",
+		"delete t from t join x on t.id = x.id where x.v = 1": "delete from t using x where t.id = x.id and x.v = 1;",
+		"delete a from t a inner join x on a.id = x.id":       "delete from t as a using x where a.id = x.id;",
+		"delete top (1) t from x, t where t.id = x.id":        "delete from t using x where t.id = x.id and t.ctid in (select t.ctid from x, t where t.id = x.id limit 1);",
+		"delete top (10) percent from #t":                     "delete from t where ctid in (select ctid from t limit (select ceil(count(*) * 10 / 100.0) from t));",
+		"delete from t output deleted.id where id = 1":        "delete from t where id = 1 returning t.id;",
+		"delete a output deleted.* from t a where a.id = 1":   "delete from t as a where a.id = 1 returning a.*;",
+	}
+	for s, expected := range cases {
+		stmt := parseOne(t, s)
+		if _, ok := stmt.(*DeleteStmt); !ok {
+			t.Fatalf("%s: expected DeleteStmt, got %#v", s, stmt)
+		}
+		if sql := stmt.PgSql(); sql != expected {
+			t.Errorf("%s\nexpected:\n%s\ngot:\n%s", s, expected, sql)
+		}
+		if sql := stmt.MsSql(); sql != s {
+			t.Errorf("expected:\n%s\ngot:\n%s", s, sql)
+		}
+	}
+}
+
+func TestOutputClause(t *testing.T) {
+	doc := NewSqlDocument("update t set a = 1 output deleted.a where b = 2")
+	if _, err := Parse(doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Warnings) != 1 || doc.Warnings[0].Message != "deleted in output is old in returning, requires pgsql 18" {
+		t.Errorf("wrong warnings: %v", doc.Warnings)
+	}
+	for _, s := range []string{
+		"delete from t output deleted.id into @ids where id = 1",
+		"delete from t x where x.id = 1",
+		"update t a set a = 1",
+	} {
+		doc := NewSqlDocument(s)
+		if _, err := Parse(doc); err == nil {
+			t.Errorf("%s: expected parse error", s)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+//ParseError 记录语法错误发生的位置以及期望的token
+type ParseError struct {
+	Offset   int      //出错token的字节偏移, 从0开始
+	Line     int      //行号, 从1开始
+	Column   int      //列号, 从1开始
+	Token    string   //出错的token, 空串表示已到结尾
+	Expected []string //期望的token
+	Err      error    //词法错误
+	text     []byte   //出错时缓存的源语句, 不复制, 调用Stat时才标记
+	base     int      //text[0]在源语句中的位置
+}
+
+//Stat 在出错token前插入"<< "标记出错位置的语句
+func (e *ParseError) Stat() []byte {
+	return markError(e.text, e.Offset-e.base)
+}
+
+func (e *ParseError) Error() string {
+	token := fmt.Sprintf("%q", e.Token)
+	if e.Token == "" {
+		token = "end of input"
+	}
+	msg := fmt.Sprintf("line %d, column %d: unexpected %s", e.Line, e.Column, token)
+	if e.Err != nil {
+		msg = fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Err)
+	}
+	if len(e.Expected) > 0 {
+		var a []string
+		for _, v := range e.Expected {
+			a = append(a, fmt.Sprintf("%q", v))
+		}
+		msg += ", expected " + strings.Join(a, " or ")
+	}
+	return msg
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+//ParseErrors 恢复模式下收集到的所有错误
+type ParseErrors []*ParseError
+
+func (errs ParseErrors) Error() string {
+	if len(errs) == 1 {
+		return errs[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", errs[0], len(errs)-1)
+}
+
+func (tk *Tokener) newParseError(expected ...string) *ParseError {
+	e := tk.errorAt(tk.curToken(), tk.err)
+	e.Expected = expected
+	return e
+}
+
+//错误返回给调用者时标记缓存的源语句被引用, release时不能再覆盖. 回溯时丢弃的错误不用标记
+func (tk *Tokener) share(e *ParseError) *ParseError {
+	tk.shared = true
+	return e
+}
+
+//在token处生成错误, 用于报告非当前token的错误
+func (tk *Tokener) errorAt(token Token, err error) *ParseError {
+	return &ParseError{
+		Offset: token.Start,
+		Line:   token.Line,
+		Column: token.Column,
+		Token:  token.Text,
+		Err:    err,
+		text:   tk.statement,
+		base:   tk.base,
+	}
+}
+
+//Warning 翻译时被丢弃或者无法翻译的内容, 例如pgsql不支持的索引选项
+type Warning struct {
+	Line    int //行号, 从1开始
+	Column  int //列号, 从1开始
+	Message string
+}
+
+func (w *Warning) String() string {
+	return fmt.Sprintf("line %d, column %d: %s", w.Line, w.Column, w.Message)
+}
+
+//在token处记录警告
+func (doc *SqlDocument) warn(token Token, format string, a ...interface{}) {
+	doc.Warnings = append(doc.Warnings, &Warning{Line: token.Line, Column: token.Column, Message: fmt.Sprintf(format, a...)})
+}
+
+//去掉token处最后一个警告, 用于解析后面的内容时才能确定可以翻译的情况
+func (doc *SqlDocument) unwarn(token Token) {
+	for i := len(doc.Warnings) - 1; i >= 0; i-- {
+		if v := doc.Warnings[i]; v.Line == token.Line && v.Column == token.Column {
+			doc.Warnings = append(doc.Warnings[:i], doc.Warnings[i+1:]...)
+			return
+		}
+	}
+}
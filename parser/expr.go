@@ -0,0 +1,1009 @@
+package parser
+
+import (
+	"strings"
+)
+
+//Expr 表达式
+type Expr interface {
+	node
+}
+
+//Literal 数字, 字符串, null
+type Literal struct {
+	Token Token
+}
+
+//BitLiteral bit变量或列比较和赋值时的0和1, pgsql中为false和true
+type BitLiteral struct {
+	Expr         //原来的表达式, 可能带括号
+	Value string //false或true
+	token Token
+}
+
+//ColumnRef 列名, t.col, t.*, *, 以及current_timestamp等不带括号的函数
+type ColumnRef struct {
+	Parts []Token
+}
+
+//VariableRef @name, 声明过的变量带有类型
+type VariableRef struct {
+	Token Token
+	Type  string
+}
+
+//UnaryExpr -x, ~x, not x, 以及all/any/some (select ...)
+type UnaryExpr struct {
+	Op   Token
+	Expr Expr
+}
+
+//BinaryExpr 算术, 位运算, 比较, and, or
+type BinaryExpr struct {
+	Left  Expr
+	Op    Token
+	Right Expr
+}
+
+//ParenExpr 源语句中的括号
+type ParenExpr struct {
+	Expr Expr
+}
+
+//FuncCall name(args) [over (...)]
+type FuncCall struct {
+	Name     []Token //schema.name
+	Distinct bool    //count(distinct x)
+	Args     []Expr
+	Over     *WindowSpec
+	keywords map[string]Token
+}
+
+//WindowSpec over (partition by ... order by ... rows ...)
+type WindowSpec struct {
+	PartitionBy []Expr
+	OrderBy     []*OrderItem
+	Frame       *RawExpr //rows/range子句, 原样输出
+}
+
+//CaseExpr case [operand] when ... then ... else ... end
+type CaseExpr struct {
+	Operand Expr
+	Whens   []*WhenClause
+	Else    Expr
+}
+
+type WhenClause struct {
+	Cond   Expr
+	Result Expr
+}
+
+//Cast cast(expr as type), try_cast(expr as type)
+type Cast struct {
+	Expr Expr
+	Type string
+	Try  bool
+}
+
+//Between expr [not] between low and high
+type Between struct {
+	Expr Expr
+	Not  bool
+	Low  Expr
+	High Expr
+}
+
+//InList expr [not] in (list) 或者 expr [not] in (select ...)
+type InList struct {
+	Expr     Expr
+	Not      bool
+	List     []Expr
+	Subquery *Subquery
+}
+
+//Like expr [not] like pattern [escape escape]
+type Like struct {
+	Expr    Expr
+	Not     bool
+	Pattern Expr
+	Escape  Expr
+}
+
+//IsNull expr is [not] null
+type IsNull struct {
+	Expr Expr
+	Not  bool
+}
+
+//Exists exists (select ...)
+type Exists struct {
+	Subquery *Subquery
+}
+
+//Subquery (select ...)
+type Subquery struct {
+	Select *SelectStmt
+}
+
+//Collate expr collate name, pgsql的排序规则不同, 翻译时去掉
+type Collate struct {
+	Expr      Expr
+	Collation Token
+}
+
+//RawExpr 未进一步解析的token, 按token翻译
+type RawExpr struct {
+	s      string
+	start  int     //s在源语句中的位置
+	tokens []Token //s中的token
+}
+
+//运算符优先级, 数字越大结合越紧
+const (
+	precOr = iota + 1
+	precAnd
+	precNot
+	precCompare //比较, like, in, between, is
+	precAdd     //+ - & | ^
+	precMul     //* / %
+	precUnary   //- + ~
+)
+
+var binaryPrec = map[string]int{
+	"or": precOr, "and": precAnd,
+	"=": precCompare, "<>": precCompare, "!=": precCompare, "<": precCompare, ">": precCompare,
+	"<=": precCompare, ">=": precCompare, "!<": precCompare, "!>": precCompare,
+	"+": precAdd, "-": precAdd, "&": precAdd, "|": precAdd, "^": precAdd,
+	"*": precMul, "/": precMul, "%": precMul,
+}
+
+//不带括号的函数
+var niladicFuncs = map[string]bool{
+	"current_timestamp": true, "current_user": true, "session_user": true, "system_user": true,
+	"user": true, "current_date": true, "current_time": true,
+}
+
+func parseExpr(doc *SqlDocument) (Expr, error) {
+	return parseExprPrec(doc, 0)
+}
+
+//Pratt解析, 只解析优先级大于prec的运算符
+func parseExprPrec(doc *SqlDocument, prec int) (Expr, error) {
+	left, err := parsePrefix(doc)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		token, err := doc.tk.PeekToken()
+		if err != nil {
+			return nil, doc.parseError()
+		}
+		word := strings.ToLower(token.Text)
+
+		//not like, not in, not between
+		not := token.Kind == TokenKeyword && word == "not"
+		if not {
+			mark := doc.tk.Mark()
+			doc.tk.Pop()
+			next := doc.peekWord("like") || doc.peekWord("in") || doc.peekWord("between")
+			doc.tk.Reset(mark)
+			if !next || precCompare <= prec {
+				return left, nil
+			}
+			doc.tk.Pop()
+			token, _ = doc.tk.PeekToken()
+			word = strings.ToLower(token.Text)
+		}
+		if token.Kind != TokenKeyword && token.Kind != TokenOperator {
+			return left, nil
+		}
+
+		switch word {
+		case "is", "like", "between", "in":
+			if precCompare <= prec {
+				return left, nil
+			}
+			doc.tk.Pop()
+			if left, err = parsePredicate(doc, left, word, not); err != nil {
+				return nil, err
+			}
+			continue
+		case "collate":
+			doc.tk.Pop()
+			collation, _ := doc.tk.PeekToken()
+			if !isName(collation) {
+				return nil, doc.parseError("collation")
+			}
+			doc.tk.Pop()
+			left = &Collate{left, collation}
+			continue
+		}
+
+		p, ok := binaryPrec[word]
+		if !ok || p <= prec {
+			return left, nil
+		}
+		doc.tk.Pop()
+		right, err := parseExprPrec(doc, p)
+		if err != nil {
+			return nil, err
+		}
+		expr := &BinaryExpr{left, token, right}
+		if word == "=" || word == "<>" || word == "!=" {
+			expr.Right = bitValue(doc, expr.Right, doc.valueType(expr.Left))
+			expr.Left = bitValue(doc, expr.Left, doc.valueType(expr.Right))
+		}
+		if v, _ := foundTest(expr); v != nil {
+			doc.unwarn(v.Token)
+		}
+		if call, _ := sqlstateTest(expr); call != nil {
+			doc.unwarn(call.Name[0])
+		}
+		left = expr
+	}
+}
+
+//is [not] null, [not] like, [not] between, [not] in, 运算符已弹出
+func parsePredicate(doc *SqlDocument, left Expr, word string, not bool) (Expr, error) {
+	var err error
+	switch word {
+	case "is":
+		expr := &IsNull{Expr: left}
+		if doc.peekWord("not") {
+			doc.tk.Pop()
+			expr.Not = true
+		}
+		if err := doc.expect("null"); err != nil {
+			return nil, err
+		}
+		return expr, nil
+	case "like":
+		expr := &Like{Expr: left, Not: not}
+		if expr.Pattern, err = parseExprPrec(doc, precCompare); err != nil {
+			return nil, err
+		}
+		if doc.peekWord("escape") {
+			doc.tk.Pop()
+			if expr.Escape, err = parseExprPrec(doc, precCompare); err != nil {
+				return nil, err
+			}
+		}
+		return expr, nil
+	case "between":
+		expr := &Between{Expr: left, Not: not}
+		if expr.Low, err = parseExprPrec(doc, precCompare); err != nil {
+			return nil, err
+		}
+		if err := doc.expect("and"); err != nil {
+			return nil, err
+		}
+		if expr.High, err = parseExprPrec(doc, precCompare); err != nil {
+			return nil, err
+		}
+		return expr, nil
+	}
+
+	expr := &InList{Expr: left, Not: not}
+	if err := doc.expect("("); err != nil {
+		return nil, err
+	}
+	if doc.peekWord("select") || doc.peekWord("with") {
+		sub, err := parseSelectStmt(doc)
+		if err != nil {
+			return nil, err
+		}
+		expr.Subquery = &Subquery{sub}
+	} else if expr.List, err = parseExprList(doc); err != nil {
+		return nil, err
+	}
+	if err := doc.expect(")"); err != nil {
+		return nil, err
+	}
+	return expr, nil
+}
+
+func parsePrefix(doc *SqlDocument) (Expr, error) {
+	token, err := doc.tk.PeekToken()
+	if err != nil {
+		return nil, doc.parseError()
+	}
+	word := strings.ToLower(token.Text)
+	switch token.Kind {
+	case TokenNumber, TokenString:
+		doc.tk.Pop()
+		return &Literal{token}, nil
+	case TokenVariable:
+		doc.tk.Pop()
+		expr := &VariableRef{Token: token}
+		if v := doc.findVar(token.Text); v != nil {
+			expr.Type = v.typ
+		}
+		if _, ok := pgGlobalVars[word]; !ok && strings.HasPrefix(word, "@@") {
+			doc.warn(token, "global variable %s is not supported by pgsql", token.Text)
+		}
+		return expr, nil
+	case TokenOperator:
+		switch token.Text {
+		case "-", "+", "~":
+			doc.tk.Pop()
+			expr, err := parseExprPrec(doc, precUnary)
+			if err != nil {
+				return nil, err
+			}
+			return &UnaryExpr{token, expr}, nil
+		case "*":
+			doc.tk.Pop()
+			return &ColumnRef{[]Token{token}}, nil
+		}
+	case TokenPunct:
+		if token.Text != "(" {
+			break
+		}
+		doc.tk.Pop()
+		var expr Expr
+		if doc.peekWord("select") || doc.peekWord("with") {
+			sub, err := parseSelectStmt(doc)
+			if err != nil {
+				return nil, err
+			}
+			expr = &Subquery{sub}
+		} else {
+			inner, err := parseExpr(doc)
+			if err != nil {
+				return nil, err
+			}
+			expr = &ParenExpr{inner}
+		}
+		if err := doc.expect(")"); err != nil {
+			return nil, err
+		}
+		return expr, nil
+	case TokenKeyword:
+		switch word {
+		case "null":
+			doc.tk.Pop()
+			return &Literal{token}, nil
+		case "not":
+			doc.tk.Pop()
+			expr, err := parseExprPrec(doc, precNot)
+			if err != nil {
+				return nil, err
+			}
+			return &UnaryExpr{token, expr}, nil
+		case "exists":
+			doc.tk.Pop()
+			sub, err := parseSubquery(doc)
+			if err != nil {
+				return nil, err
+			}
+			return &Exists{sub}, nil
+		case "all", "any", "some":
+			doc.tk.Pop()
+			sub, err := parseSubquery(doc)
+			if err != nil {
+				return nil, err
+			}
+			return &UnaryExpr{token, sub}, nil
+		case "case":
+			return parseCase(doc)
+		}
+		if niladicFuncs[word] {
+			doc.tk.Pop()
+			return &ColumnRef{[]Token{token}}, nil
+		}
+		mark := doc.tk.Mark()
+		doc.tk.Pop()
+		next, _ := doc.tk.Peek()
+		doc.tk.Reset(mark)
+		if next == "(" { //left(...), convert(...), coalesce(...)
+			return parseName(doc)
+		}
+	case TokenIdent, TokenQuotedIdent:
+		if token.Kind == TokenIdent && (word == "cast" || word == "try_cast") {
+			return parseCast(doc)
+		}
+		return parseName(doc)
+	}
+	return nil, doc.parseError("expression")
+}
+
+//a.b.c, t.*, schema.func(...)
+func parseName(doc *SqlDocument) (Expr, error) {
+	var parts []Token
+	for {
+		token, _ := doc.tk.PeekToken()
+		if token.Text == "*" && len(parts) > 0 {
+			doc.tk.Pop()
+			return &ColumnRef{append(parts, token)}, nil
+		}
+		if !isName(token) && token.Kind != TokenKeyword {
+			return nil, doc.parseError("name")
+		}
+		parts = append(parts, token)
+		doc.tk.Pop()
+		next, _ := doc.tk.Peek()
+		if next == "(" {
+			return parseFuncCall(doc, parts)
+		}
+		if next != "." {
+			return &ColumnRef{parts}, nil
+		}
+		doc.tk.Pop()
+	}
+}
+
+//(select ...)
+func parseSubquery(doc *SqlDocument) (*Subquery, error) {
+	if err := doc.expect("("); err != nil {
+		return nil, err
+	}
+	sub, err := parseSelectStmt(doc)
+	if err != nil {
+		return nil, err
+	}
+	if err := doc.expect(")"); err != nil {
+		return nil, err
+	}
+	return &Subquery{sub}, nil
+}
+
+func parseFuncCall(doc *SqlDocument, name []Token) (Expr, error) {
+	call := &FuncCall{Name: name, Args: []Expr{}, keywords: map[string]Token{}}
+	doc.tk.Pop() //(
+	if doc.peekWord("distinct") {
+		call.keywords["distinct"], _ = doc.tk.PopToken()
+		call.Distinct = true
+	}
+	if token, _ := doc.tk.Peek(); token != ")" {
+		args, err := parseExprList(doc)
+		if err != nil {
+			return nil, err
+		}
+		call.Args = args
+	}
+	if err := doc.expect(")"); err != nil {
+		return nil, err
+	}
+	if doc.peekWord("over") {
+		call.keywords["over"], _ = doc.tk.PopToken()
+		over, err := parseWindowSpec(doc)
+		if err != nil {
+			return nil, err
+		}
+		call.Over = over
+	}
+	switch name := call.funcName(); name {
+	case "error_line", "error_procedure":
+		if len(doc.catches) > 0 {
+			doc.catches[len(doc.catches)-1].context = true
+		}
+	case "error_number":
+		doc.warn(call.Name[0], "error_number() is translated to sqlstate, a text error code")
+	case "error_severity":
+		doc.warn(call.Name[0], "error_severity() has no equivalent in pgsql, translated to 16")
+	case "error_state":
+		doc.warn(call.Name[0], "error_state() has no equivalent in pgsql, translated to 1")
+	case "xact_state":
+		doc.warn(call.Name[0], "xact_state() has no equivalent in pgsql")
+	}
+	return call, nil
+}
+
+func parseWindowSpec(doc *SqlDocument) (*WindowSpec, error) {
+	over := &WindowSpec{}
+	if err := doc.expect("("); err != nil {
+		return nil, err
+	}
+	if doc.peekWord("partition") {
+		if _, err := doc.popKeyword("partition", "by"); err != nil {
+			return nil, err
+		}
+		exprs, err := parseExprList(doc)
+		if err != nil {
+			return nil, err
+		}
+		over.PartitionBy = exprs
+	}
+	if doc.peekWord("order") {
+		if _, err := doc.popKeyword("order", "by"); err != nil {
+			return nil, err
+		}
+		items, err := parseOrderItems(doc)
+		if err != nil {
+			return nil, err
+		}
+		over.OrderBy = items
+	}
+	if doc.peekWord("rows") || doc.peekWord("range") {
+		var tokens []Token
+		for {
+			token, err := doc.tk.PeekToken()
+			if err != nil || token.Kind == TokenEOF || token.Kind == TokenGo {
+				return nil, doc.parseError(")")
+			}
+			if token.Text == ")" {
+				break
+			}
+			tokens = append(tokens, token)
+			doc.tk.Pop()
+		}
+		start, end := tokens[0].Start, tokens[len(tokens)-1].End
+		over.Frame = &RawExpr{s: string(doc.tk.slice(start, end)), start: start, tokens: tokens}
+	}
+	if err := doc.expect(")"); err != nil {
+		return nil, err
+	}
+	return over, nil
+}
+
+func parseCase(doc *SqlDocument) (Expr, error) {
+	expr := &CaseExpr{}
+	doc.tk.Pop()
+	var err error
+	if !doc.peekWord("when") {
+		if expr.Operand, err = parseExpr(doc); err != nil {
+			return nil, err
+		}
+	}
+	for doc.peekWord("when") {
+		doc.tk.Pop()
+		when := &WhenClause{}
+		if when.Cond, err = parseExpr(doc); err != nil {
+			return nil, err
+		}
+		if err := doc.expect("then"); err != nil {
+			return nil, err
+		}
+		if when.Result, err = parseExpr(doc); err != nil {
+			return nil, err
+		}
+		expr.Whens = append(expr.Whens, when)
+	}
+	if len(expr.Whens) == 0 {
+		return nil, doc.parseError("when")
+	}
+	if doc.peekWord("else") {
+		doc.tk.Pop()
+		if expr.Else, err = parseExpr(doc); err != nil {
+			return nil, err
+		}
+	}
+	if err := doc.expect("end"); err != nil {
+		return nil, err
+	}
+	return expr, nil
+}
+
+func parseCast(doc *SqlDocument) (Expr, error) {
+	token, _ := doc.tk.PopToken()
+	expr := &Cast{Try: strings.EqualFold(token.Text, "try_cast")}
+	if err := doc.expect("("); err != nil {
+		return nil, err
+	}
+	var err error
+	if expr.Expr, err = parseExpr(doc); err != nil {
+		return nil, err
+	}
+	if err := doc.expect("as"); err != nil {
+		return nil, err
+	}
+	if expr.Type, err = parseDataType(doc); err != nil {
+		return nil, err
+	}
+	if err := doc.expect(")"); err != nil {
+		return nil, err
+	}
+	return expr, nil
+}
+
+//解析逗号分隔的表达式
+func parseExprList(doc *SqlDocument) ([]Expr, error) {
+	var exprs []Expr
+	for {
+		expr, err := parseExpr(doc)
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+		if token, _ := doc.tk.Peek(); token != "," {
+			return exprs, nil
+		}
+		doc.tk.Pop()
+	}
+}
+
+//expr [asc|desc], ...
+func parseOrderItems(doc *SqlDocument) ([]*OrderItem, error) {
+	var items []*OrderItem
+	for {
+		item := &OrderItem{}
+		expr, err := parseExpr(doc)
+		if err != nil {
+			return nil, err
+		}
+		item.Expr = expr
+		if doc.peekWord("asc") || doc.peekWord("desc") {
+			item.Dir, _ = doc.tk.PopToken()
+		}
+		items = append(items, item)
+		if token, _ := doc.tk.Peek(); token != "," {
+			return items, nil
+		}
+		doc.tk.Pop()
+	}
+}
+
+//表达式是否为字符串, pgsql中字符串用||连接
+func isStringExpr(expr Expr) bool {
+	switch e := expr.(type) {
+	case *Literal:
+		return e.Token.Kind == TokenString
+	case *VariableRef:
+		return isStringType(e.Type)
+	case *ParenExpr:
+		return isStringExpr(e.Expr)
+	case *Cast:
+		return isStringType(e.Type)
+	case *Collate:
+		return true
+	case *FuncCall:
+		return stringFuncs[e.funcName()] || e.funcName() == "isnull" && len(e.Args) > 0 && isStringExpr(e.Args[0])
+	case *BinaryExpr:
+		return e.Op.Text == "+" && (isStringExpr(e.Left) || isStringExpr(e.Right))
+	}
+	return false
+}
+
+//表达式翻译后的sql
+func exprSql(expr Expr, pg bool) string {
+	w := newSqlWriter(Span{}, pg)
+	expr.writeSql(w)
+	return w.String()
+}
+
+//用语句的翻译选项输出pgsql表达式
+func pgExpr(expr Expr, opts *options) string {
+	w := newSqlWriter(Span{opts: opts}, true)
+	expr.writeSql(w)
+	return w.String()
+}
+
+func writeExprList(w *sqlWriter, exprs []Expr) {
+	for i, v := range exprs {
+		if i > 0 {
+			w.write(",")
+		}
+		v.writeSql(w)
+	}
+}
+
+func writeOrderItems(w *sqlWriter, items []*OrderItem) {
+	for i, v := range items {
+		if i > 0 {
+			w.write(",")
+		}
+		v.Expr.writeSql(w)
+		if v.Dir.Text != "" {
+			w.token(v.Dir)
+		}
+	}
+}
+
+func (expr *Literal) writeSql(w *sqlWriter) {
+	w.token(expr.Token)
+}
+
+func (expr *BitLiteral) writeSql(w *sqlWriter) {
+	if !w.pg {
+		expr.Expr.writeSql(w)
+		return
+	}
+	w.leading(expr.token)
+	w.write(expr.Value)
+	w.trailing(expr.token)
+}
+
+func (expr *ColumnRef) writeSql(w *sqlWriter) {
+	for i, v := range expr.Parts {
+		if i > 0 {
+			w.write(".")
+		}
+		if name, ok := w.pseudo[strings.ToLower(identValue(v.Text))]; ok && i == 0 && len(expr.Parts) == 2 {
+			w.leading(v)
+			w.quietly(func() { w.token(name) })
+			w.trailing(v)
+			continue
+		}
+		w.token(v)
+	}
+}
+
+func (expr *VariableRef) writeSql(w *sqlWriter) {
+	if v, ok := pgGlobalVars[strings.ToLower(expr.Token.Text)]; ok && w.pg {
+		w.leading(expr.Token)
+		w.write(v)
+		w.trailing(expr.Token)
+		return
+	}
+	w.token(expr.Token)
+}
+
+//- -1不能写成--1, 否则成了注释
+func (expr *UnaryExpr) writeSql(w *sqlWriter) {
+	w.token(expr.Op)
+	if inner, ok := expr.Expr.(*UnaryExpr); expr.Op.Kind == TokenOperator && (!ok || inner.Op.Kind != TokenOperator) {
+		w.glue()
+	}
+	expr.Expr.writeSql(w)
+}
+
+//pgsql中字符串的+转成||, 位运算的优先级低于+-, 需要加括号
+func (expr *BinaryExpr) writeSql(w *sqlWriter) {
+	if v, found := foundTest(expr); v != nil && w.pg {
+		w.leading(v.Token)
+		w.write(found)
+		w.trailing(v.Token)
+		return
+	}
+	if call, code := sqlstateTest(expr); call != nil && w.pg {
+		for i, v := range []Expr{expr.Left, expr.Right} {
+			if i > 0 {
+				w.token(expr.Op)
+			}
+			if n, ok := v.(*Literal); ok {
+				w.leading(n.Token)
+				w.write(pgString(code))
+				w.trailing(n.Token)
+			} else {
+				v.writeSql(w)
+			}
+		}
+		return
+	}
+	op := expr.Op.Text
+	writeOperand(w, expr.Left, isBitwise(expr))
+	if w.pg && op == "+" && isStringExpr(expr) {
+		w.leading(expr.Op)
+		w.write("||")
+		w.trailing(expr.Op)
+	} else {
+		w.token(expr.Op)
+	}
+	writeOperand(w, expr.Right, isBitwise(expr))
+}
+
+//交换两边后的比较运算符
+var flippedOps = map[string]string{"<": ">", ">": "<", "<=": ">=", ">=": "<=", "!<": "!>", "!>": "!<"}
+
+//x op 数字, 数字在左边时交换两边
+func compareNumber(expr *BinaryExpr) (Expr, string, *Literal) {
+	left, op, right := expr.Left, expr.Op.Text, expr.Right
+	if n, ok := left.(*Literal); ok {
+		left, right = right, n
+		if v, ok := flippedOps[op]; ok {
+			op = v
+		}
+	}
+	if n, ok := right.(*Literal); ok && n.Token.Kind == TokenNumber {
+		return left, op, n
+	}
+	return nil, "", nil
+}
+
+//@@rowcount = 0 => not found, @@rowcount > 0 => found
+func foundTest(expr *BinaryExpr) (*VariableRef, string) {
+	left, op, n := compareNumber(expr)
+	if !isRowcount(left) || n.Token.Text != "0" {
+		return nil, ""
+	}
+	v := left.(*VariableRef)
+	switch op {
+	case "=":
+		return v, "not found"
+	case "<>", "!=", ">":
+		return v, "found"
+	}
+	return nil, ""
+}
+
+//error_number() = 2627 => sqlstate = '23505', 只翻译能对应上的错误号
+func sqlstateTest(expr *BinaryExpr) (*FuncCall, string) {
+	left, op, n := compareNumber(expr)
+	call, ok := left.(*FuncCall)
+	if !ok || call.funcName() != "error_number" || op != "=" && op != "<>" && op != "!=" {
+		return nil, ""
+	}
+	if code, ok := sqlstates[n.Token.Text]; ok {
+		return call, code
+	}
+	return nil, ""
+}
+
+func isRowcount(expr Expr) bool {
+	v, ok := expr.(*VariableRef)
+	return ok && strings.EqualFold(v.Token.Text, "@@rowcount")
+}
+
+func isBitwise(expr Expr) bool {
+	if e, ok := expr.(*BinaryExpr); ok {
+		op := e.Op.Text
+		return op == "&" || op == "|" || op == "^"
+	}
+	return false
+}
+
+//pgsql中位运算的操作数是二元运算, 或者二元运算的操作数是位运算时加括号
+func writeOperand(w *sqlWriter, expr Expr, bitwise bool) {
+	if _, ok := expr.(*BinaryExpr); ok && w.pg && (bitwise || isBitwise(expr)) {
+		w.write("(")
+		expr.writeSql(w)
+		w.write(")")
+		return
+	}
+	expr.writeSql(w)
+}
+
+func (expr *ParenExpr) writeSql(w *sqlWriter) {
+	w.write("(")
+	expr.Expr.writeSql(w)
+	w.write(")")
+}
+
+//pgsql中先按用户的规则翻译, 再按pgFuncs翻译内置函数
+func (expr *FuncCall) writeSql(w *sqlWriter) {
+	if translate := w.opts.ruleSet().function(expr); w.pg && translate != nil && translate(w, expr) {
+		return
+	}
+	if translate := pgFuncs[expr.funcName()]; w.pg && translate != nil && translate(w, expr) {
+		return
+	}
+	for i, v := range expr.Name {
+		if i > 0 {
+			w.write(".")
+		}
+		w.token(v)
+	}
+	expr.writeArgs(w)
+}
+
+//小写的函数名, 带schema时为空
+func (expr *FuncCall) funcName() string {
+	if len(expr.Name) != 1 {
+		return ""
+	}
+	return strings.ToLower(expr.Name[0].Text)
+}
+
+//(args) over (...)
+func (expr *FuncCall) writeArgs(w *sqlWriter) {
+	w.append("(")
+	if expr.Distinct {
+		writeKeyword(w, expr.keywords, "distinct")
+	}
+	writeExprList(w, expr.Args)
+	w.write(")")
+	if expr.Over != nil {
+		writeKeyword(w, expr.keywords, "over")
+		expr.Over.writeSql(w)
+	}
+}
+
+func (over *WindowSpec) writeSql(w *sqlWriter) {
+	w.write("(")
+	if len(over.PartitionBy) > 0 {
+		w.write("partition by")
+		writeExprList(w, over.PartitionBy)
+	}
+	if len(over.OrderBy) > 0 {
+		w.write("order by")
+		writeOrderItems(w, over.OrderBy)
+	}
+	if over.Frame != nil {
+		over.Frame.writeSql(w)
+	}
+	w.write(")")
+}
+
+func (expr *CaseExpr) writeSql(w *sqlWriter) {
+	w.write("case")
+	if expr.Operand != nil {
+		expr.Operand.writeSql(w)
+	}
+	for _, v := range expr.Whens {
+		w.write("when")
+		v.Cond.writeSql(w)
+		w.write("then")
+		v.Result.writeSql(w)
+	}
+	if expr.Else != nil {
+		w.write("else")
+		expr.Else.writeSql(w)
+	}
+	w.write("end")
+}
+
+//pgsql没有try_cast
+func (expr *Cast) writeSql(w *sqlWriter) {
+	if expr.Try && !w.pg {
+		w.write("try_cast(")
+	} else {
+		w.write("cast(")
+	}
+	expr.Expr.writeSql(w)
+	if w.pg {
+		w.write("as " + pgType(expr.Type, w.opts) + ")")
+	} else {
+		w.write("as " + expr.Type + ")")
+	}
+}
+
+func (expr *Between) writeSql(w *sqlWriter) {
+	expr.Expr.writeSql(w)
+	if expr.Not {
+		w.write("not")
+	}
+	w.write("between")
+	expr.Low.writeSql(w)
+	w.write("and")
+	expr.High.writeSql(w)
+}
+
+func (expr *InList) writeSql(w *sqlWriter) {
+	expr.Expr.writeSql(w)
+	if expr.Not {
+		w.write("not")
+	}
+	w.write("in")
+	if expr.Subquery != nil {
+		expr.Subquery.writeSql(w)
+		return
+	}
+	w.write("(")
+	writeExprList(w, expr.List)
+	w.write(")")
+}
+
+func (expr *Like) writeSql(w *sqlWriter) {
+	expr.Expr.writeSql(w)
+	if expr.Not {
+		w.write("not")
+	}
+	w.write("like")
+	expr.Pattern.writeSql(w)
+	if expr.Escape != nil {
+		w.write("escape")
+		expr.Escape.writeSql(w)
+	}
+}
+
+func (expr *IsNull) writeSql(w *sqlWriter) {
+	expr.Expr.writeSql(w)
+	if expr.Not {
+		w.write("is not null")
+	} else {
+		w.write("is null")
+	}
+}
+
+func (expr *Exists) writeSql(w *sqlWriter) {
+	w.write("exists")
+	expr.Subquery.writeSql(w)
+}
+
+func (expr *Subquery) writeSql(w *sqlWriter) {
+	w.write("(")
+	expr.Select.writeSql(w)
+	w.write(")")
+}
+
+func (expr *Collate) writeSql(w *sqlWriter) {
+	expr.Expr.writeSql(w)
+	if !w.pg {
+		w.write("collate")
+		w.token(expr.Collation)
+	}
+}
+
+func (expr *RawExpr) writeSql(w *sqlWriter) {
+	w.raw(expr.s, expr.start, expr.tokens)
+}
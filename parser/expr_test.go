@@ -0,0 +1,175 @@
+package parser
+
+import (
+	"testing"
+)
+
+func parseTestExpr(t *testing.T, s string) Expr {
+	doc := NewSqlDocument(s)
+	expr, err := parseExpr(doc)
+	if err != nil {
+		t.Fatalf("%s: %v", s, err)
+	}
+	if !doc.eof() {
+		token, _ := doc.tk.Peek()
+		t.Fatalf("%s: unexpected %q after expression", s, token)
+	}
+	return expr
+}
+
+func TestExprPrecedence(t *testing.T) {
+	cases := map[string]string{
+		"1 + 2 * 3":                    "(1 + (2 * 3))",
+		"-a * b":                       "((-a) * b)",
+		"a = 1 or b = 2 and c = 3":     "((a = 1) or ((b = 2) and (c = 3)))",
+		"not a = 1 and b = 2":          "((not (a = 1)) and (b = 2))",
+		"a & b + c":                    "((a & b) + c)",
+		"a - b - c":                    "((a - b) - c)",
+		"x between 1 and 2 and y > 0":  "((x between 1 and 2) and (y > 0))",
+		"x not like 'a%' or y is null": "((x not like 'a%') or (y is null))",
+		"a in (1, 2) and not b in (3)": "((a in (1, 2)) and (not (b in (3))))",
+		"~a | b":                       "((~a) | b)",
+		"a * (b + c)":                  "(a * ((b + c)))",
+		"a.b + dbo.f(x, y) over (partition by z)": "(a.b + dbo.f(x, y) over (partition by z))",
+	}
+	for s, expected := range cases {
+		if got := dumpExpr(parseTestExpr(t, s)); got != expected {
+			t.Errorf("%s: expected %s, got %s", s, expected, got)
+		}
+	}
+}
+
+//把二元和一元运算加上括号, 用于检查结合顺序
+func dumpExpr(expr Expr) string {
+	switch e := expr.(type) {
+	case *BinaryExpr:
+		return "(" + dumpExpr(e.Left) + " " + e.Op.Text + " " + dumpExpr(e.Right) + ")"
+	case *UnaryExpr:
+		if e.Op.Kind == TokenOperator {
+			return "(" + e.Op.Text + dumpExpr(e.Expr) + ")"
+		}
+		return "(" + e.Op.Text + " " + dumpExpr(e.Expr) + ")"
+	case *ParenExpr:
+		return "(" + dumpExpr(e.Expr) + ")"
+	case *Between, *Like, *IsNull, *InList:
+		return "(" + exprSql(expr, false) + ")"
+	}
+	return exprSql(expr, false)
+}
+
+func TestExprNodes(t *testing.T) {
+	cases := []struct {
+		s    string
+		node interface{}
+	}{
+		{"'abc'", &Literal{}},
+		{"@i", &VariableRef{}},
+		{"t.col", &ColumnRef{}},
+		{"count(distinct x)", &FuncCall{}},
+		{"case when a = 1 then 'x' else 'y' end", &CaseExpr{}},
+		{"cast(a as varchar(10))", &Cast{}},
+		{"a between 1 and 2", &Between{}},
+		{"a not in (select b from t)", &InList{}},
+		{"exists (select 1 from t)", &Exists{}},
+		{"(select max(a) from t)", &Subquery{}},
+		{"name collate Latin1_General_CI_AS", &Collate{}},
+	}
+	for _, c := range cases {
+		expr := parseTestExpr(t, c.s)
+		if got, want := typeName(expr), typeName(c.node); got != want {
+			t.Errorf("%s: expected %s, got %s", c.s, want, got)
+		}
+		if sql := exprSql(expr, false); sql != c.s {
+			t.Errorf("MsSql not round-tripped: expected %s, got %s", c.s, sql)
+		}
+	}
+}
+
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case *Literal:
+		return "Literal"
+	case *VariableRef:
+		return "VariableRef"
+	case *ColumnRef:
+		return "ColumnRef"
+	case *FuncCall:
+		return "FuncCall"
+	case *CaseExpr:
+		return "CaseExpr"
+	case *Cast:
+		return "Cast"
+	case *Between:
+		return "Between"
+	case *InList:
+		return "InList"
+	case *Exists:
+		return "Exists"
+	case *Subquery:
+		return "Subquery"
+	case *Collate:
+		return "Collate"
+	}
+	return "unknown"
+}
+
+func TestExprPgSql(t *testing.T) {
+	s := `
+declare @s varchar(10), @i int
+set @s = 'a' + @s + 'b'
+set @i = @i & 0x0F + 1
+set @i = case @i when 1 then -@i else ~@i end
+select @i = count(*), @s = max(name) from t1 where name collate Chinese_PRC_CI_AS like N'张%' and not id in (1, 2)
+`
+	doc := NewSqlDocument(s)
+	if _, err := Parse(doc); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"v_s := 'a' || v_s || 'b';",
+		"v_i := (v_i & x'0F'::int) + 1;",
+		"v_i := case v_i when 1 then -v_i else ~v_i end;",
+		"select count(*), max(name) into v_i, v_s from t1 where name like '张%' and not id in (1, 2);",
+	}
+	for i, v := range expected {
+		if sql := doc.SqlStatements[i+1].PgSql(); sql != v {
+			t.Errorf("expected:\n%s\ngot:\n%s", v, sql)
+		}
+	}
+	for s, expected := range map[string]string{
+		"select - -1, a from t": "select - -1, a from t;",
+		"select -~a, +-b":       "select - ~a, + -b;",
+	} {
+		if sql := parseOne(t, s).PgSql(); sql != expected {
+			t.Errorf("expected:\n%s\ngot:\n%s", expected, sql)
+		}
+	}
+}
+
+func TestSetValue(t *testing.T) {
+	s := `
+declare @date date
+begin
+set @date = dateadd(dd, 1, @date)
+while @date < '2019-07-16' and @date is not null
+begin
+set @date += 1
+end
+end
+`
+	doc := NewSqlDocument(s)
+	if _, err := Parse(doc); err != nil {
+		t.Fatal(err)
+	}
+	blk := doc.SqlStatements[1].(*SqlBlock)
+	if sql := blk.SqlStatements[0].MsSql(); sql != "set @date = dateadd(dd, 1, @date)" {
+		t.Errorf("wrong set: %s", sql)
+	}
+	while := blk.SqlStatements[1].(*WhileCmd)
+	if _, ok := while.Condition.(*BinaryExpr); !ok {
+		t.Errorf("wrong condition: %#v", while.Condition)
+	}
+	if sql := while.PgSql(); sql != "WHILE v_date < '2019-07-16' and v_date is not null LOOP\nv_date := v_date + 1;\nEND LOOP;" {
+		t.Errorf("wrong while: %s", sql)
+	}
+}
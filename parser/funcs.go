@@ -0,0 +1,506 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+//funcTranslator 把mssql函数调用翻译成pgsql写入w, 参数不支持时返回false, 按原样输出
+type funcTranslator func(w *sqlWriter, call *FuncCall) bool
+
+//mssql内置函数 => pgsql, key为小写的函数名, 没有列出的函数按原样输出.
+//模板中%1..%9为参数, 有多个模板时按参数个数选择
+var pgFuncs = map[string]funcTranslator{
+	//日期和时间
+	"getdate":           template("now()"),
+	"sysdatetime":       template("now()"),
+	"sysdatetimeoffset": template("now()"),
+	"getutcdate":        template("(now() at time zone 'utc')"),
+	"sysutcdatetime":    template("(now() at time zone 'utc')"),
+	"dateadd":           translateDateadd,
+	"datediff":          translateDatediff,
+	"datediff_big":      translateDatediff,
+	"datepart":          translateDatepart,
+	"datename":          translateDatename,
+	"year":              template("cast(date_part('year', %1) as int)"),
+	"month":             template("cast(date_part('month', %1) as int)"),
+	"day":               template("cast(date_part('day', %1) as int)"),
+	"eomonth":           template("cast(date_trunc('month', %1) + interval '1 month - 1 day' as date)"),
+	"datefromparts":     template("make_date(%1, %2, %3)"),
+	"isdate":            template("cast(pg_input_is_valid(%1, 'timestamp') as int)"), //pg_input_is_valid需要pgsql 16以上
+
+	//字符串
+	"len":        template("length(rtrim(%1))"),
+	"datalength": template("octet_length(%1)"),
+	"charindex": template("position(%1 in %2)",
+		"case when strpos(substr(%2, %3), %1) > 0 then strpos(substr(%2, %3), %1) + %3 - 1 else 0 end"),
+	"replicate": rename("repeat"),
+	"space":     template("repeat(' ', %1)"),
+	"stuff":     template("overlay(%1 placing %4 from %2 for %3)"),
+	"char":      rename("chr"),
+	"nchar":     rename("chr"),
+	"unicode":   rename("ascii"),
+	"quotename": template("quote_ident(%1)"),
+	"str":       template("lpad(cast(round(%1) as varchar), 10)", "lpad(cast(round(%1) as varchar), %2)"),
+	"left":      same,
+	"right":     same,
+	"substring": same,
+	"ltrim":     same,
+	"rtrim":     same,
+	"trim":      same,
+	"upper":     same,
+	"lower":     same,
+	"replace":   same,
+	"reverse":   same,
+	"ascii":     same,
+	"concat":    same,
+	"concat_ws": same,
+	"translate": same,
+
+	//空值和条件
+	"isnull":   rename("coalesce"),
+	"coalesce": same,
+	"nullif":   same,
+	"iif":      template("case when %1 then %2 else %3 end"),
+	"choose":   translateChoose,
+
+	//类型转换
+	"convert":     translateConvert,
+	"try_convert": translateConvert,
+	"isnumeric":   template(`case when cast(%1 as text) ~ '^\s*[-+]?(\d+\.?\d*|\.\d+)\s*$' then 1 else 0 end`),
+
+	//数学
+	"abs":     same,
+	"ceiling": rename("ceil"),
+	"floor":   same,
+	"round":   translateRound,
+	"power":   same,
+	"square":  template("power(%1, 2)"),
+	"sqrt":    same,
+	"exp":     same,
+	"log":     template("ln(%1)", "log(%2, %1)"),
+	"log10":   rename("log"),
+	"sign":    same,
+	"pi":      same,
+	"rand":    template("random()"),
+	"sin":     same,
+	"cos":     same,
+	"tan":     same,
+	"cot":     same,
+	"asin":    same,
+	"acos":    same,
+	"atan":    same,
+	"atn2":    rename("atan2"),
+	"degrees": same,
+	"radians": same,
+
+	//聚合和窗口
+	"count":       same,
+	"count_big":   rename("count"),
+	"sum":         same,
+	"avg":         same,
+	"min":         same,
+	"max":         same,
+	"stdev":       rename("stddev"),
+	"stdevp":      rename("stddev_pop"),
+	"var":         rename("variance"),
+	"varp":        rename("var_pop"),
+	"string_agg":  same,
+	"row_number":  same,
+	"rank":        same,
+	"dense_rank":  same,
+	"ntile":       same,
+	"lag":         same,
+	"lead":        same,
+	"first_value": same,
+	"last_value":  same,
+
+	//系统
+	"newid":           template("gen_random_uuid()"),
+	"newsequentialid": template("gen_random_uuid()"),
+	"scope_identity":  template("lastval()"),
+	"object_id":       template("to_regclass(%1)"),
+	"db_name":         template("current_database()"),
+	"user_name":       template("current_user"),
+	"suser_name":      template("current_user"),
+	"suser_sname":     template("current_user"),
+	"app_name":        template("current_setting('application_name')"),
+	"host_name":       template("cast(inet_client_addr() as varchar)"),
+	"error_message":   template("sqlerrm"),
+	"error_number":    template("sqlstate"),
+	"error_line":      template(`cast(substring(v_error_context from 'line (\d+)') as int)`),
+	"error_procedure": template(`substring(v_error_context from 'function (\S+)\(')`),
+	"error_severity":  template("16"), //pgsql没有严重级别和状态, 按raiserror常用的值翻译
+	"error_state":     template("1"),
+	"json_value":      template("(jsonb_path_query_first(cast(%1 as jsonb), cast(%2 as jsonpath)) #>> '{}')"),
+	"json_query":      template("jsonb_path_query_first(cast(%1 as jsonb), cast(%2 as jsonpath))"),
+}
+
+//返回字符串的函数, pgsql中和字符串的+要翻译成||
+var stringFuncs = map[string]bool{
+	"left": true, "right": true, "substring": true, "ltrim": true, "rtrim": true, "trim": true,
+	"upper": true, "lower": true, "replace": true, "reverse": true, "replicate": true, "space": true,
+	"stuff": true, "char": true, "nchar": true, "quotename": true, "str": true, "concat": true,
+	"concat_ws": true, "translate": true, "datename": true, "string_agg": true, "db_name": true,
+	"user_name": true, "suser_name": true, "suser_sname": true, "app_name": true, "host_name": true,
+	"error_message": true, "error_procedure": true, "json_value": true,
+}
+
+//mssql错误号 => sqlstate, 用于error_number()的比较
+var sqlstates = map[string]string{
+	"2627": "23505", //违反唯一约束
+	"2601": "23505", //违反唯一索引
+	"515":  "23502", //不能为null
+	"8134": "22012", //除以0
+	"1205": "40P01", //死锁
+	"8152": "22001", //字符串截断
+	"245":  "22P02", //类型转换失败
+}
+
+//@@全局变量 => pgsql, 没有列出的全局变量按原样输出并记录警告.
+//@@rowcount只在set @v = @@rowcount和与0比较时翻译成get diagnostics和found
+var pgGlobalVars = map[string]string{
+	"@@identity":   "lastval()",
+	"@@version":    "version()",
+	"@@spid":       "pg_backend_pid()",
+	"@@servername": "inet_server_addr()",
+	"@@language":   "current_setting('lc_messages')",
+	"@@datefirst":  "7",
+}
+
+//same 两边相同的函数
+func same(w *sqlWriter, call *FuncCall) bool {
+	return false
+}
+
+//rename 只有函数名不同
+func rename(name string) funcTranslator {
+	return func(w *sqlWriter, call *FuncCall) bool {
+		first, last := call.Name[0], call.Name[len(call.Name)-1]
+		w.leading(first)
+		w.write(name)
+		w.trailing(last)
+		call.writeArgs(w)
+		return true
+	}
+}
+
+//template 按参数个数选择模板, 不能有distinct和over
+func template(templates ...string) funcTranslator {
+	return func(w *sqlWriter, call *FuncCall) bool {
+		if call.Distinct || call.Over != nil {
+			return false
+		}
+		for _, t := range templates {
+			if templateArgs(t) == len(call.Args) {
+				writeTemplate(w, t, call.Args)
+				return true
+			}
+		}
+		return false
+	}
+}
+
+//模板中参数的个数
+func templateArgs(t string) int {
+	n := 0
+	for i := 0; i+1 < len(t); i++ {
+		if t[i] == '%' && isDigit(t[i+1]) && int(t[i+1]-'0') > n {
+			n = int(t[i+1] - '0')
+		}
+	}
+	return n
+}
+
+//按模板写入, 参数两边是运算符时给二元运算加括号, 重复的参数不再输出注释
+func writeTemplate(w *sqlWriter, t string, args []Expr) {
+	written := make([]bool, len(args))
+	pos := 0
+	for pos < len(t) {
+		end := pos
+		for end < len(t) && !(t[end] == '%' && end+1 < len(t) && isDigit(t[end+1])) {
+			end++
+		}
+		if piece := t[pos:end]; piece != "" {
+			if pos == 0 || piece[0] == ' ' {
+				w.write(strings.TrimLeft(piece, " "))
+			} else {
+				w.append(piece)
+			}
+		}
+		if end == len(t) {
+			break
+		}
+		i := int(t[end+1] - '1')
+		arg := args[i]
+		before := strings.TrimRight(t[:end], " ")
+		after := strings.TrimLeft(t[end+2:], " ")
+		_, binary := arg.(*BinaryExpr)
+		paren := binary && (before != "" && strings.ContainsAny(before[len(before)-1:], "+-*/%|:") ||
+			after != "" && strings.ContainsAny(after[:1], "+-*/%|:"))
+		f := func() {
+			if paren {
+				w.write("(")
+				arg.writeSql(w)
+				w.write(")")
+			} else {
+				arg.writeSql(w)
+			}
+		}
+		if written[i] {
+			w.quietly(f)
+		} else {
+			f()
+		}
+		written[i] = true
+		pos = end + 2
+	}
+}
+
+//日期部分的缩写 => 全称
+var dateParts = map[string]string{
+	"year": "year", "yy": "year", "yyyy": "year",
+	"quarter": "quarter", "qq": "quarter", "q": "quarter",
+	"month": "month", "mm": "month", "m": "month",
+	"dayofyear": "dayofyear", "dy": "dayofyear", "y": "dayofyear",
+	"day": "day", "dd": "day", "d": "day",
+	"week": "week", "wk": "week", "ww": "week",
+	"weekday": "weekday", "dw": "weekday", "w": "weekday",
+	"hour": "hour", "hh": "hour",
+	"minute": "minute", "mi": "minute", "n": "minute",
+	"second": "second", "ss": "second", "s": "second",
+	"millisecond": "millisecond", "ms": "millisecond",
+	"microsecond": "microsecond", "mcs": "microsecond",
+}
+
+//dateadd(dd, 1, x)中的dd
+func datePart(expr Expr) string {
+	if col, ok := expr.(*ColumnRef); ok && len(col.Parts) == 1 {
+		return dateParts[strings.ToLower(identValue(col.Parts[0].Text))]
+	}
+	return ""
+}
+
+//整数常量, -1也算
+func intLiteral(expr Expr) (int, bool) {
+	sign := 1
+	if unary, ok := expr.(*UnaryExpr); ok && unary.Op.Text == "-" {
+		sign = -1
+		expr = unary.Expr
+	}
+	lit, ok := expr.(*Literal)
+	if !ok || lit.Token.Kind != TokenNumber {
+		return 0, false
+	}
+	var n int
+	if _, err := fmt.Sscanf(lit.Token.Text, "%d", &n); err != nil || fmt.Sprint(n) != lit.Token.Text {
+		return 0, false
+	}
+	return sign * n, true
+}
+
+//indexes中的参数为日期, 字符串常量转成timestamp, 否则pgsql无法确定date_part等函数的参数类型.
+//mssql中日期0为1900-01-01
+func dateArgs(args []Expr, indexes ...int) []Expr {
+	result := append([]Expr{}, args...)
+	for _, i := range indexes {
+		lit, ok := args[i].(*Literal)
+		switch {
+		case !ok:
+		case lit.Token.Kind == TokenString:
+			result[i] = &Cast{Expr: lit, Type: "datetime"}
+		case lit.Token.Text == "0":
+			result[i] = &Cast{Expr: &Literal{Token{Kind: TokenString, Text: "'1900-01-01'"}}, Type: "datetime"}
+		}
+	}
+	return result
+}
+
+//dateadd(dd, 1, x) => x + interval '1 day', dateadd(dd, n, x) => x + n * interval '1 day'
+func translateDateadd(w *sqlWriter, call *FuncCall) bool {
+	if len(call.Args) != 3 {
+		return false
+	}
+	unit, factor := datePart(call.Args[0]), 1
+	switch unit {
+	case "":
+		return false
+	case "quarter":
+		unit, factor = "month", 3
+	case "dayofyear", "weekday":
+		unit = "day"
+	}
+	args := dateArgs(call.Args, 2)
+	if n, ok := intLiteral(call.Args[1]); ok {
+		writeTemplate(w, fmt.Sprintf("%%3 + interval '%d %s'", n*factor, unit), args)
+	} else {
+		writeTemplate(w, fmt.Sprintf("%%3 + %%2 * interval '%d %s'", factor, unit), args)
+	}
+	return true
+}
+
+//datediff计算跨过的边界数, 先截断再相减
+var datediffTemplates = map[string]string{
+	"year":        "cast(date_part('year', %3) - date_part('year', %2) as int)",
+	"quarter":     "cast((date_part('year', %3) - date_part('year', %2)) * 4 + date_part('quarter', %3) - date_part('quarter', %2) as int)",
+	"month":       "cast((date_part('year', %3) - date_part('year', %2)) * 12 + date_part('month', %3) - date_part('month', %2) as int)",
+	"dayofyear":   "(cast(%3 as date) - cast(%2 as date))",
+	"day":         "(cast(%3 as date) - cast(%2 as date))",
+	"weekday":     "(cast(%3 as date) - cast(%2 as date))",
+	"week":        "((cast(date_trunc('week', %3) as date) - cast(date_trunc('week', %2) as date)) / 7)",
+	"hour":        "cast(extract(epoch from date_trunc('hour', %3) - date_trunc('hour', %2)) / 3600 as int)",
+	"minute":      "cast(extract(epoch from date_trunc('minute', %3) - date_trunc('minute', %2)) / 60 as int)",
+	"second":      "cast(extract(epoch from date_trunc('second', %3) - date_trunc('second', %2)) as int)",
+	"millisecond": "cast(extract(epoch from date_trunc('milliseconds', %3) - date_trunc('milliseconds', %2)) * 1000 as bigint)",
+	"microsecond": "cast(extract(epoch from %3 - %2) * 1000000 as bigint)",
+}
+
+func translateDatediff(w *sqlWriter, call *FuncCall) bool {
+	if len(call.Args) != 3 {
+		return false
+	}
+	t, ok := datediffTemplates[datePart(call.Args[0])]
+	if !ok {
+		return false
+	}
+	writeTemplate(w, t, dateArgs(call.Args, 1, 2))
+	return true
+}
+
+//datepart => date_part, pgsql中的名字
+var pgDateParts = map[string]string{
+	"year": "year", "quarter": "quarter", "month": "month", "dayofyear": "doy", "day": "day",
+	"week": "week", "hour": "hour", "minute": "minute", "second": "second",
+	"millisecond": "milliseconds", "microsecond": "microseconds",
+}
+
+func translateDatepart(w *sqlWriter, call *FuncCall) bool {
+	if len(call.Args) != 2 {
+		return false
+	}
+	var t string
+	switch part := datePart(call.Args[0]); part {
+	case "":
+		return false
+	case "weekday": //mssql默认星期日为1
+		t = "(cast(date_part('dow', %2) as int) + 1)"
+	case "millisecond", "microsecond":
+		t = fmt.Sprintf("(cast(date_part('%s', %%2) as int) %% 1000)", pgDateParts[part])
+	default:
+		t = fmt.Sprintf("cast(date_part('%s', %%2) as int)", pgDateParts[part])
+	}
+	writeTemplate(w, t, dateArgs(call.Args, 1))
+	return true
+}
+
+func translateDatename(w *sqlWriter, call *FuncCall) bool {
+	if len(call.Args) != 2 {
+		return false
+	}
+	var t string
+	switch part := datePart(call.Args[0]); part {
+	case "":
+		return false
+	case "month":
+		t = "trim(to_char(%2, 'Month'))"
+	case "weekday":
+		t = "trim(to_char(%2, 'Day'))"
+	default:
+		t = fmt.Sprintf("cast(cast(date_part('%s', %%2) as int) as varchar)", pgDateParts[part])
+	}
+	writeTemplate(w, t, dateArgs(call.Args, 1))
+	return true
+}
+
+//choose(i, a, b, ...) => case i when 1 then a when 2 then b ... end
+func translateChoose(w *sqlWriter, call *FuncCall) bool {
+	if len(call.Args) < 2 || len(call.Args) > 9 {
+		return false
+	}
+	t := "case %1"
+	for i := 2; i <= len(call.Args); i++ {
+		t += fmt.Sprintf(" when %d then %%%d", i-1, i)
+	}
+	writeTemplate(w, t+" end", call.Args)
+	return true
+}
+
+//round(x, n, f)中f不为0时截断
+func translateRound(w *sqlWriter, call *FuncCall) bool {
+	if len(call.Args) != 3 {
+		return false
+	}
+	t := "case when %3 = 0 then round(%1, %2) else trunc(%1, %2) end"
+	if f, ok := intLiteral(call.Args[2]); ok && f == 0 {
+		t = "round(%1, %2)"
+	} else if ok {
+		t = "trunc(%1, %2)"
+	}
+	writeTemplate(w, t, call.Args)
+	return true
+}
+
+//convert的样式 => to_char的格式
+var convertStyles = map[string]string{
+	"1": "MM/DD/YY", "101": "MM/DD/YYYY",
+	"2": "YY.MM.DD", "102": "YYYY.MM.DD",
+	"3": "DD/MM/YY", "103": "DD/MM/YYYY",
+	"4": "DD.MM.YY", "104": "DD.MM.YYYY",
+	"5": "DD-MM-YY", "105": "DD-MM-YYYY",
+	"8": "HH24:MI:SS", "108": "HH24:MI:SS",
+	"10": "MM-DD-YY", "110": "MM-DD-YYYY",
+	"11": "YY/MM/DD", "111": "YYYY/MM/DD",
+	"12": "YYMMDD", "112": "YYYYMMDD",
+	"20": "YYYY-MM-DD HH24:MI:SS", "120": "YYYY-MM-DD HH24:MI:SS",
+	"21": "YYYY-MM-DD HH24:MI:SS.MS", "121": "YYYY-MM-DD HH24:MI:SS.MS",
+	"23": "YYYY-MM-DD", "126": `YYYY-MM-DD"T"HH24:MI:SS.MS`,
+}
+
+//convert(type, x) => cast(x as type), 转成字符串并且有样式时用to_char
+func translateConvert(w *sqlWriter, call *FuncCall) bool {
+	if len(call.Args) != 2 && len(call.Args) != 3 {
+		return false
+	}
+	typ := exprType(call.Args[0])
+	if typ == "" {
+		return false
+	}
+	typ = pgType(typ, w.opts)
+	if len(call.Args) == 3 && isStringType(typ) {
+		if lit, ok := call.Args[2].(*Literal); ok {
+			if format, ok := convertStyles[lit.Token.Text]; ok {
+				writeTemplate(w, "cast(to_char(%2, '"+format+"') as "+typ+")", dateArgs(call.Args, 1))
+				return true
+			}
+		}
+	}
+	writeTemplate(w, "cast(%2 as "+typ+")", call.Args)
+	return true
+}
+
+//convert的第一个参数按表达式解析, 还原成类型: int, varchar(10), decimal(18, 2)
+func exprType(expr Expr) string {
+	switch e := expr.(type) {
+	case *ColumnRef:
+		if len(e.Parts) == 1 {
+			return e.Parts[0].Text
+		}
+	case *FuncCall:
+		if len(e.Name) != 1 || e.Over != nil || e.Distinct {
+			return ""
+		}
+		var args []string
+		for _, v := range e.Args {
+			switch arg := v.(type) {
+			case *Literal:
+				args = append(args, arg.Token.Text)
+			case *ColumnRef: //max
+				args = append(args, arg.Parts[0].Text)
+			default:
+				return ""
+			}
+		}
+		return e.Name[0].Text + "(" + strings.Join(args, ", ") + ")"
+	}
+	return ""
+}
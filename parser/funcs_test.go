@@ -0,0 +1,185 @@
+package parser
+
+import (
+	"testing"
+)
+
+func TestPgFuncs(t *testing.T) {
+	cases := map[string]string{
+		"getdate()":                      "now()",
+		"GETDATE()":                      "now()",
+		"sysdatetime()":                  "now()",
+		"getutcdate()":                   "(now() at time zone 'utc')",
+		"dateadd(dd, 1, @date)":          "v_date + interval '1 day'",
+		"dateadd(month, -2, d)":          "d + interval '-2 month'",
+		"dateadd(qq, 1, d)":              "d + interval '3 month'",
+		"dateadd(hh, @n + 1, d)":         "d + (v_n + 1) * interval '1 hour'",
+		"datediff(dd, '2019-01-01', @d)": "(cast(v_d as date) - cast(cast('2019-01-01' as timestamp) as date))",
+		"datediff(month, a, b)":          "cast((date_part('year', b) - date_part('year', a)) * 12 + date_part('month', b) - date_part('month', a) as int)",
+		"datediff(year, a, b)":           "cast(date_part('year', b) - date_part('year', a) as int)",
+		"datediff(hour, a, b)":           "cast(extract(epoch from date_trunc('hour', b) - date_trunc('hour', a)) / 3600 as int)",
+		"datediff(week, a, b)":           "((cast(date_trunc('week', b) as date) - cast(date_trunc('week', a) as date)) / 7)",
+		"datepart(dw, d)":                "(cast(date_part('dow', d) as int) + 1)",
+		"datepart(yyyy, d)":              "cast(date_part('year', d) as int)",
+		"datepart(ms, d)":                "(cast(date_part('milliseconds', d) as int) % 1000)",
+		"datename(month, d)":             "trim(to_char(d, 'Month'))",
+		"datename(dd, d)":                "cast(cast(date_part('day', d) as int) as varchar)",
+		"year(d)":                        "cast(date_part('year', d) as int)",
+		"month(d)":                       "cast(date_part('month', d) as int)",
+		"day(getdate())":                 "cast(date_part('day', now()) as int)",
+		"eomonth(d)":                     "cast(date_trunc('month', d) + interval '1 month - 1 day' as date)",
+		"datefromparts(2019, 1, 2)":      "make_date(2019, 1, 2)",
+		"isdate(s)":                      "cast(pg_input_is_valid(s, 'timestamp') as int)",
+		"len(s)":                         "length(rtrim(s))",
+		"datalength(s)":                  "octet_length(s)",
+		"charindex('a', s)":              "position('a' in s)",
+		"charindex('a', s, 2)":           "case when strpos(substr(s, 2), 'a') > 0 then strpos(substr(s, 2), 'a') + 2 - 1 else 0 end",
+		"replicate('ab', 3)":             "repeat('ab', 3)",
+		"space(2)":                       "repeat(' ', 2)",
+		"stuff(s, 1, 2, 'x')":            "overlay(s placing 'x' from 1 for 2)",
+		"char(65)":                       "chr(65)",
+		"unicode(s)":                     "ascii(s)",
+		"quotename(s)":                   "quote_ident(s)",
+		"str(x, 5)":                      "lpad(cast(round(x) as varchar), 5)",
+		"left(s, 2)":                     "left(s, 2)",
+		"isnull(a, 0)":                   "coalesce(a, 0)",
+		"isnull(s, '') + 'x'":            "coalesce(s, '') || 'x'",
+		"upper(s) + @s":                  "upper(s) || v_s",
+		"iif(a > 1, 'y', 'n')":           "case when a > 1 then 'y' else 'n' end",
+		"choose(i, 'a', 'b', 'c')":       "case i when 1 then 'a' when 2 then 'b' when 3 then 'c' end",
+		"nullif(a, 0)":                   "nullif(a, 0)",
+		"convert(int, s)":                "cast(s as int)",
+		"convert(varchar(10), d, 120)":   "cast(to_char(d, 'YYYY-MM-DD HH24:MI:SS') as varchar(10))",
+		"try_convert(decimal(18, 2), s)": "cast(s as decimal(18, 2))",
+		"isnumeric(s)":                   `case when cast(s as text) ~ '^\s*[-+]?(\d+\.?\d*|\.\d+)\s*$' then 1 else 0 end`,
+		"ceiling(x)":                     "ceil(x)",
+		"round(x, 2)":                    "round(x, 2)",
+		"round(x, 2, 1)":                 "trunc(x, 2)",
+		"round(x, 2, @f)":                "case when v_f = 0 then round(x, 2) else trunc(x, 2) end",
+		"square(a + 1)":                  "power(a + 1, 2)",
+		"log(x)":                         "ln(x)",
+		"log(x, 2)":                      "log(2, x)",
+		"log10(x)":                       "log(x)",
+		"rand()":                         "random()",
+		"atn2(y, x)":                     "atan2(y, x)",
+		"count_big(distinct a)":          "count(distinct a)",
+		"stdev(a) over (partition by b)": "stddev(a) over (partition by b)",
+		"stdevp(a)":                      "stddev_pop(a)",
+		"var(a)":                         "variance(a)",
+		"varp(a)":                        "var_pop(a)",
+		"newid()":                        "gen_random_uuid()",
+		"scope_identity()":               "lastval()",
+		"@@identity":                     "lastval()",
+		"@@spid":                         "pg_backend_pid()",
+		"object_id('dbo.t')":             "to_regclass('dbo.t')",
+		"db_name()":                      "current_database()",
+		"suser_sname()":                  "current_user",
+		"app_name()":                     "current_setting('application_name')",
+		"error_message()":                "sqlerrm",
+		"error_number()":                 "sqlstate",
+		"error_line()":                   `cast(substring(v_error_context from 'line (\d+)') as int)`,
+		"error_severity()":               "16",
+		"error_state()":                  "1",
+		"xact_state()":                   "xact_state()",
+		"json_value(j, '$.a')":           "(jsonb_path_query_first(cast(j as jsonb), cast('$.a' as jsonpath)) #>> '{}')",
+		"dbo.len(s)":                     "dbo.len(s)",
+		"len(/*c*/ s)":                   "length(rtrim(/*c*/ s))",
+		"dateadd(dd)":                    "dateadd(dd)",
+	}
+	for s, expected := range cases {
+		if sql := exprSql(parseTestExpr(t, s), true); sql != expected {
+			t.Errorf("%s\nexpected:\n%s\ngot:\n%s", s, expected, sql)
+		}
+	}
+}
+
+func TestPgFuncsStatement(t *testing.T) {
+	s := `declare @d datetime
+set @d = dateadd(dd, datediff(dd, 0, getdate()), 0)
+select isnull(max(id), 0) + 1, convert(varchar(8), getdate(), 112) from t1 where datepart(yy, created) = year(@d)`
+	doc := NewSqlDocument(s)
+	if _, err := Parse(doc); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"v_d := cast('1900-01-01' as timestamp) + (cast(now() as date) - cast(cast('1900-01-01' as timestamp) as date)) * interval '1 day';",
+		"select coalesce(max(id), 0) + 1, cast(to_char(now(), 'YYYYMMDD') as varchar(8)) from t1 where cast(date_part('year', created) as int) = cast(date_part('year', v_d) as int);",
+	}
+	for i, v := range expected {
+		if sql := doc.SqlStatements[i+1].PgSql(); sql != v {
+			t.Errorf("expected:\n%s\ngot:\n%s", v, sql)
+		}
+	}
+}
+
+func TestGlobalVars(t *testing.T) {
+	s := `declare @n int
+update t set a = 1
+set @n = @@rowcount
+if @@rowcount = 0 set @n = 1
+if 0 < @@ROWCOUNT set @n = 2
+if @@error <> 0 set @n = @@trancount`
+	doc := NewSqlDocument(s)
+	if _, err := Parse(doc); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"GET DIAGNOSTICS v_n = ROW_COUNT;",
+		"IF not found THEN\nv_n := 1;\nEND IF;",
+		"IF found THEN\nv_n := 2;\nEND IF;",
+		"IF @@error <> 0 THEN\nv_n := @@trancount;\nEND IF;",
+	}
+	for i, v := range expected {
+		if sql := doc.SqlStatements[i+2].PgSql(); sql != v {
+			t.Errorf("expected:\n%s\ngot:\n%s", v, sql)
+		}
+	}
+	if len(doc.Warnings) != 2 {
+		t.Fatalf("expected 2 warnings, got %v", doc.Warnings)
+	}
+}
+
+func TestErrorNumber(t *testing.T) {
+	s := `begin try set @n = 1 end try
+begin catch
+if error_number() = 2627 set @n = 2
+if 1205 <> ERROR_NUMBER() set @n = 3
+if error_number() = 50000 set @n = 4
+end catch`
+	doc := NewSqlDocument("declare @n int\n" + s)
+	if _, err := Parse(doc); err != nil {
+		t.Fatal(err)
+	}
+	expected := `BEGIN
+v_n := 1;
+EXCEPTION WHEN OTHERS THEN
+IF sqlstate = '23505' THEN
+v_n := 2;
+END IF;
+IF '40P01' <> sqlstate THEN
+v_n := 3;
+END IF;
+IF sqlstate = 50000 THEN
+v_n := 4;
+END IF;
+END;`
+	if sql := doc.SqlStatements[1].PgSql(); sql != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, sql)
+	}
+	if len(doc.Warnings) != 1 || doc.Warnings[0].Line != 6 {
+		t.Fatalf("unexpected warnings %v", doc.Warnings)
+	}
+}
+
+func TestErrorSeverity(t *testing.T) {
+	doc := NewSqlDocument("select error_message(), error_severity(), error_state()")
+	if _, err := Parse(doc); err != nil {
+		t.Fatal(err)
+	}
+	if sql := doc.PgSql(); sql != "select sqlerrm, 16, 1;" {
+		t.Errorf("got %s", sql)
+	}
+	if len(doc.Warnings) != 2 || doc.Warnings[0].Message != "error_severity() has no equivalent in pgsql, translated to 16" {
+		t.Errorf("unexpected warnings %v", doc.Warnings)
+	}
+}
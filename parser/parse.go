@@ -2,7 +2,7 @@ package parser
 
 import (
 	"fmt"
-	"github.com/huandu/go-clone"
+	"strconv"
 	"strings"
 )
 
@@ -11,441 +11,654 @@ type SqlStatement interface {
 	MsSql() string
 }
 
+//Span 语句在源语句中的范围
+type Span struct {
+	Start Token    //第一个token
+	End   Token    //最后一个token
+	opts  *options //解析时文档的翻译选项
+}
+
+func (s *Span) Source() Span {
+	return *s
+}
+
+func (s *Span) setSpan(span Span) {
+	*s = span
+}
+
 type SqlDocument struct {
-	SqlStatements []SqlStatement
-	SqlVars       []SqlVar
-	tk            *Tokener
-	next          int
+	SqlStatements  []SqlStatement //所有批处理中的语句
+	SqlVars        []SqlVar       //当前批处理中的变量
+	Batches        []*SqlBatch    //按GO分隔的批处理
+	Recover        bool           //出错后跳到下一条语句继续解析
+	Errors         ParseErrors    //恢复模式下收集到的错误
+	Warnings       []*Warning     //翻译时丢弃的内容
+	Rules          *RuleSet       //用户定义的翻译规则, 为nil时只使用内置的翻译. 在Parse之前设置
+	IdentifierCase CasePolicy     //转换[Name]和"Name"时使用的大小写策略. 在Parse之前设置
+	ClusterIndexes bool           //为true时clustered索引翻译后加上cluster table using index, 按索引重排表中的数据. 在Parse之前设置
+	tk             *Tokener
+	opts           *options                //Parse时从Rules, IdentifierCase和ClusterIndexes复制
+	batch          *SqlBatch               //正在解析的批处理
+	blocks         []*SqlBlock             //正在解析的begin ... end, 用于查找变量
+	comments       []Token                 //文档末尾的注释
+	columns        map[string][]*ColumnDef //create table和alter table add的列, 表名 => 列
+	identityOn     map[string]bool         //set identity_insert on的表
+	scope          []*TableName            //正在解析的语句from中的表, 用于查找比较的列的类型
+	defaults       map[string]Token        //表名.default约束名 => 列名, drop constraint时翻译为alter column drop default
+	procedural     bool                    //当前批处理已经有需要DO块的语句, 之后的语句都在DO块中
+	routine        *CreateFunctionStmt     //正在解析的函数, 用于翻译return和insert into @t
+	loops          []*WhileCmd             //正在解析的while, 用于break和continue
+	catches        []*TryCatchCmd          //正在解析的catch块, 用于声明get stacked diagnostics的变量
 }
 
 func NewSqlDocument(s string) *SqlDocument {
 	return &SqlDocument{tk: NewTokener([]byte(s))}
 }
 
+//带翻译选项的范围
+func (doc *SqlDocument) span(start, end Token) Span {
+	return Span{Start: start, End: end, opts: doc.opts}
+}
+
 func (doc *SqlDocument) eof() bool {
-	return doc.tk.pos == len(doc.tk.statement)
+	token, err := doc.tk.Peek()
+	return token == "" && err == nil
 }
 
+//每个批处理单独翻译, 变量只在批处理内有效
 func (doc *SqlDocument) PgSql() string {
-	var s string
-	for _, v := range doc.SqlStatements {
-		s += v.PgSql()
+	var a []string
+	for _, v := range doc.Batches {
+		if s := v.PgSql(); s != "" {
+			a = append(a, s)
+		}
 	}
-	return fmt.Sprintf("DO $$\n%s\nEND $$;", s)
+	return strings.Join(a, "\n")
 }
 
 func (doc *SqlDocument) MsSql() string {
-	var s string
-	for _, v := range doc.SqlStatements {
-		s += v.MsSql()
+	var a []string
+	for _, v := range doc.Batches {
+		if s := v.MsSql(); s != "" {
+			a = append(a, s)
+		}
 	}
-	return s
+	return strings.Join(a, "\n")
+}
+
+//返回[start, end)之间的原始语句
+func (doc *SqlDocument) text(start, end int) string {
+	return strings.TrimSpace(string(doc.tk.slice(start, end)))
+}
+
+func (doc *SqlDocument) parseError(expected ...string) error {
+	return doc.tk.newParseError(expected...)
 }
 
 func (doc *SqlDocument) addSqlStatement(sqlStatement SqlStatement) {
+	if doc.batch == nil {
+		doc.batch = &SqlBatch{}
+	}
 	doc.SqlStatements = append(doc.SqlStatements, sqlStatement)
+	doc.batch.SqlStatements = append(doc.batch.SqlStatements, sqlStatement)
 }
 
-func (doc *SqlDocument) setVarValue(name, value string) bool {
-	for _, v := range doc.SqlVars {
-		if v.name == name {
-			v.value = value
-			return true
+//结束当前批处理, cmd为nil时表示已到结尾
+func (doc *SqlDocument) endBatch(cmd *GoCmd, comments []Token) {
+	batch := doc.batch
+	if batch == nil {
+		batch = &SqlBatch{}
+	}
+	batch.SqlVars = doc.SqlVars
+	batch.Go = cmd
+	batch.comments = comments
+	if cmd != nil || len(batch.SqlStatements) > 0 || len(comments) > 0 || len(doc.Batches) == 0 {
+		doc.Batches = append(doc.Batches, batch)
+	}
+	doc.batch = nil
+	doc.SqlVars = nil
+	doc.procedural = false
+}
+
+//批处理中第一条需要plpgsql执行的语句之后的语句都在DO块中, DO块中的select不能返回结果集
+func (doc *SqlDocument) checkResultSets(sqlStatement SqlStatement) {
+	if !doc.procedural && !isProcedural([]SqlStatement{sqlStatement}) {
+		return
+	}
+	doc.procedural = true
+	for _, v := range resultSets([]SqlStatement{sqlStatement}, nil) {
+		doc.warn(v.Span.Start, "select in a DO block cannot return a result set, the select has no destination")
+	}
+}
+
+//语句中返回结果集的select, 包括begin ... end, if和while里面的
+func resultSets(sqlStatements []SqlStatement, sels []*SelectStmt) []*SelectStmt {
+	for _, v := range sqlStatements {
+		switch v := v.(type) {
+		case *SelectStmt:
+			if isResultSet(v) {
+				sels = append(sels, v)
+			}
+		case *SqlBlock:
+			sels = resultSets(v.SqlStatements, sels)
+		case *IfCmd:
+			sels = resultSets([]SqlStatement{v.Then}, sels)
+			if v.Else != nil {
+				sels = resultSets([]SqlStatement{v.Else}, sels)
+			}
+		case *WhileCmd:
+			sels = resultSets([]SqlStatement{v.SqlBlock}, sels)
+		case *TryCatchCmd:
+			sels = resultSets([]SqlStatement{v.Try, v.Catch}, sels)
 		}
 	}
-	return false
+	return sels
+}
+
+//从里到外查找变量
+func (doc *SqlDocument) findVar(name string) *SqlVar {
+	for i := len(doc.blocks) - 1; i >= 0; i-- {
+		if v := findVar(doc.blocks[i].SqlVars, name); v != nil {
+			return v
+		}
+	}
+	return findVar(doc.SqlVars, name)
 }
 
 type SqlBlock struct {
+	Span
 	SqlStatements []SqlStatement
 	SqlVars       []SqlVar
 }
 
 func (blk *SqlBlock) PgSql() string {
+	return fmt.Sprintf("BEGIN\n%s\nEND;", blk.body(true))
+}
+
+func (blk *SqlBlock) MsSql() string {
+	return blk.body(false)
+}
+
+//块内的语句, 包括END前的注释
+func (blk *SqlBlock) body(pg bool) string {
 	var s string
-	for _, v := range blk.SqlStatements {
-		s += v.PgSql()
+	if pg {
+		s = pgSqlList(blk.SqlStatements)
+	} else {
+		s = msSqlList(blk.SqlStatements)
 	}
-	return fmt.Sprintf("BEGIN%s\nEND\n", s)
+	s += commentLines(blk.End.Leading)
+	return strings.TrimSuffix(s, "\n")
 }
 
-func (blk *SqlBlock) MsSql() string {
+func pgSqlList(sqlStatements []SqlStatement) string {
 	var s string
-	for _, v := range blk.SqlStatements {
-		s += v.MsSql()
+	for _, v := range sqlStatements {
+		if sql := v.PgSql(); sql != "" { //变量声明连同注释移到了declare部分
+			s += withComments(v, sql) + "\n"
+		}
 	}
 	return s
 }
 
-func (blk *SqlBlock) addSqlStatement(sqlStatement SqlStatement) {
-	blk.SqlStatements = append(blk.SqlStatements, sqlStatement)
+func msSqlList(sqlStatements []SqlStatement) string {
+	var s string
+	for _, v := range sqlStatements {
+		s += withComments(v, v.MsSql()) + "\n"
+	}
+	return s
 }
 
-func (blk *SqlBlock) setVarValue(name, value string) bool {
-	for _, v := range blk.SqlVars {
-		if v.name == name {
-			v.value = value
-			return true
-		}
+//在语句前后加上源语句中的注释
+func withComments(sqlStatement SqlStatement, s string) string {
+	node, ok := sqlStatement.(interface{ Source() Span })
+	if !ok {
+		return s
 	}
-	return false
+	span := node.Source()
+	s = commentLines(span.Start.Leading) + s
+	for _, v := range span.End.Trailing {
+		s += " " + v.Text
+	}
+	return s
+}
+
+func commentLines(comments []Token) string {
+	var s string
+	for _, v := range comments {
+		s += v.Text + "\n"
+	}
+	return s
+}
+
+func (blk *SqlBlock) addSqlStatement(sqlStatement SqlStatement) {
+	blk.SqlStatements = append(blk.SqlStatements, sqlStatement)
 }
 
+//Recover为true时, 出错的语句会记录为UnparsedStatement并继续解析,
+//此时Parse返回文档本身以及所有错误组成的ParseErrors
 func Parse(doc *SqlDocument) (SqlStatement, error) {
+	doc.opts = newOptions(doc.Rules, doc.IdentifierCase, doc.ClusterIndexes)
 	for {
-		if isInsertIntoValues(doc) {
-			sqlStatement, _ := parseInsertIntoValues(doc)
-			doc.addSqlStatement(sqlStatement)
-			continue
-		}
-		if isInsertIntoSelect(doc) {
-			sqlStatement, _ := parseInsertIntoSelect(doc)
-			doc.addSqlStatement(sqlStatement)
-			continue
-		}
-		if isSelectInto(doc) {
-			sqlStatement, _ := parseSelectInto(doc)
-			doc.addSqlStatement(sqlStatement)
-			continue
-		}
-		if isSelect(doc) {
-			sqlStatement, _ := parseSelect(doc)
-			doc.addSqlStatement(sqlStatement)
-			continue
-		}
-		if isDeclare(doc) {
-			sqlStatement, _ := parseDeclareDoc(doc)
-			doc.addSqlStatement(sqlStatement)
-			continue
-		}
-		if isSet(doc) {
-			sqlStatement, _ := parseSetDoc(doc)
-			doc.addSqlStatement(sqlStatement)
-			continue
-		}
-		if isWhile(doc) {
-			sqlStatement, _ := parseWhile(doc)
-			doc.addSqlStatement(sqlStatement)
-			continue
-		}
-		token, _ := doc.tk.Peek()
-		if strings.EqualFold(token, "begin") {
-			doc.tk.Pop()
-			sqlStatement, _ := parseSqlBlock(doc, &SqlBlock{})
-			doc.addSqlStatement(sqlStatement)
-			continue
+		for !doc.eof() {
+			start, _ := doc.tk.PeekToken()
+			sqlStatement, err := parseStatement(doc, nil)
+			if err != nil {
+				sqlStatement, err = doc.recover(start, err)
+				if err != nil {
+					return nil, err
+				}
+			}
+			if sqlStatement != nil {
+				doc.checkResultSets(sqlStatement)
+				doc.addSqlStatement(sqlStatement)
+			}
 		}
-		if doc.eof() {
+		token, _ := doc.tk.PeekToken()
+		if token.Kind != TokenGo {
+			doc.comments = token.Leading
+			doc.endBatch(nil, token.Leading)
 			break
 		}
-		doc.tk.Peek()
-		doc.tk.Pop()
+		doc.endBatch(parseGo(doc), token.Leading)
+	}
+	if len(doc.Errors) > 0 {
+		return doc, doc.Errors
 	}
 	return doc, nil
 }
 
 func parseSqlBlock(doc *SqlDocument, blk *SqlBlock) (SqlStatement, error) {
+	begin := doc.tk.lastToken()
+	doc.blocks = append(doc.blocks, blk)
+	defer func() { doc.blocks = doc.blocks[:len(doc.blocks)-1] }()
 	for {
-		if isInsertIntoValues(doc) {
-			sqlStatement, _ := parseInsertIntoValues(doc)
-			blk.addSqlStatement(sqlStatement)
-			continue
-		}
-		if isInsertIntoSelect(doc) {
-			sqlStatement, _ := parseInsertIntoSelect(doc)
-			blk.addSqlStatement(sqlStatement)
-			continue
-		}
-		if isSelectInto(doc) {
-			sqlStatement, _ := parseSelectInto(doc)
-			blk.addSqlStatement(sqlStatement)
-			continue
-		}
-		if isSelect(doc) {
-			sqlStatement, _ := parseSelect(doc)
-			blk.addSqlStatement(sqlStatement)
-			continue
-		}
-		if isDeclare(doc) {
-			sqlStatement, _ := parseDeclareBlk(doc, blk)
-			blk.addSqlStatement(sqlStatement)
-			continue
-		}
-		if isSet(doc) {
-			sqlStatement, _ := parseSetBlk(doc, blk)
-			blk.addSqlStatement(sqlStatement)
-			continue
-		}
-		if doc.eof() {
-			break
+		token, err := doc.tk.Peek()
+		if err != nil || token == "" {
+			return nil, doc.parseError("end")
 		}
-		tmp := &SqlBlock{}
-		token, _ := doc.tk.Peek()
 		if strings.EqualFold(token, "end") {
 			doc.tk.Pop()
-			tmp.addSqlStatement(blk)
+			blk.Span = doc.span(begin, doc.tk.lastToken())
 			break
 		}
-		if strings.EqualFold(token, "begin") {
-			doc.tk.Pop()
-			sqlStatement, _ := parseSqlBlock(doc, tmp)
+		start, _ := doc.tk.PeekToken()
+		sqlStatement, err := parseStatement(doc, blk)
+		if err != nil {
+			sqlStatement, err = doc.recover(start, err)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if sqlStatement != nil {
 			blk.addSqlStatement(sqlStatement)
-			continue
 		}
-		doc.tk.Peek()
-		doc.tk.Pop()
 	}
 	return blk, nil
 }
 
-func isInsertIntoValues(doc *SqlDocument) bool {
-	cpDoc := clone.Clone(doc).(*SqlDocument)
-	token, _ := cpDoc.tk.Peek()
-	if !strings.EqualFold(token, "insert") {
-		return false
+//解析一条语句, blk为nil时表示在文档顶层. 不支持的语句返回UnparsedStatement, 空语句返回nil, nil
+func parseStatement(doc *SqlDocument, blk *SqlBlock) (SqlStatement, error) {
+	start, _ := doc.tk.PeekToken()
+	sqlStatement, err := parseSqlStatement(doc, blk)
+	if err != nil || sqlStatement == nil {
+		return nil, err
 	}
-	cpDoc.tk.Pop()
-
-	token, _ = cpDoc.tk.Peek()
-	if !strings.EqualFold(token, "into") {
-		return false
+	end := doc.tk.lastToken()
+	if token, _ := doc.tk.PeekToken(); token.Text == ";" { //;后面的注释算作语句的注释
+		doc.tk.Pop()
+		end.Trailing = append(end.Trailing[:len(end.Trailing):len(end.Trailing)], token.Trailing...)
 	}
-	cpDoc.tk.Pop()
-
-	for {
-		token, _ = cpDoc.tk.Peek()
-		if strings.EqualFold(token, "values") {
-			return true
-		}
-		if isBegin(token) || token == "" {
-			return false
-		}
-		cpDoc.tk.Pop()
+	if node, ok := sqlStatement.(interface{ setSpan(Span) }); ok {
+		node.setSpan(doc.span(start, end))
 	}
+	return sqlStatement, nil
 }
 
-func parseInsertIntoValues(doc *SqlDocument) (SqlStatement, error) {
-	doc.next = doc.tk.pos
-	token, _ := doc.tk.Peek()
-	if !strings.EqualFold(token, "insert") {
-		return nil, fmt.Errorf("error")
+func parseSqlStatement(doc *SqlDocument, blk *SqlBlock) (SqlStatement, error) {
+	if isInsert(doc) {
+		return parseInsert(doc)
 	}
-	doc.tk.Pop()
-
-	token, _ = doc.tk.Peek()
-	if !strings.EqualFold(token, "into") {
-		return nil, fmt.Errorf("error")
+	if isUpdate(doc) {
+		return parseUpdate(doc)
 	}
-	doc.tk.Pop()
-
-	for {
-		token, _ = doc.tk.Peek()
-		if strings.EqualFold(token, "values") {
-			break
-		}
-		if isBegin(token) || token == "" {
-			return nil, fmt.Errorf("error")
+	if isDelete(doc) {
+		return parseDelete(doc)
+	}
+	if isCreateTable(doc) {
+		return parseCreateTable(doc)
+	}
+	if isCreateFunction(doc) {
+		return parseCreateFunction(doc)
+	}
+	if isCreateProcedure(doc) {
+		return parseCreateProcedure(doc)
+	}
+	if isCreateIndex(doc) {
+		return parseCreateIndex(doc)
+	}
+	if isAlterTable(doc) {
+		return parseAlterTable(doc)
+	}
+	if isRename(doc) {
+		return parseRename(doc)
+	}
+	if isSelect(doc) {
+		return parseSelect(doc)
+	}
+	if isDeclareTable(doc) {
+		return parseDeclareTable(doc)
+	}
+	if isDeclare(doc) {
+		cmd, err := parseDeclare(doc, blk)
+		if err != nil {
+			return nil, err
 		}
+		return cmd, nil
+	}
+	if isIdentityInsert(doc) {
+		return parseIdentityInsert(doc)
+	}
+	if isCheckIdent(doc) {
+		return parseCheckIdent(doc)
+	}
+	if isSetOption(doc) {
+		return parseSetOption(doc)
+	}
+	if isSet(doc) {
+		return parseSet(doc)
+	}
+	if isIf(doc) {
+		return parseIf(doc, blk)
+	}
+	if isWhile(doc) {
+		return parseWhile(doc, blk)
+	}
+	if isBreak(doc) {
+		return parseBreak(doc)
+	}
+	if isReturn(doc) {
+		return parseReturn(doc)
+	}
+	if isPrint(doc) {
+		return parsePrint(doc)
+	}
+	if isRaiseError(doc) {
+		return parseRaiseError(doc)
+	}
+	if isThrow(doc) {
+		return parseThrow(doc)
+	}
+	if isTryCatch(doc) {
+		return parseTryCatch(doc)
+	}
+	token, err := doc.tk.Peek()
+	if err != nil {
+		return nil, doc.parseError()
+	}
+	if strings.EqualFold(token, "begin") {
 		doc.tk.Pop()
+		return parseSqlBlock(doc, &SqlBlock{})
 	}
-	doc.tk.Pop()
-
-	token, _ = doc.tk.Peek()
-	if token != "(" {
-		return nil, fmt.Errorf("error")
+	if token == ";" { //空语句
+		doc.tk.Pop()
+		return nil, nil
 	}
-	doc.tk.Pop()
+	if isBegin(token) && !strings.EqualFold(token, "end") {
+		return parseUnsupported(doc), nil
+	}
+	return nil, doc.parseError()
+}
 
+//不支持的语句跳到下一条语句的开头, 注释掉并记录警告.
+//merge以;结尾, grant, revoke和deny中的select等权限不是语句的开头, 只在新的一行开始下一条语句
+func parseUnsupported(doc *SqlDocument) SqlStatement {
+	start, _ := doc.tk.PopToken()
+	word := strings.ToLower(start.Text)
 	for {
-		token, _ = doc.tk.Peek()
-		if token == ")" {
-			return &DQLCmd{s: string(doc.tk.statement[doc.next:doc.tk.pos])}, nil
+		token, _ := doc.tk.PeekToken()
+		if token.Kind == TokenEOF || token.Kind == TokenGo {
+			break
 		}
-		if isBegin(token) || token == "" {
-			return nil, fmt.Errorf("error")
+		switch {
+		case isEnd(token.Text):
+			return unsupported(doc, start)
+		case word == "merge":
+		case word == "grant" || word == "revoke" || word == "deny":
+			if isBegin(token.Text) && token.Line > doc.tk.lastToken().Line {
+				return unsupported(doc, start)
+			}
+		case strings.EqualFold(token.Text, "else") || isBegin(token.Text) && !isDropIfExists(doc):
+			return unsupported(doc, start)
 		}
 		doc.tk.Pop()
 	}
+	return unsupported(doc, start)
 }
 
-func isInsertIntoSelect(doc *SqlDocument) bool {
-	cpDoc := clone.Clone(doc).(*SqlDocument)
-	token, _ := cpDoc.tk.Peek()
-	if !strings.EqualFold(token, "insert") {
-		return false
+//start到上一个token记录为不支持的语句
+func unsupported(doc *SqlDocument, start Token) SqlStatement {
+	end := doc.tk.lastToken()
+	doc.warn(start, "unsupported statement %s, commented out", strings.ToLower(start.Text))
+	return &UnparsedStatement{
+		Span: doc.span(start, end),
+		Text: doc.text(start.Start, end.End),
+		Err:  doc.tk.share(doc.tk.errorAt(start, fmt.Errorf("unsupported statement"))),
 	}
-	cpDoc.tk.Pop()
+}
 
-	token, _ = cpDoc.tk.Peek()
-	if !strings.EqualFold(token, "into") {
+//drop table if exists t中的if不是if语句的开头, if exists (select ...)才是
+func isDropIfExists(doc *SqlDocument) bool {
+	defer doc.tk.Reset(doc.tk.Mark())
+	if !doc.peekWord("if") {
 		return false
 	}
-	cpDoc.tk.Pop()
-
-	for {
-		token, _ = cpDoc.tk.Peek()
-		if strings.EqualFold(token, "select") {
-			return true
-		}
-		if isBegin(token) || token == "" {
-			return false
-		}
-		cpDoc.tk.Pop()
+	doc.tk.Pop()
+	if !doc.peekWord("exists") {
+		return false
 	}
+	doc.tk.Pop()
+	token, _ := doc.tk.Peek()
+	return token != "("
 }
 
-func parseInsertIntoSelect(doc *SqlDocument) (SqlStatement, error) {
-	doc.next = doc.tk.pos
-	token, _ := doc.tk.Peek()
-	if !strings.EqualFold(token, "insert") {
-		return nil, fmt.Errorf("error")
+//恢复模式下从出错处跳到下一条语句的开头(keywords中的关键字, go或;之后),
+//把start开始被跳过的部分记录为UnparsedStatement
+func (doc *SqlDocument) recover(start Token, err error) (SqlStatement, error) {
+	e, ok := err.(*ParseError)
+	if ok {
+		doc.tk.share(e)
 	}
-	doc.tk.Pop()
-
-	token, _ = doc.tk.Peek()
-	if !strings.EqualFold(token, "into") {
-		return nil, fmt.Errorf("error")
+	if !doc.Recover || !ok || doc.tk.err != nil {
+		return nil, err
+	}
+	if doc.tk.tokenPos() == start.Start {
+		doc.tk.Pop()
 	}
-	doc.tk.Pop()
-
 	for {
-		token, _ = doc.tk.Peek()
-		if strings.EqualFold(token, "select") {
-			return parseNestedSelect(doc, 0)
+		token, err := doc.tk.PeekToken()
+		if err != nil {
+			return nil, doc.tk.share(doc.tk.newParseError())
 		}
-		if isBegin(token) || token == "" {
-			return nil, fmt.Errorf("error")
+		if token.Kind == TokenEOF || token.Kind == TokenGo || token.Kind == TokenKeyword && isBegin(token.Text) {
+			break
 		}
 		doc.tk.Pop()
+		if token.Text == ";" {
+			doc.tk.Peek()
+			break
+		}
 	}
+	doc.Errors = append(doc.Errors, e)
+	return &UnparsedStatement{
+		Span: doc.span(start, doc.tk.lastToken()),
+		Text: doc.text(start.Start, doc.tk.lastEnd()),
+		Err:  e,
+	}, nil
 }
 
-func isSelectInto(doc *SqlDocument) bool {
-	cpDoc := clone.Clone(doc).(*SqlDocument)
-	token, _ := cpDoc.tk.Peek()
-	if !strings.EqualFold(token, "select") {
-		return false
-	}
-	cpDoc.tk.Pop()
+//SqlBatch GO分隔的批处理
+type SqlBatch struct {
+	SqlStatements []SqlStatement
+	SqlVars       []SqlVar
+	Go            *GoCmd  //结尾的GO, 最后一个批处理可以没有GO
+	comments      []Token //GO之前的注释
+}
 
-	for {
-		token, _ = cpDoc.tk.Peek()
-		if strings.EqualFold(token, "into") {
-			return true
-		}
-		if isBegin(token) || token == "" {
-			return false
-		}
-		cpDoc.tk.Pop()
+//普通sql直接输出, 从第一条需要plpgsql执行的语句开始放到一个DO块中,
+//批处理中的变量都在DO块的declare部分声明. GO n时重复n次
+func (batch *SqlBatch) PgSql() string {
+	i := 0
+	for i < len(batch.SqlStatements) && !isProcedural(batch.SqlStatements[i:i+1]) {
+		i++
 	}
+	s := pgSqlList(batch.SqlStatements[:i])
+	if i < len(batch.SqlStatements) {
+		sqlStatements := batch.SqlStatements[i:]
+		s += "DO $$\n" + pgDeclare(sqlStatements) + "BEGIN\n" + pgSqlList(sqlStatements) + commentLines(batch.comments) + "END $$;"
+	} else {
+		s += commentLines(batch.comments)
+	}
+	return pgBatch(s, batch.Go.count())
 }
 
-func parseSelectInto(doc *SqlDocument) (SqlStatement, error) {
-	doc.next = doc.tk.pos
-	token, _ := doc.tk.Peek()
-	if !strings.EqualFold(token, "select") {
-		return nil, fmt.Errorf("error")
+func (batch *SqlBatch) MsSql() string {
+	s := msSqlList(batch.SqlStatements) + commentLines(batch.comments)
+	if batch.Go != nil {
+		s += withComments(batch.Go, batch.Go.MsSql())
 	}
-	doc.tk.Pop()
+	return strings.TrimSuffix(s, "\n")
+}
 
-	for {
-		token, _ = doc.tk.Peek()
-		if strings.EqualFold(token, "into") {
-			break
-		}
-		if token == "" {
-			return nil, fmt.Errorf("error")
-		}
-		doc.tk.Pop()
+func pgBatch(s string, count int) string {
+	s = strings.TrimSuffix(s, "\n")
+	if s == "" {
+		return ""
 	}
-	doc.tk.Pop()
+	a := make([]string, count)
+	for i := range a {
+		a[i] = s
+	}
+	return strings.Join(a, "\n")
+}
 
-	for {
-		token, _ = doc.tk.Peek()
-		if strings.EqualFold(token, "from") {
-			return parseFrom(doc, 0)
-		}
-		if token == "" {
-			return nil, fmt.Errorf("error")
+//是否含有变量, 流程控制等需要plpgsql执行的语句
+func isProcedural(sqlStatements []SqlStatement) bool {
+	for _, v := range sqlStatements {
+		switch v.(type) {
+		case *SelectStmt, *InsertStmt, *UpdateStmt, *DeleteStmt, *CreateTableStmt, *UnparsedStatement, *SetOptionCmd,
+			*IdentityInsertCmd, *CheckIdentCmd, *AlterTableStmt, *RenameCmd,
+			*CreateIndexStmt, *CreateProcedureStmt, *CreateFunctionStmt:
+		default:
+			return true
 		}
-		doc.tk.Pop()
 	}
+	return false
 }
 
-func isSelect(doc *SqlDocument) bool {
-	cpDoc := clone.Clone(doc).(*SqlDocument)
-	token, _ := cpDoc.tk.Peek()
-	if !strings.EqualFold(token, "select") {
-		return false
+//plpgsql的declare部分. 包括begin ... end, if和while等里面声明的变量, mssql的变量在整个批处理中有效
+func pgDeclare(sqlStatements []SqlStatement) string {
+	if s := pgDeclareVars(sqlStatements, map[string]bool{}); s != "" {
+		return "DECLARE\n" + s
 	}
-	doc.tk.Pop()
+	return ""
+}
 
-	for {
-		token, _ = cpDoc.tk.Peek()
-		if strings.EqualFold(token, "from") {
-			return true
+//每行声明一个变量, 没有初始值的declare的注释也放在这里. seen为已经声明的变量, 同名变量只声明一次
+func pgDeclareVars(sqlStatements []SqlStatement, seen map[string]bool) string {
+	var s string
+	for _, cmd := range declareCmds(sqlStatements, nil) {
+		assign := cmd.PgSql() != "" //有初始值时注释跟着赋值语句
+		if !assign {
+			s += commentLines(cmd.Start.Leading)
+		}
+		for _, v := range cmd.sqlVars {
+			if name := pgVar(v.name); !seen[name] {
+				seen[name] = true
+				s += name + " " + pgType(v.typ, cmd.opts) + ";\n"
+			}
 		}
-		if token == "" {
-			return false
+		if !assign {
+			s += commentLines(cmd.End.Trailing)
 		}
-		cpDoc.tk.Pop()
 	}
+	return s
 }
 
-func parseSelect(doc *SqlDocument) (SqlStatement, error) {
-	doc.next = doc.tk.pos
-	token, _ := doc.tk.Peek()
-	if !strings.EqualFold(token, "select") {
-		return nil, fmt.Errorf("error")
-	}
-	doc.tk.Pop()
-
-	for {
-		token, _ = doc.tk.Peek()
-		if strings.EqualFold(token, "from") {
-			return parseFrom(doc, 0)
-		}
-		if isBegin(token) || token == "" {
-			return nil, fmt.Errorf("error")
+func declareCmds(sqlStatements []SqlStatement, cmds []*DeclareCmd) []*DeclareCmd {
+	for _, v := range sqlStatements {
+		switch v := v.(type) {
+		case *DeclareCmd:
+			cmds = append(cmds, v)
+		case *SqlBlock:
+			cmds = declareCmds(v.SqlStatements, cmds)
+		case *IfCmd:
+			cmds = declareCmds([]SqlStatement{v.Then}, cmds)
+			if v.Else != nil {
+				cmds = declareCmds([]SqlStatement{v.Else}, cmds)
+			}
+		case *WhileCmd:
+			cmds = declareCmds([]SqlStatement{v.SqlBlock}, cmds)
+		case *TryCatchCmd:
+			cmds = declareCmds([]SqlStatement{v.Try, v.Catch}, cmds)
 		}
-		doc.tk.Pop()
 	}
+	return cmds
 }
 
-func parseNestedSelect(doc *SqlDocument, nesting int) (SqlStatement, error) {
-	token, _ := doc.tk.Peek()
-	if !strings.EqualFold(token, "select") {
-		return nil, fmt.Errorf("error")
+//GO [count], 批处理分隔符
+type GoCmd struct {
+	Span
+	Count int //批处理执行的次数, 没有写时为0
+}
+
+func parseGo(doc *SqlDocument) *GoCmd {
+	token, _ := doc.tk.PopToken()
+	cmd := &GoCmd{Span: doc.span(token, token)}
+	fields := strings.Fields(string(doc.tk.slice(token.Start, token.End)))
+	if len(fields) > 1 {
+		cmd.Count, _ = strconv.Atoi(fields[1])
 	}
-	doc.tk.Pop()
+	return cmd
+}
 
-	for {
-		token, _ = doc.tk.Peek()
-		if strings.EqualFold(token, "from") {
-			return parseFrom(doc, nesting)
-		}
-		if isBegin(token) || token == "" {
-			return nil, fmt.Errorf("error")
-		}
-		doc.tk.Pop()
+func (cmd *GoCmd) count() int {
+	if cmd == nil || cmd.Count < 1 {
+		return 1
 	}
+	return cmd.Count
 }
 
-func parseFrom(doc *SqlDocument, nesting int) (SqlStatement, error) {
-	token, _ := doc.tk.Peek()
-	if !strings.EqualFold(token, "from") {
-		return nil, fmt.Errorf("error")
+//GO只用于分隔批处理, 没有对应的pgsql
+func (cmd *GoCmd) PgSql() string {
+	return ""
+}
+
+func (cmd *GoCmd) MsSql() string {
+	if cmd.Count > 0 {
+		return fmt.Sprintf("GO %d", cmd.Count)
 	}
-	doc.tk.Pop()
+	return "GO"
+}
 
-	token, _ = doc.tk.Peek()
-	if token == "(" {
-		nesting++
-		doc.tk.Pop()
-		return parseNestedSelect(doc, nesting)
+//恢复模式下无法解析的语句
+type UnparsedStatement struct {
+	Span
+	Text string
+	Err  *ParseError
+}
+
+//原样注释掉, 并在前面注明错误
+func (stmt *UnparsedStatement) PgSql() string {
+	a := []string{"-- ERROR: " + stmt.Err.Error()}
+	for _, line := range strings.Split(stmt.Text, "\n") {
+		a = append(a, "-- "+line)
 	}
+	return strings.Join(a, "\n")
+}
 
-	return parsePostFrom(doc, nesting)
+func (stmt *UnparsedStatement) MsSql() string {
+	return stmt.Text
 }
 
 var keywords = []string{
@@ -457,7 +670,12 @@ var keywords = []string{
 	"create",
 	"alter",
 	"while",
+	"break",
+	"continue",
 	"return",
+	"print",
+	"raiserror",
+	"throw",
 	"declare",
 	"if",
 	"set",
@@ -465,6 +683,43 @@ var keywords = []string{
 	"truncate",
 	"begin",
 	"end",
+	//不支持的语句, 注释掉
+	"exec",
+	"execute",
+	"merge",
+	"use",
+	"grant",
+	"revoke",
+	"deny",
+	"commit",
+	"rollback",
+	"save",
+	"waitfor",
+	"goto",
+	"open",
+	"close",
+	"fetch",
+	"deallocate",
+	"dbcc",
+	"backup",
+	"restore",
+	"kill",
+	"checkpoint",
+	"reconfigure",
+	"bulk",
+	"revert",
+	"setuser",
+	"shutdown",
+}
+
+//语句结尾
+func isEnd(token string) bool {
+	return token == "" || token == ";"
+}
+
+//return和throw后面没有可选的参数
+func isStatementEnd(token Token) bool {
+	return isEnd(token.Text) || isBegin(token.Text) || token.Kind == TokenGo || strings.EqualFold(token.Text, "else")
 }
 
 func isBegin(token string) bool {
@@ -476,96 +731,9 @@ func isBegin(token string) bool {
 	return false
 }
 
-//new: Starts with one of insert select update delete declare set ...
-//select xxx from xxx as xxx <new>
-//select xxx from xxx where xxx and xxx order by xxx limit xxx <new>
-//select xxx from (select xxx from (select xxx from xxx) xxx) xxx as xxx <new>
-//select xxx from (select xxx from xxx union all select xxx from xxx) xxx as xxx <new>
-//select xxx from xxx join xxx on xxx = xxx <new>
-func parsePostFrom(doc *SqlDocument, nesting int) (SqlStatement, error) {
-	for {
-		token, _ := doc.tk.Peek()
-		if token == ")" {
-			nesting--
-		}
-		if strings.EqualFold(token, "union") {
-			return parseUnion(doc)
-		}
-		if strings.EqualFold(token, "join") {
-			return parseJoin(doc)
-		}
-		if isBegin(token) || token == "" {
-			if nesting > 0 {
-				return nil, fmt.Errorf("error")
-			}
-			doc.tk.pos -= len(token)
-			doc.tk.curToken = doc.tk.prevToken
-			return &DQLCmd{s: string(doc.tk.statement[doc.next:doc.tk.pos])}, nil
-		}
-		doc.tk.Pop()
-	}
-}
-
-func parseUnion(doc *SqlDocument) (SqlStatement, error) {
-	token, _ := doc.tk.Peek()
-	if !strings.EqualFold(token, "union") {
-		return nil, fmt.Errorf("error")
-	}
-	doc.tk.Pop()
-
-	token, _ = doc.tk.Peek()
-	if strings.EqualFold(token, "all") {
-		doc.tk.Pop()
-	}
-
-	return parseNestedSelect(doc, 0)
-}
-
-func parseJoin(doc *SqlDocument) (SqlStatement, error) {
-	token, _ := doc.tk.Peek()
-	if !strings.EqualFold(token, "join") {
-		return nil, fmt.Errorf("error")
-	}
-	doc.tk.Pop()
-
-	token, _ = doc.tk.Peek()
-	if token == "(" {
-		doc.tk.Pop()
-		return parseNestedSelect(doc, 0)
-	}
-
-	for {
-		token, _ = doc.tk.Peek()
-		if strings.EqualFold(token, "join") {
-			return parseJoin(doc)
-		}
-		if strings.EqualFold(token, "union") {
-			return parseUnion(doc)
-		}
-		if isBegin(token) || token == "" {
-			doc.tk.pos -= len(token)
-			doc.tk.curToken = doc.tk.prevToken
-			return &DQLCmd{s: string(doc.tk.statement[doc.next:doc.tk.pos])}, nil
-		}
-		doc.tk.Pop()
-	}
-}
-
-//select
-type DQLCmd struct {
-	s string
-}
-
-func (cmd DQLCmd) PgSql() string {
-	return cmd.s + ";"
-}
-
-func (cmd DQLCmd) MsSql() string {
-	return cmd.s
-}
-
 //insert, update, delete
 type DMLCmd struct {
+	Span
 	s string
 }
 
@@ -577,19 +745,6 @@ func (cmd DMLCmd) MsSql() string {
 	return cmd.s
 }
 
-//create, alter
-type DDLCmd struct {
-	s string
-}
-
-func (cmd DDLCmd) PgSql() string {
-	return cmd.s + ";"
-}
-
-func (cmd DDLCmd) MsSql() string {
-	return cmd.s
-}
-
 //type DCLCmd struct {
 //
 //}
@@ -598,41 +753,110 @@ type SqlVar struct {
 	name  string
 	typ   string
 	value string
+	init  Expr //declare @a int = 1的初始值
+}
+
+//int, varchar(10), decimal(18, 2), nvarchar(max)
+func parseDataType(doc *SqlDocument) (string, error) {
+	token, _ := doc.tk.PeekToken()
+	if token.Kind != TokenIdent && token.Kind != TokenKeyword && token.Kind != TokenQuotedIdent || isBegin(token.Text) {
+		return "", doc.parseError("type")
+	}
+	typ := token.Text
+	doc.tk.Pop()
+
+	if token, _ := doc.tk.Peek(); token != "(" {
+		return typ, nil
+	}
+	doc.tk.Pop()
+	typ += "("
+	for {
+		token, _ := doc.tk.PeekToken()
+		if token.Kind != TokenNumber && !strings.EqualFold(token.Text, "max") {
+			return "", doc.parseError("length")
+		}
+		typ += token.Text
+		doc.tk.Pop()
+
+		token, _ = doc.tk.PeekToken()
+		if token.Text == ")" {
+			doc.tk.Pop()
+			return typ + ")", nil
+		}
+		if token.Text != "," {
+			return "", doc.parseError(",", ")")
+		}
+		typ += ", "
+		doc.tk.Pop()
+	}
+}
+
+func findVar(sqlVars []SqlVar, name string) *SqlVar {
+	for i := range sqlVars {
+		if sqlVars[i].name == name {
+			return &sqlVars[i]
+		}
+	}
+	return nil
+}
+
+func isStringType(typ string) bool {
+	typ = strings.ToLower(typ)
+	for _, v := range []string{"char", "varchar", "nchar", "nvarchar", "text", "ntext"} {
+		if typ == v || strings.HasPrefix(typ, v+"(") {
+			return true
+		}
+	}
+	return false
 }
 
 type DeclareCmd struct {
+	Span
 	sqlVars []SqlVar
 }
 
+//变量在DO块或者函数的declare部分声明, 这里只输出初始值的赋值, 在原来的位置计算初始值
 func (cmd *DeclareCmd) PgSql() string {
 	var a []string
 	for _, v := range cmd.sqlVars {
-		if strings.HasPrefix(v.name, "@") {
-			v.name = "v_" + v.name[1:]
+		if v.init == nil {
+			continue
+		}
+		w := newSqlWriter(cmd.Span, true)
+		w.write(pgVar(v.name) + " :=")
+		if b, ok := boolLiteral(v.init); ok && pgType(v.typ, cmd.opts) == "boolean" {
+			w.write(b)
+		} else {
+			v.init.writeSql(w)
 		}
-		a = append(a, v.name+" "+v.typ)
+		a = append(a, w.String()+";")
 	}
-	return fmt.Sprintf("declare %s;", strings.Join(a, ", "))
+	return strings.Join(a, "\n")
 }
 
 func (cmd *DeclareCmd) MsSql() string {
 	var a []string
 	for _, v := range cmd.sqlVars {
-		a = append(a, v.name+" "+v.typ)
+		s := v.name + " " + v.typ
+		if v.init != nil {
+			s += " = " + exprSql(v.init, false)
+		}
+		a = append(a, s)
 	}
 	return fmt.Sprintf("declare %s", strings.Join(a, ", "))
 }
 
 func isDeclare(doc *SqlDocument) bool {
-	cpDoc := clone.Clone(doc).(*SqlDocument)
-	token, _ := cpDoc.tk.Peek()
+	defer doc.tk.Reset(doc.tk.Mark())
+	token, _ := doc.tk.Peek()
 	return strings.EqualFold(token, "declare")
 }
 
-func parseDeclareBlk(doc *SqlDocument, parent *SqlBlock) (*DeclareCmd, error) {
+//declare @a int = 1, @b varchar(10), blk为nil时变量属于批处理
+func parseDeclare(doc *SqlDocument, blk *SqlBlock) (*DeclareCmd, error) {
 	token, _ := doc.tk.Peek()
 	if !strings.EqualFold(token, "declare") {
-		return nil, fmt.Errorf("error")
+		return nil, doc.parseError("declare")
 	}
 	doc.tk.Pop()
 
@@ -641,214 +865,746 @@ func parseDeclareBlk(doc *SqlDocument, parent *SqlBlock) (*DeclareCmd, error) {
 	for {
 		var sqlVar SqlVar
 
-		token, _ = doc.tk.Peek()
-		if isBegin(token) || token == "" {
-			return nil, fmt.Errorf("error")
+		name, _ := doc.tk.PeekToken()
+		if name.Kind != TokenVariable {
+			return nil, doc.parseError("variable")
 		}
-		sqlVar.name = token
+		sqlVar.name = name.Text
 		doc.tk.Pop()
 
-		token, _ = doc.tk.Peek()
-		if isBegin(token) || token == "" {
-			return nil, fmt.Errorf("error")
+		typ, err := parseDataType(doc)
+		if err != nil {
+			return nil, err
 		}
-		sqlVar.typ = token
-		doc.tk.Pop()
+		sqlVar.typ = typ
 
-		sqlVars = append(sqlVars, sqlVar)
-
-		token, _ = doc.tk.Peek()
-		if token == "," {
+		if token, _ := doc.tk.Peek(); token == "=" {
 			doc.tk.Pop()
-		} else if isBegin(token) || token == "" {
-			doc.tk.pos -= len(token)
-			doc.tk.curToken = doc.tk.prevToken
-			break
-		} else {
-			return nil, fmt.Errorf("error")
-		}
-	}
-
-	sqlVars = append(sqlVars, sqlVars...)
-	parent.SqlVars = sqlVars
-	return &DeclareCmd{sqlVars}, nil
-}
-
-func parseDeclareDoc(doc *SqlDocument) (*DeclareCmd, error) {
-	token, _ := doc.tk.Peek()
-	if !strings.EqualFold(token, "declare") {
-		return nil, fmt.Errorf("error")
-	}
-	doc.tk.Pop()
-
-	var sqlVars []SqlVar
-
-	for {
-		var sqlVar SqlVar
-
-		token, _ = doc.tk.Peek()
-		if isBegin(token) || token == "" {
-			return nil, fmt.Errorf("error")
-		}
-		sqlVar.name = token
-		doc.tk.Pop()
-
-		token, _ = doc.tk.Peek()
-		if isBegin(token) || token == "" {
-			return nil, fmt.Errorf("error")
+			if sqlVar.init, err = parseExpr(doc); err != nil {
+				return nil, err
+			}
+			sqlVar.value = exprSql(sqlVar.init, false)
 		}
-		sqlVar.typ = token
-		doc.tk.Pop()
 
 		sqlVars = append(sqlVars, sqlVar)
 
 		token, _ = doc.tk.Peek()
 		if token == "," {
 			doc.tk.Pop()
-		} else if isBegin(token) || token == "" {
-			doc.tk.pos -= len(token)
-			doc.tk.curToken = doc.tk.prevToken
+		} else if isBegin(token) || isEnd(token) {
 			break
 		} else {
-			return nil, fmt.Errorf("error")
+			return nil, doc.parseError(",")
 		}
 	}
 
-	sqlVars = append(sqlVars, sqlVars...)
-	doc.SqlVars = sqlVars
-	return &DeclareCmd{sqlVars}, nil
+	if blk == nil {
+		doc.SqlVars = append(doc.SqlVars, sqlVars...)
+	} else {
+		blk.SqlVars = append(blk.SqlVars, sqlVars...)
+	}
+	return &DeclareCmd{sqlVars: sqlVars}, nil
 }
 
 type SetCmd struct {
-	name  string
-	value string
+	Span
+	Name  Token
+	Op    Token  //=, +=, -=, ...
+	Type  string //变量类型
+	Value Expr
+	set   Token
+}
+
+//复合赋值运算符对应的pgsql运算符
+var compoundOps = map[string]string{
+	"+=": "+",
+	"-=": "-",
+	"*=": "*",
+	"/=": "/",
+	"%=": "%",
+	"&=": "&",
+	"|=": "|",
+	"^=": "#",
 }
 
 func isSet(doc *SqlDocument) bool {
-	cpDoc := clone.Clone(doc).(*SqlDocument)
-	token, _ := cpDoc.tk.Peek()
+	defer doc.tk.Reset(doc.tk.Mark())
+	token, _ := doc.tk.Peek()
 	return strings.EqualFold(token, "set")
 }
 
-func parseSetDoc(doc *SqlDocument) (SqlStatement, error) {
+func parseSet(doc *SqlDocument) (SqlStatement, error) {
 	cmd := &SetCmd{}
-	token, _ := doc.tk.Peek()
-	if token != "set" {
-		return nil, fmt.Errorf("error")
+	token, _ := doc.tk.PeekToken()
+	if !strings.EqualFold(token.Text, "set") {
+		return nil, doc.parseError("set")
 	}
+	cmd.set = token
 	doc.tk.Pop()
 
-	token, _ = doc.tk.Peek()
-	cmd.name = token
+	name, _ := doc.tk.PeekToken()
+	if name.Kind != TokenVariable {
+		return nil, doc.parseError("variable")
+	}
+	cmd.Name = name
 	doc.tk.Pop()
 
-	token, _ = doc.tk.Peek()
-	if token != "=" {
-		return nil, fmt.Errorf("error")
+	token, _ = doc.tk.PeekToken()
+	if token.Text != "=" && compoundOps[token.Text] == "" {
+		return nil, doc.parseError("=")
 	}
+	cmd.Op = token
 	doc.tk.Pop()
 
-	for {
-		token, _ = doc.tk.Peek()
-		cmd.value += token
-		if isBegin(token) || token == "" {
-			break
-		}
-		doc.tk.Pop()
+	value, err := parseExpr(doc)
+	if err != nil {
+		return nil, err
 	}
+	cmd.Value = value
 
-	if !doc.setVarValue(cmd.name, cmd.value) {
-		return nil, fmt.Errorf("error")
+	v := doc.findVar(name.Text)
+	if v == nil {
+		return nil, doc.tk.errorAt(name, fmt.Errorf("undeclared variable %s", name.Text))
+	}
+	v.value = exprSql(value, false)
+	cmd.Type = v.typ
+	if cmd.Op.Text == "=" {
+		cmd.Value = bitValue(doc, value, v.typ)
+	}
+	if isRowcount(value) && cmd.Op.Text == "=" {
+		doc.unwarn(value.(*VariableRef).Token)
 	}
-
 	return cmd, nil
 }
 
-func parseSetBlk(doc *SqlDocument, parent *SqlBlock) (SqlStatement, error) {
-	cmd := &SetCmd{}
-	token, _ := doc.tk.Peek()
-	if token != "set" {
-		return nil, fmt.Errorf("error")
+//set @i+=1 => v_i := v_i + 1, 字符串的+=转成||
+//set @n = @@rowcount => get diagnostics v_n = row_count
+func (cmd *SetCmd) PgSql() string {
+	w := newSqlWriter(cmd.Span, true)
+	if isRowcount(cmd.Value) && cmd.Op.Text == "=" {
+		w.leading(cmd.set)
+		w.write("GET DIAGNOSTICS")
+		w.token(cmd.Name)
+		w.write("=")
+		w.leading(cmd.Value.(*VariableRef).Token)
+		w.write("ROW_COUNT")
+		w.trailing(cmd.Value.(*VariableRef).Token)
+		return w.String() + ";"
 	}
-	doc.tk.Pop()
+	w.token(cmd.Name)
+	w.write(":=")
+	if op := compoundOps[cmd.Op.Text]; op != "" {
+		if op == "+" && isStringType(cmd.Type) {
+			op = "||"
+		}
+		w.write(pgVar(cmd.Name.Text) + " " + op)
+		_, binary := cmd.Value.(*BinaryExpr)
+		writeOperand(w, cmd.Value, binary)
+	} else {
+		cmd.Value.writeSql(w)
+	}
+	return w.String() + ";"
+}
 
-	token, _ = doc.tk.Peek()
-	cmd.name = token
+func (cmd *SetCmd) MsSql() string {
+	w := newSqlWriter(cmd.Span, false)
+	w.token(cmd.set)
+	w.token(cmd.Name)
+	w.token(cmd.Op)
+	cmd.Value.writeSql(w)
+	return w.String()
+}
+
+//set nocount on, set ansi_nulls, quoted_identifier off
+type SetOptionCmd struct {
+	Span
+	options []string
+	on      bool
+}
+
+func isSetOption(doc *SqlDocument) bool {
+	defer doc.tk.Reset(doc.tk.Mark())
+	token, _ := doc.tk.Peek()
+	if !strings.EqualFold(token, "set") {
+		return false
+	}
 	doc.tk.Pop()
+	option, _ := doc.tk.PeekToken()
+	return option.Kind == TokenIdent || option.Kind == TokenKeyword
+}
 
-	token, _ = doc.tk.Peek()
-	if token != "=" {
-		return nil, fmt.Errorf("error")
+func parseSetOption(doc *SqlDocument) (SqlStatement, error) {
+	cmd := &SetOptionCmd{}
+	token, _ := doc.tk.Peek()
+	if !strings.EqualFold(token, "set") {
+		return nil, doc.parseError("set")
 	}
 	doc.tk.Pop()
 
 	for {
+		option, _ := doc.tk.PeekToken()
+		if option.Kind != TokenIdent && option.Kind != TokenKeyword {
+			return nil, doc.parseError("option")
+		}
+		cmd.options = append(cmd.options, option.Text)
+		doc.tk.Pop()
+
 		token, _ = doc.tk.Peek()
-		cmd.value += token
-		if isBegin(token) || token == "" {
+		if token != "," {
 			break
 		}
 		doc.tk.Pop()
 	}
 
-	if !parent.setVarValue(cmd.name, cmd.value) {
-		return nil, fmt.Errorf("error")
+	token, _ = doc.tk.Peek()
+	if strings.EqualFold(token, "on") {
+		cmd.on = true
+	} else if !strings.EqualFold(token, "off") {
+		return nil, doc.parseError("on", "off")
 	}
+	doc.tk.Pop()
 
+	for _, v := range cmd.options {
+		if strings.EqualFold(v, "quoted_identifier") {
+			doc.tk.SetQuotedIdentifier(cmd.on)
+		}
+	}
 	return cmd, nil
 }
 
-func (cmd *SetCmd) PgSql() string {
-	if strings.HasPrefix(cmd.name, "@") {
-		cmd.name = "v_" + cmd.name[1:]
-	}
-	return fmt.Sprintf("set %s=%s;", cmd.name, cmd.value)
+//pgsql没有对应的设置, 保留为注释
+func (cmd *SetOptionCmd) PgSql() string {
+	return "-- " + cmd.MsSql()
 }
 
-func (cmd *SetCmd) MsSql() string {
-	return fmt.Sprintf("set %s=%s;", cmd.name, cmd.value)
+func (cmd *SetOptionCmd) MsSql() string {
+	value := "OFF"
+	if cmd.on {
+		value = "ON"
+	}
+	return fmt.Sprintf("SET %s %s", strings.Join(cmd.options, ", "), value)
 }
 
 type WhileCmd struct {
-	condition string
+	Span
+	Condition Expr
 	SqlBlock  SqlStatement
+	label     string //嵌套循环时的标签, break和continue用它指明退出哪一层
 }
 
 func isWhile(doc *SqlDocument) bool {
-	cpDoc := clone.Clone(doc).(*SqlDocument)
-	token, _ := cpDoc.tk.Peek()
+	defer doc.tk.Reset(doc.tk.Mark())
+	token, _ := doc.tk.Peek()
 	return strings.EqualFold(token, "while")
 }
 
 //while 条件 begin ... end => while 条件 loop ... end loop;
 func (cmd *WhileCmd) PgSql() string {
-	return fmt.Sprintf("WHILE%sLOOP\n%sEND LOOP;", cmd.condition, cmd.SqlBlock.MsSql())
+	s := fmt.Sprintf("WHILE %s LOOP\n%s\nEND LOOP", pgExpr(cmd.Condition, cmd.opts), pgBranch(cmd.SqlBlock))
+	if cmd.label != "" {
+		return fmt.Sprintf("<<%s>>\n%s %s;", cmd.label, s, cmd.label)
+	}
+	return s + ";"
 }
 
 func (cmd *WhileCmd) MsSql() string {
-	return fmt.Sprintf("WHILE%sBEGIN\n%sEND", cmd.condition, cmd.SqlBlock.MsSql())
+	return fmt.Sprintf("WHILE %s\n%s", exprSql(cmd.Condition, false), msBranch(cmd.SqlBlock))
 }
 
-func parseWhile(doc *SqlDocument) (SqlStatement, error) {
+func parseWhile(doc *SqlDocument, blk *SqlBlock) (SqlStatement, error) {
 	while := &WhileCmd{}
 	token, _ := doc.tk.Peek()
 	if !strings.EqualFold(token, "while") {
-		return nil, fmt.Errorf("error")
+		return nil, doc.parseError("while")
 	}
 	doc.tk.Pop()
 
-	conditionStart := doc.tk.pos
+	condition, err := parseExpr(doc)
+	if err != nil {
+		return nil, err
+	}
+	while.Condition = condition
+	doc.loops = append(doc.loops, while)
+	defer func() { doc.loops = doc.loops[:len(doc.loops)-1] }()
+	if len(doc.loops) > 1 { //嵌套时每一层都加上标签
+		for i, v := range doc.loops {
+			v.label = fmt.Sprintf("loop%d", i+1)
+		}
+	}
+	sqlBlock, err := parseBranch(doc, blk)
+	if err != nil {
+		return nil, err
+	}
+	while.SqlBlock = sqlBlock
+	return while, nil
+}
+
+//BreakCmd break => exit; continue => continue;
+type BreakCmd struct {
+	Span
+	Continue bool
+	keyword  Token
+	loop     *WhileCmd
+}
+
+func isBreak(doc *SqlDocument) bool {
+	return doc.peekWord("break") || doc.peekWord("continue")
+}
+
+func parseBreak(doc *SqlDocument) (SqlStatement, error) {
+	cmd := &BreakCmd{}
+	cmd.keyword, _ = doc.tk.PopToken()
+	cmd.Continue = strings.EqualFold(cmd.keyword.Text, "continue")
+	if len(doc.loops) == 0 {
+		return nil, doc.tk.errorAt(cmd.keyword, fmt.Errorf("%s outside of while loop", strings.ToLower(cmd.keyword.Text)))
+	}
+	cmd.loop = doc.loops[len(doc.loops)-1]
+	return cmd, nil
+}
+
+func (cmd *BreakCmd) PgSql() string {
+	s := "EXIT"
+	if cmd.Continue {
+		s = "CONTINUE"
+	}
+	if cmd.loop.label != "" {
+		s += " " + cmd.loop.label
+	}
+	return s + ";"
+}
+
+func (cmd *BreakCmd) MsSql() string {
+	return cmd.keyword.Text
+}
+
+//TryCatchCmd begin try ... end try begin catch ... end catch => begin ... exception when others then ... end;
+type TryCatchCmd struct {
+	Span
+	Try     *SqlBlock
+	Catch   *SqlBlock
+	context bool //catch中用到了error_line()等, 需要get stacked diagnostics取出pg_exception_context
+}
+
+func isTryCatch(doc *SqlDocument) bool {
+	defer doc.tk.Reset(doc.tk.Mark())
+	if !doc.peekWord("begin") {
+		return false
+	}
+	doc.tk.Pop()
+	return doc.peekWord("try")
+}
+
+func parseTryCatch(doc *SqlDocument) (SqlStatement, error) {
+	cmd := &TryCatchCmd{Try: &SqlBlock{}, Catch: &SqlBlock{}}
+	if _, err := doc.popKeyword("begin", "try"); err != nil {
+		return nil, err
+	}
+	if _, err := parseSqlBlock(doc, cmd.Try); err != nil {
+		return nil, err
+	}
+	if _, err := doc.popKeyword("try", "begin", "catch"); err != nil {
+		return nil, err
+	}
+	doc.catches = append(doc.catches, cmd)
+	defer func() { doc.catches = doc.catches[:len(doc.catches)-1] }()
+	if _, err := parseSqlBlock(doc, cmd.Catch); err != nil {
+		return nil, err
+	}
+	if err := doc.expect("catch"); err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
+
+func (cmd *TryCatchCmd) PgSql() string {
+	var s string
+	if cmd.context {
+		s = "DECLARE\nv_error_context text;\n"
+	}
+	s += fmt.Sprintf("BEGIN\n%s\nEXCEPTION WHEN OTHERS THEN\n", pgBranch(cmd.Try))
+	if cmd.context {
+		s += "GET STACKED DIAGNOSTICS v_error_context = PG_EXCEPTION_CONTEXT;\n"
+	}
+	return s + pgBranch(cmd.Catch) + "\nEND;"
+}
+
+func (cmd *TryCatchCmd) MsSql() string {
+	return fmt.Sprintf("BEGIN TRY\n%s\nEND TRY\nBEGIN CATCH\n%s\nEND CATCH", cmd.Try.MsSql(), cmd.Catch.MsSql())
+}
+
+//ReturnCmd return [expr], 只有标量函数有返回值, 存储过程的返回值在pgsql中去掉
+type ReturnCmd struct {
+	Span
+	Value   Expr
+	scalar  bool //在标量函数中
+	keyword Token
+}
+
+func isReturn(doc *SqlDocument) bool {
+	return doc.peekWord("return")
+}
+
+func parseReturn(doc *SqlDocument) (SqlStatement, error) {
+	cmd := &ReturnCmd{}
+	cmd.keyword, _ = doc.tk.PopToken()
+	if token, _ := doc.tk.PeekToken(); !isStatementEnd(token) {
+		value, err := parseExpr(doc)
+		if err != nil {
+			return nil, err
+		}
+		cmd.Value = value
+	}
+	cmd.scalar = doc.routine != nil && doc.routine.Returns != "table"
+	if cmd.Value != nil && !cmd.scalar {
+		doc.warn(cmd.keyword, "return value is not supported by pgsql, ignored")
+	}
+	return cmd, nil
+}
+
+func (cmd *ReturnCmd) PgSql() string {
+	if cmd.Value == nil || !cmd.scalar {
+		return "RETURN;"
+	}
+	w := newSqlWriter(cmd.Span, true)
+	w.write("RETURN")
+	cmd.Value.writeSql(w)
+	return w.String() + ";"
+}
+
+func (cmd *ReturnCmd) MsSql() string {
+	w := newSqlWriter(cmd.Span, false)
+	w.token(cmd.keyword)
+	if cmd.Value != nil {
+		cmd.Value.writeSql(w)
+	}
+	return w.String()
+}
+
+//PrintCmd print expr => raise notice '%', expr;
+type PrintCmd struct {
+	Span
+	Value   Expr
+	keyword Token
+}
+
+func isPrint(doc *SqlDocument) bool {
+	return doc.peekWord("print")
+}
+
+func parsePrint(doc *SqlDocument) (SqlStatement, error) {
+	cmd := &PrintCmd{}
+	cmd.keyword, _ = doc.tk.PopToken()
+	value, err := parseExpr(doc)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Value = value
+	return cmd, nil
+}
+
+func (cmd *PrintCmd) PgSql() string {
+	w := newSqlWriter(cmd.Span, true)
+	w.write("RAISE NOTICE '%',")
+	cmd.Value.writeSql(w)
+	return w.String() + ";"
+}
+
+func (cmd *PrintCmd) MsSql() string {
+	w := newSqlWriter(cmd.Span, false)
+	w.token(cmd.keyword)
+	cmd.Value.writeSql(w)
+	return w.String()
+}
+
+//RaiseErrorCmd raiserror(message, severity, state[, args]) [with log, nowait, seterror]
+//=> raise exception 'message', args; severity小于11时为notice或warning
+type RaiseErrorCmd struct {
+	Span
+	Message  Expr
+	Severity Expr
+	State    Expr
+	Args     []Expr
+	Options  []Token //with后面的选项, pgsql中去掉
+	keyword  Token
+	with     Token
+}
+
+func isRaiseError(doc *SqlDocument) bool {
+	return doc.peekWord("raiserror")
+}
+
+func parseRaiseError(doc *SqlDocument) (SqlStatement, error) {
+	cmd := &RaiseErrorCmd{}
+	cmd.keyword, _ = doc.tk.PopToken()
+	if err := doc.expect("("); err != nil {
+		return nil, err
+	}
+	exprs, err := parseExprList(doc)
+	if err != nil {
+		return nil, err
+	}
+	if len(exprs) < 3 {
+		return nil, doc.parseError(",")
+	}
+	if err := doc.expect(")"); err != nil {
+		return nil, err
+	}
+	cmd.Message, cmd.Severity, cmd.State, cmd.Args = exprs[0], exprs[1], exprs[2], exprs[3:]
+	if literal, ok := cmd.Message.(*Literal); ok && literal.Token.Kind == TokenNumber {
+		doc.warn(literal.Token, "raiserror message id %s is not supported by pgsql, raised as text", literal.Token.Text)
+	} else if !ok && len(cmd.Args) > 0 {
+		doc.warn(cmd.keyword, "raiserror arguments require a literal message in pgsql, ignored")
+	}
+
+	//with可能是下一条语句with cte as (...)的开头
+	mark := doc.tk.Mark()
+	if !doc.peekWord("with") {
+		return cmd, nil
+	}
+	cmd.with, _ = doc.tk.PopToken()
+	if !doc.peekWord("log") && !doc.peekWord("nowait") && !doc.peekWord("seterror") {
+		doc.tk.Reset(mark)
+		cmd.with = Token{}
+		return cmd, nil
+	}
 	for {
-		token, _ = doc.tk.Peek()
-		if strings.EqualFold(token, "begin") {
-			break
+		if !doc.peekWord("log") && !doc.peekWord("nowait") && !doc.peekWord("seterror") {
+			return nil, doc.parseError("log", "nowait", "seterror")
 		}
-		if token == "" {
-			return nil, fmt.Errorf("error")
+		option, _ := doc.tk.PopToken()
+		cmd.Options = append(cmd.Options, option)
+		if token, _ := doc.tk.Peek(); token != "," {
+			return cmd, nil
 		}
 		doc.tk.Pop()
 	}
-	while.condition = string(doc.tk.statement[conditionStart : doc.tk.pos-len(token)])
-	while.SqlBlock, _ = parseSqlBlock(doc, &SqlBlock{})
-	return while, nil
+}
+
+//严重级别0-9为notice, 10为warning, 其他以及不是常量时为exception
+func (cmd *RaiseErrorCmd) level() string {
+	if literal, ok := cmd.Severity.(*Literal); ok && literal.Token.Kind == TokenNumber {
+		if n, err := strconv.Atoi(literal.Token.Text); err == nil && n < 10 {
+			return "NOTICE"
+		} else if err == nil && n == 10 {
+			return "WARNING"
+		}
+	}
+	return "EXCEPTION"
+}
+
+func (cmd *RaiseErrorCmd) PgSql() string {
+	literal, ok := cmd.Message.(*Literal)
+	if !ok || literal.Token.Kind != TokenString {
+		return fmt.Sprintf("RAISE %s '%%', %s;", cmd.level(), pgExpr(cmd.Message, cmd.opts))
+	}
+	s := fmt.Sprintf("RAISE %s %s", cmd.level(), pgString(pgFormat(stringValue(literal.Token.Text))))
+	for _, v := range cmd.Args {
+		s += ", " + pgExpr(v, cmd.opts)
+	}
+	return s + ";"
+}
+
+func (cmd *RaiseErrorCmd) MsSql() string {
+	w := newSqlWriter(cmd.Span, false)
+	w.token(cmd.keyword)
+	w.append("(")
+	for i, v := range append([]Expr{cmd.Message, cmd.Severity, cmd.State}, cmd.Args...) {
+		if i > 0 {
+			w.write(",")
+		}
+		v.writeSql(w)
+	}
+	w.write(")")
+	if len(cmd.Options) > 0 {
+		w.token(cmd.with)
+		for i, v := range cmd.Options {
+			if i > 0 {
+				w.write(",")
+			}
+			w.token(v)
+		}
+	}
+	return w.String()
+}
+
+//raiserror的printf格式%[flag][width][.precision][h|l]type => pgsql raise的%, %%保持不变
+func pgFormat(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			sb.WriteByte(s[i])
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == '%' {
+			sb.WriteString("%%")
+			i++
+			continue
+		}
+		j := i + 1
+		for j < len(s) && strings.IndexByte("-+# 0123456789*.hl", s[j]) >= 0 {
+			j++
+		}
+		if j < len(s) && strings.IndexByte("disuoxX", s[j]) >= 0 {
+			sb.WriteByte('%')
+			i = j
+			continue
+		}
+		sb.WriteString("%%") //不是格式说明的%原样输出
+	}
+	return sb.String()
+}
+
+//ThrowCmd throw number, message, state => raise exception using errcode, message;
+//不带参数的throw只能在catch中, 重新抛出错误 => raise;
+type ThrowCmd struct {
+	Span
+	Number  Expr //不带参数时为nil
+	Message Expr
+	State   Expr
+	errcode string //5位的错误号作为sqlstate, 否则为P0001
+	keyword Token
+}
+
+//throw后面是参数, ;或者语句的结尾时才是throw语句, 否则是名字, 例如select x throw from t
+func isThrow(doc *SqlDocument) bool {
+	if !doc.peekWord("throw") {
+		return false
+	}
+	defer doc.tk.Reset(doc.tk.Mark())
+	doc.tk.Pop()
+	next, _ := doc.tk.PeekToken()
+	switch next.Kind {
+	case TokenNumber, TokenVariable, TokenEOF, TokenGo:
+		return true
+	}
+	return next.Text == ";" || strings.EqualFold(next.Text, "end")
+}
+
+func parseThrow(doc *SqlDocument) (SqlStatement, error) {
+	cmd := &ThrowCmd{}
+	cmd.keyword, _ = doc.tk.PopToken()
+	if token, _ := doc.tk.PeekToken(); isStatementEnd(token) {
+		if len(doc.catches) == 0 {
+			return nil, doc.tk.errorAt(cmd.keyword, fmt.Errorf("throw without arguments outside of catch block"))
+		}
+		return cmd, nil
+	}
+	exprs, err := parseExprList(doc)
+	if err != nil {
+		return nil, err
+	}
+	if len(exprs) != 3 {
+		return nil, doc.parseError(",")
+	}
+	cmd.Number, cmd.Message, cmd.State = exprs[0], exprs[1], exprs[2]
+	cmd.errcode = "P0001"
+	if literal, ok := cmd.Number.(*Literal); ok && literal.Token.Kind == TokenNumber && len(literal.Token.Text) == 5 {
+		cmd.errcode = literal.Token.Text
+	} else {
+		doc.warn(cmd.keyword, "error number %s is not a valid sqlstate, replaced with P0001", exprSql(cmd.Number, false))
+	}
+	return cmd, nil
+}
+
+func (cmd *ThrowCmd) PgSql() string {
+	if cmd.Number == nil {
+		return "RAISE;"
+	}
+	return fmt.Sprintf("RAISE EXCEPTION USING ERRCODE = '%s', MESSAGE = %s;", cmd.errcode, pgExpr(cmd.Message, cmd.opts))
+}
+
+func (cmd *ThrowCmd) MsSql() string {
+	w := newSqlWriter(cmd.Span, false)
+	w.token(cmd.keyword)
+	if cmd.Number != nil {
+		for i, v := range []Expr{cmd.Number, cmd.Message, cmd.State} {
+			if i > 0 {
+				w.write(",")
+			}
+			v.writeSql(w)
+		}
+	}
+	return w.String()
+}
+
+//IfCmd if condition statement [else statement], 语句可以是begin ... end. else if翻译为elsif
+type IfCmd struct {
+	Span
+	Condition Expr
+	Then      SqlStatement
+	Else      SqlStatement //没有else时为nil
+}
+
+func isIf(doc *SqlDocument) bool {
+	return doc.peekWord("if")
+}
+
+func parseIf(doc *SqlDocument, blk *SqlBlock) (SqlStatement, error) {
+	cmd := &IfCmd{}
+	doc.tk.Pop()
+	var err error
+	if cmd.Condition, err = parseExpr(doc); err != nil {
+		return nil, err
+	}
+	if cmd.Then, err = parseBranch(doc, blk); err != nil {
+		return nil, err
+	}
+	if doc.peekWord("else") {
+		doc.tk.Pop()
+		if cmd.Else, err = parseBranch(doc, blk); err != nil {
+			return nil, err
+		}
+	}
+	return cmd, nil
+}
+
+//if和else后面的一条语句
+func parseBranch(doc *SqlDocument, blk *SqlBlock) (SqlStatement, error) {
+	start, _ := doc.tk.PeekToken()
+	if start.Kind == TokenEOF || start.Kind == TokenGo || isEnd(start.Text) ||
+		strings.EqualFold(start.Text, "else") || strings.EqualFold(start.Text, "end") {
+		return nil, doc.parseError("statement")
+	}
+	return parseStatement(doc, blk)
+}
+
+//if ... then ... elsif ... else ... end if;
+func (cmd *IfCmd) PgSql() string {
+	s := fmt.Sprintf("IF %s THEN\n%s", pgExpr(cmd.Condition, cmd.opts), pgBranch(cmd.Then))
+	for v := cmd.Else; v != nil; {
+		elseIf, ok := v.(*IfCmd)
+		if !ok {
+			s += "\nELSE\n" + pgBranch(v)
+			break
+		}
+		s += fmt.Sprintf("\nELSIF %s THEN\n%s", pgExpr(elseIf.Condition, cmd.opts), pgBranch(elseIf.Then))
+		v = elseIf.Else
+	}
+	return s + "\nEND IF;"
+}
+
+func (cmd *IfCmd) MsSql() string {
+	s := fmt.Sprintf("IF %s\n%s", exprSql(cmd.Condition, false), msBranch(cmd.Then))
+	if cmd.Else != nil {
+		s += "\nELSE " + msBranch(cmd.Else)
+	}
+	return s
+}
+
+//begin ... end只输出其中的语句, pgsql中空的分支为null;
+func pgBranch(sqlStatement SqlStatement) string {
+	if blk, ok := sqlStatement.(*SqlBlock); ok {
+		if s := blk.body(true); s != "" {
+			return s
+		}
+		return "NULL;"
+	}
+	return withComments(sqlStatement, sqlStatement.PgSql())
+}
+
+func msBranch(sqlStatement SqlStatement) string {
+	if blk, ok := sqlStatement.(*SqlBlock); ok {
+		return "BEGIN\n" + blk.MsSql() + "\nEND"
+	}
+	return withComments(sqlStatement, sqlStatement.MsSql())
 }
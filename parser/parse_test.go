@@ -1,7 +1,9 @@
 package parser
 
 import (
+	"bytes"
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -15,7 +17,10 @@ values('xyz', 1)
 select * into t1 from t2 insert into t1 select * from t2
 `
 	doc := NewSqlDocument(s)
-	sql, _ := Parse(doc)
+	sql, err := Parse(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
 	fmt.Println(sql.PgSql())
 }
 
@@ -27,11 +32,236 @@ select * from t1
 end
 `
 	doc := NewSqlDocument(s)
-	sql, _ := Parse(doc)
+	sql, err := Parse(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
 	fmt.Println(sql.PgSql())
 	//fmt.Println(sql.MsSql())
 }
 
+func TestBreak(t *testing.T) {
+	s := `declare @n int, @m int
+while @n < 10
+begin
+	set @m = 0
+	while @m < @n
+	begin
+		if @m = 3 continue
+		set @m = @m + 1
+	end
+	if @n > 5 break
+end
+while @n > 0 set @n = @n - 1`
+	doc := NewSqlDocument(s)
+	if _, err := Parse(doc); err != nil {
+		t.Fatal(err)
+	}
+	expected := `<<loop1>>
+WHILE v_n < 10 LOOP
+v_m := 0;
+<<loop2>>
+WHILE v_m < v_n LOOP
+IF v_m = 3 THEN
+CONTINUE loop2;
+END IF;
+v_m := v_m + 1;
+END LOOP loop2;
+IF v_n > 5 THEN
+EXIT loop1;
+END IF;
+END LOOP loop1;`
+	if sql := doc.SqlStatements[1].PgSql(); sql != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, sql)
+	}
+	if sql := doc.SqlStatements[2].PgSql(); sql != "WHILE v_n > 0 LOOP\nv_n := v_n - 1;\nEND LOOP;" {
+		t.Errorf("got %s", sql)
+	}
+	if sql := doc.SqlStatements[2].MsSql(); sql != "WHILE @n > 0\nset @n = @n - 1" {
+		t.Errorf("got %s", sql)
+	}
+
+	_, err := Parse(NewSqlDocument("declare @n int\nif @n > 1 break"))
+	if err == nil || !strings.Contains(err.Error(), "break outside of while loop") {
+		t.Errorf("expected break outside of while loop error, got %v", err)
+	}
+}
+
+func TestIf(t *testing.T) {
+	s := `declare @n int
+if exists (select 1 from Orders where Id = @n)
+begin
+	update Orders set Flag = 1 where Id = @n
+end
+else if @n > 10
+	set @n = 1
+else
+	begin
+	end
+if @n is null exec dbo.log @n
+set @n = 2`
+	doc := NewSqlDocument(s)
+	if _, err := Parse(doc); err != nil {
+		t.Fatal(err)
+	}
+	expected := `IF exists (select 1 from Orders where Id = v_n) THEN
+update Orders set Flag = 1 where Id = v_n;
+ELSIF v_n > 10 THEN
+v_n := 1;
+ELSE
+NULL;
+END IF;`
+	if sql := doc.SqlStatements[1].PgSql(); sql != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, sql)
+	}
+	expected = `IF v_n is null THEN
+-- ERROR: line 11, column 15: unsupported statement
+-- exec dbo.log @n
+END IF;`
+	if sql := doc.SqlStatements[2].PgSql(); sql != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, sql)
+	}
+	if _, ok := doc.SqlStatements[3].(*SetCmd); !ok {
+		t.Errorf("expected SetCmd, got %T", doc.SqlStatements[3])
+	}
+	if len(doc.Warnings) != 1 || doc.Warnings[0].Line != 11 {
+		t.Errorf("wrong warnings: %v", doc.Warnings)
+	}
+	expected = "IF @n > 10\nset @n = 1\nELSE BEGIN\n\nEND"
+	if sql := doc.SqlStatements[1].(*IfCmd).Else.MsSql(); sql != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, sql)
+	}
+
+	for _, s := range []string{"if @n > 1", "if @n > 1 else set @n = 1", "if begin end"} {
+		if _, err := Parse(NewSqlDocument("declare @n int\n" + s)); err == nil {
+			t.Errorf("%s: expected error", s)
+		}
+	}
+}
+
+func TestTryCatch(t *testing.T) {
+	s := `declare @msg nvarchar(100), @line int
+BEGIN TRY
+	-- work
+	update Orders set Flag = 1
+END TRY
+BEGIN CATCH
+	select @msg = ERROR_MESSAGE(), @line = ERROR_LINE()
+	if XACT_STATE() <> 0 set @msg = 'x' + cast(ERROR_NUMBER() as varchar)
+END CATCH
+begin try set @line = 1 end try begin catch end catch`
+	doc := NewSqlDocument(s)
+	if _, err := Parse(doc); err != nil {
+		t.Fatal(err)
+	}
+	expected := `DECLARE
+v_error_context text;
+BEGIN
+-- work
+update Orders set Flag = 1;
+EXCEPTION WHEN OTHERS THEN
+GET STACKED DIAGNOSTICS v_error_context = PG_EXCEPTION_CONTEXT;
+select sqlerrm, cast(substring(v_error_context from 'line (\d+)') as int) into v_msg, v_line;
+IF XACT_STATE() <> 0 THEN
+v_msg := 'x' || cast(sqlstate as varchar);
+END IF;
+END;`
+	if sql := doc.SqlStatements[1].PgSql(); sql != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, sql)
+	}
+	expected = "BEGIN\nv_line := 1;\nEXCEPTION WHEN OTHERS THEN\nNULL;\nEND;"
+	if sql := doc.SqlStatements[2].PgSql(); sql != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, sql)
+	}
+	expected = "BEGIN TRY\nset @line = 1\nEND TRY\nBEGIN CATCH\n\nEND CATCH"
+	if sql := doc.SqlStatements[2].MsSql(); sql != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, sql)
+	}
+
+	for _, s := range []string{"begin try select 1 end", "begin try select 1 end try", "begin try select 1 end try begin catch end"} {
+		if _, err := Parse(NewSqlDocument(s)); err == nil {
+			t.Errorf("%s: expected error", s)
+		}
+	}
+}
+
+func TestRaise(t *testing.T) {
+	s := `declare @msg nvarchar(100), @a int
+print @msg
+RAISERROR(N'order %d not found in %-10s (100%%)', 16, 1, @a, 'x')
+raiserror('progress %5.2s', 0, 1, @msg) with nowait
+raiserror('warn', 10, 1)
+raiserror(@msg, 16, 1, @a)
+begin try
+	THROW 50001, 'bad thing', 1;
+end try
+begin catch
+	throw;
+end catch
+throw 123456, @msg, 1`
+	doc := NewSqlDocument(s)
+	if _, err := Parse(doc); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"RAISE NOTICE '%', v_msg;",
+		"RAISE EXCEPTION 'order % not found in % (100%%)', v_a, 'x';",
+		"RAISE NOTICE 'progress %', v_msg;",
+		"RAISE WARNING 'warn';",
+		"RAISE EXCEPTION '%', v_msg;",
+		"BEGIN\nRAISE EXCEPTION USING ERRCODE = '50001', MESSAGE = 'bad thing';\nEXCEPTION WHEN OTHERS THEN\nRAISE;\nEND;",
+		"RAISE EXCEPTION USING ERRCODE = 'P0001', MESSAGE = v_msg;",
+	}
+	for i, v := range expected {
+		if sql := doc.SqlStatements[i+1].PgSql(); sql != v {
+			t.Errorf("expected:\n%s\ngot:\n%s", v, sql)
+		}
+	}
+	if sql := doc.SqlStatements[3].MsSql(); sql != "raiserror('progress %5.2s', 0, 1, @msg) with nowait" {
+		t.Errorf("got %s", sql)
+	}
+	if len(doc.Warnings) != 2 {
+		t.Errorf("wrong warnings: %v", doc.Warnings)
+	}
+
+	for _, s := range []string{"throw", "raiserror('x', 16)", "raiserror('x', 16, 1) with log,", "throw 50001, 'x'"} {
+		if _, err := Parse(NewSqlDocument(s)); err == nil {
+			t.Errorf("%s: expected error", s)
+		}
+	}
+}
+
+func TestThrowAlias(t *testing.T) {
+	s := `select x throw from t
+select * from t1 throw where throw.a = 1
+begin try select 1 end try
+begin catch
+	select 1
+	throw
+end catch
+select @a
+throw 50001, 'x', 1`
+	doc := NewSqlDocument("declare @a int\n" + s)
+	if _, err := Parse(doc); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"select x as throw from t;",
+		"select * from t1 as throw where throw.a = 1;",
+	}
+	for i, v := range expected {
+		if sql := doc.SqlStatements[i+1].PgSql(); sql != v {
+			t.Errorf("expected:\n%s\ngot:\n%s", v, sql)
+		}
+	}
+	if len(doc.SqlStatements) != 6 {
+		t.Fatalf("expected 6 statements, got %d", len(doc.SqlStatements))
+	}
+	if _, ok := doc.SqlStatements[5].(*ThrowCmd); !ok {
+		t.Errorf("expected ThrowCmd, got %#v", doc.SqlStatements[5])
+	}
+}
+
 func TestSqlBlock(t *testing.T) {
 	s := `
 select * from t0
@@ -44,7 +274,10 @@ end
 select * from t3
 `
 	doc := NewSqlDocument(s)
-	sql, _ := Parse(doc)
+	sql, err := Parse(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
 	fmt.Println(sql.PgSql())
 }
 
@@ -60,7 +293,10 @@ end
 select * from t3
 `
 	doc := NewSqlDocument(s)
-	sql, _ := Parse(doc)
+	sql, err := Parse(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
 	fmt.Println(sql.PgSql())
 }
 
@@ -70,7 +306,10 @@ declare @i int
 set @i=1
 `
 	doc := NewSqlDocument(s)
-	sql, _ := Parse(doc)
+	sql, err := Parse(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
 	fmt.Println(sql.PgSql())
 }
 
@@ -92,7 +331,10 @@ set @i=1
 end
 `
 	doc := NewSqlDocument(s)
-	sql, _ := Parse(doc)
+	sql, err := Parse(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
 	fmt.Println(sql.PgSql())
 }
 
@@ -114,7 +356,10 @@ declare @date date
 set @date=dateadd(dd, 1, @date)
 `
 	doc := NewSqlDocument(s)
-	sql, _ := Parse(doc)
+	sql, err := Parse(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
 	fmt.Println(sql.PgSql())
 }
 
@@ -130,6 +375,472 @@ select * into t1 from t2 insert into t1 select * from t2
 end
 `
 	doc := NewSqlDocument(s)
-	sql, _ := Parse(doc)
+	sql, err := Parse(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println(sql.PgSql())
+}
+
+func TestParseError(t *testing.T) {
+	s := `
+declare @i int
+insert into t1(name,age)
+values 'xyz', 1
+`
+	doc := NewSqlDocument(s)
+	_, err := Parse(doc)
+	e, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("expected *ParseError, got %v", err)
+	}
+	if e.Line != 4 || e.Column != 8 || e.Token != "'xyz'" {
+		t.Fatalf("wrong position: %v", e)
+	}
+	if len(e.Expected) != 1 || e.Expected[0] != "(" {
+		t.Fatalf("wrong expected: %v", e.Expected)
+	}
+	fmt.Println(e)
+	fmt.Println(string(e.Stat()))
+}
+
+func TestParseErrorUndeclared(t *testing.T) {
+	s := `
+declare @i int
+set @j=1
+`
+	doc := NewSqlDocument(s)
+	_, err := Parse(doc)
+	e, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("expected *ParseError, got %v", err)
+	}
+	if e.Line != 3 || e.Column != 5 || e.Token != "@j" {
+		t.Fatalf("wrong position: %v", e)
+	}
+}
+
+func TestParseErrorUnterminated(t *testing.T) {
+	doc := NewSqlDocument("select 'abc from t1")
+	_, err := Parse(doc)
+	e, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("expected *ParseError, got %v", err)
+	}
+	if e.Offset != 7 || e.Err != ErrInvalidStatement {
+		t.Fatalf("wrong error: %v", e)
+	}
+}
+
+func TestParseErrorStat(t *testing.T) {
+	doc := NewSqlDocument("select 1\nset @x 1\nset @y 2")
+	doc.Recover = true
+	_, err := Parse(doc)
+	errs, ok := err.(ParseErrors)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("expected 2 errors, got %v", err)
+	}
+	if &errs[0].text[0] != &errs[1].text[0] {
+		t.Error("source copied for each error")
+	}
+	if stat := string(errs[1].Stat()); stat != "select 1\nset @x 1\nset @y << 2" {
+		t.Errorf("wrong stat:\n%s", stat)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	s := `
+declare @i int
+insert into t1(name,age)
+values 'xyz', 1
+set @i=1
+set @j=2
+begin
+insert into t2 values
+end
+select * from t3
+`
+	doc := NewSqlDocument(s)
+	doc.Recover = true
+	sql, err := Parse(doc)
+	errs, ok := err.(ParseErrors)
+	if !ok || len(errs) != 3 {
+		t.Fatalf("expected 3 errors, got %v %d", err, len(errs))
+	}
+	if errs[0].Line != 4 || errs[1].Line != 6 || errs[2].Line != 9 {
+		t.Fatalf("wrong lines: %v", errs)
+	}
+	if len(doc.SqlStatements) != 6 {
+		t.Fatalf("expected 6 statements, got %d", len(doc.SqlStatements))
+	}
+	unparsed, ok := doc.SqlStatements[1].(*UnparsedStatement)
+	if !ok || unparsed.Text != "insert into t1(name,age)\nvalues 'xyz', 1" {
+		t.Fatalf("wrong unparsed statement: %#v", doc.SqlStatements[1])
+	}
 	fmt.Println(sql.PgSql())
 }
+
+func benchScript(size int) string {
+	stmt := `
+select a, b from (select * from t1 union all
+select * from t2) x
+insert into t3(name,age)
+values('xyz', 1)
+begin
+declare @i int
+set @i=1
+select * into t4 from t5
+end
+while @date < '2019-07-16'
+begin
+insert into t1 select * from t2
+end
+`
+	var sb strings.Builder
+	for sb.Len() < size {
+		sb.WriteString(stmt)
+	}
+	return sb.String()
+}
+
+//吞吐量(MB/s)不随输入大小下降即为线性
+func BenchmarkParse(b *testing.B) {
+	for _, size := range []int{1 << 20, 4 << 20, 16 << 20} {
+		s := benchScript(size)
+		b.Run(fmt.Sprintf("%dMB", size>>20), func(b *testing.B) {
+			b.SetBytes(int64(len(s)))
+			for i := 0; i < b.N; i++ {
+				doc := NewSqlDocument(s)
+				if _, err := Parse(doc); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestUnsupportedStatement(t *testing.T) {
+	s := "select 1\nEXEC dbo.p 1, 'a'\ndrop table if exists t\ntruncate table t;\n;\nselect 3"
+	doc := NewSqlDocument(s)
+	if _, err := Parse(doc); err != nil {
+		t.Fatal(err)
+	}
+	expected := `select 1;
+-- ERROR: line 2, column 1: unsupported statement
+-- EXEC dbo.p 1, 'a'
+-- ERROR: line 3, column 1: unsupported statement
+-- drop table if exists t
+-- ERROR: line 4, column 1: unsupported statement
+-- truncate table t
+select 3;`
+	if sql := doc.PgSql(); sql != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, sql)
+	}
+	if len(doc.SqlStatements) != 5 || len(doc.Warnings) != 3 || doc.Warnings[1].String() != "line 3, column 1: unsupported statement drop, commented out" {
+		t.Errorf("wrong statements or warnings: %d, %v", len(doc.SqlStatements), doc.Warnings)
+	}
+}
+
+func TestUnsupportedMerge(t *testing.T) {
+	s := "merge t using s on t.id = s.id\nwhen matched then update set a = s.a\nwhen not matched then insert (a) values (s.a);\ngrant select, insert on t to u\nselect 1"
+	doc := NewSqlDocument(s)
+	if _, err := Parse(doc); err != nil {
+		t.Fatal(err)
+	}
+	expected := `-- ERROR: line 1, column 1: unsupported statement
+-- merge t using s on t.id = s.id
+-- when matched then update set a = s.a
+-- when not matched then insert (a) values (s.a)
+-- ERROR: line 4, column 1: unsupported statement
+-- grant select, insert on t to u
+select 1;`
+	if sql := doc.PgSql(); sql != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, sql)
+	}
+}
+
+func TestUnexpectedStatementStart(t *testing.T) {
+	for _, s := range []string{"select 1\nfoo bar", "select 1\n) x", "select 1\nend"} {
+		doc := NewSqlDocument(s)
+		_, err := Parse(doc)
+		if e, ok := err.(*ParseError); !ok || e.Line != 2 {
+			t.Errorf("%q: expected parse error at line 2, got %v", s, err)
+		}
+	}
+	doc := NewSqlDocument("select 1\noutput deleted.id\nselect 2")
+	doc.Recover = true
+	if _, err := Parse(doc); err == nil || len(doc.Warnings) != 0 {
+		t.Errorf("expected a parse error and no unsupported statement warning, got %v %v", err, doc.Warnings)
+	}
+}
+
+func TestStringIsNotKeyword(t *testing.T) {
+	s := `
+declare @s varchar
+set @s='begin'
+select * from t1
+`
+	doc := NewSqlDocument(s)
+	_, err := Parse(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.SqlStatements) != 3 {
+		t.Fatalf("expected 3 statements, got %d", len(doc.SqlStatements))
+	}
+	span := doc.SqlStatements[2].(*SelectStmt).Source()
+	if span.Start.Line != 4 || span.Start.Text != "select" || span.End.Text != "t1" {
+		t.Fatalf("wrong span: %v", span)
+	}
+}
+
+func TestComments(t *testing.T) {
+	s := `
+-- 查询t1
+select * /* all */ from t1 -- trailing
+/* outer /* nested */ still comment */
+begin
+-- inner
+select * from t2
+-- before end
+end
+while @i < 1
+begin
+select * from t3 -- loop
+end
+-- the end
+`
+	doc := NewSqlDocument(s)
+	sql, err := Parse(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `-- 查询t1
+select * /* all */ from t1; -- trailing
+DO $$
+BEGIN
+/* outer /* nested */ still comment */
+BEGIN
+-- inner
+select * from t2;
+-- before end
+END;
+WHILE v_i < 1 LOOP
+select * from t3; -- loop
+END LOOP;
+-- the end
+END $$;`
+	if sql.PgSql() != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, sql.PgSql())
+	}
+}
+
+func TestUnterminatedComment(t *testing.T) {
+	doc := NewSqlDocument("select * from t1 /* /* */")
+	_, err := Parse(doc)
+	e, ok := err.(*ParseError)
+	if !ok || e.Err != ErrUnterminatedComment || e.Offset != 17 {
+		t.Fatalf("expected unterminated comment error, got %v", err)
+	}
+}
+
+func TestStringLiteral(t *testing.T) {
+	s := `
+select N'中文', 'O''Brien', "col" from t1 where name = @name
+SET QUOTED_IDENTIFIER OFF
+select "it's", "say ""hi""" from t2
+`
+	doc := NewSqlDocument(s)
+	sql, err := Parse(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `select '中文', 'O''Brien', col from t1 where name = v_name;
+-- SET QUOTED_IDENTIFIER OFF
+select 'it''s', 'say "hi"' from t2;`
+	if sql.PgSql() != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, sql.PgSql())
+	}
+	if doc.SqlStatements[0].MsSql() != `select N'中文', 'O''Brien', "col" from t1 where name = @name` {
+		t.Fatalf("MsSql not verbatim: %s", doc.SqlStatements[0].MsSql())
+	}
+}
+
+func TestPgString(t *testing.T) {
+	cases := map[string]string{
+		"abc":       "'abc'",
+		"O'Brien":   "'O''Brien'",
+		`a\b`:       `'a\b'`,
+		"a\nb":      "'a\nb'",
+		"a\x01'\\b": `E'a\x01''\\b'`,
+	}
+	for value, expected := range cases {
+		if s := pgString(value); s != expected {
+			t.Errorf("pgString(%q): expected %s, got %s", value, expected, s)
+		}
+	}
+}
+
+func TestBracketIdentifier(t *testing.T) {
+	s := `select [Name], [user], [a"b], [2nd] from [dbo].[Order Details]`
+	cases := map[CasePolicy]string{
+		CaseFold:     `select name, "user", "a""b", "2nd" from dbo."order details";`,
+		CasePreserve: `select "Name", "user", "a""b", "2nd" from dbo."Order Details";`,
+	}
+	for policy, expected := range cases {
+		doc := NewSqlDocument(s)
+		doc.IdentifierCase = policy
+		if _, err := Parse(doc); err != nil {
+			t.Fatal(err)
+		}
+		if sql := doc.SqlStatements[0].PgSql(); sql != expected {
+			t.Errorf("expected:\n%s\ngot:\n%s", expected, sql)
+		}
+	}
+}
+
+func TestOperator(t *testing.T) {
+	s := `
+declare @i int, @s varchar(10)
+set @i += 2*3;
+set @s += 'x';
+set @i ^= 0x0F
+select a^b, $10.00, 0x1F from t1 where a !< 1.5e3 and b!=2;
+`
+	doc := NewSqlDocument(s)
+	sql, err := Parse(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `DO $$
+DECLARE
+v_i int;
+v_s varchar(10);
+BEGIN
+v_i := v_i + (2 * 3);
+v_s := v_s || 'x';
+v_i := v_i # x'0F'::int;
+select a # b, 10.00, x'1F'::int from t1 where a >= 1.5e3 and b != 2;
+END $$;`
+	if sql.PgSql() != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, sql.PgSql())
+	}
+	if sql := doc.SqlStatements[0].MsSql(); sql != "declare @i int, @s varchar(10)" {
+		t.Errorf("got %s", sql)
+	}
+	if n := len(doc.Batches[0].SqlVars); n != 2 {
+		t.Errorf("expected 2 variables, got %d", n)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	s := `
+declare @i int
+set @i=1
+GO
+select * from t1 where name = 'go'
+-- before go
+go 3 -- three times
+select go from t2
+GO`
+	doc := NewSqlDocument(s)
+	sql, err := Parse(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Batches) != 3 || doc.Batches[1].Go.Count != 3 || len(doc.Batches[0].SqlVars) == 0 {
+		t.Fatalf("wrong batches: %#v", doc.Batches)
+	}
+	expected := `DO $$
+DECLARE
+v_i int;
+BEGIN
+v_i := 1;
+END $$;
+select * from t1 where name = 'go';
+-- before go
+select * from t1 where name = 'go';
+-- before go
+select * from t1 where name = 'go';
+-- before go
+select go from t2;`
+	if sql.PgSql() != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, sql.PgSql())
+	}
+	if !strings.Contains(sql.MsSql(), "-- before go\nGO 3 -- three times\n") {
+		t.Fatalf("GO not kept in MsSql:\n%s", sql.MsSql())
+	}
+
+	var buf bytes.Buffer
+	if err := NewStreamingParser(strings.NewReader(s)).PgSql(&buf); err != nil {
+		t.Fatal(err)
+	}
+	expected = `DO $$
+DECLARE
+v_i int;
+BEGIN
+v_i := 1;
+END $$;
+select * from t1 where name = 'go';
+-- before go
+-- GO 3: the batch is not repeated in streaming mode
+select go from t2;`
+	if buf.String() != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+func TestBatchDeclare(t *testing.T) {
+	s := `select * from t0
+declare @i int
+while @i < 3
+begin
+	declare @s varchar(10)
+	if @i = 1
+	begin
+		declare @j int
+		set @j = @i
+	end
+	set @i += 1
+end`
+	doc := NewSqlDocument(s)
+	if _, err := Parse(doc); err != nil {
+		t.Fatal(err)
+	}
+	expected := `select * from t0;
+DO $$
+DECLARE
+v_i int;
+v_s varchar(10);
+v_j int;
+BEGIN
+WHILE v_i < 3 LOOP
+IF v_i = 1 THEN
+v_j := v_i;
+END IF;
+v_i := v_i + 1;
+END LOOP;
+END $$;`
+	if sql := doc.PgSql(); sql != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, sql)
+	}
+}
+
+func TestBatchScope(t *testing.T) {
+	doc := NewSqlDocument("declare @i int\nGO\nset @i=1")
+	_, err := Parse(doc)
+	if e, ok := err.(*ParseError); !ok || e.Line != 3 {
+		t.Fatalf("expected undeclared variable error, got %v", err)
+	}
+}
+
+func TestResultSetInDoBlock(t *testing.T) {
+	s := "select 1\ndeclare @i int = 1\nselect @i = 2\nselect * from t where id = @i\nif @i > 0 select 3\nGO\nselect 4"
+	doc := NewSqlDocument(s)
+	if _, err := Parse(doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Warnings) != 2 || doc.Warnings[0].Line != 4 || doc.Warnings[1].Line != 5 {
+		t.Errorf("wrong warnings: %v", doc.Warnings)
+	}
+}
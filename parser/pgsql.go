@@ -0,0 +1,250 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+//options 翻译选项, 每个文档一份, 解析时记录在语句的Span中, 不同goroutine中的文档互不影响.
+//为nil时使用内置的翻译
+type options struct {
+	rules          *RuleSet //名字已转成小写
+	identCase      CasePolicy
+	clusterIndexes bool
+}
+
+//没有规则时使用, 不能修改
+var noRules = NewRuleSet()
+
+func newOptions(r *RuleSet, identCase CasePolicy, clusterIndexes bool) *options {
+	return &options{rules: r.normalize(), identCase: identCase, clusterIndexes: clusterIndexes}
+}
+
+func (o *options) ruleSet() *RuleSet {
+	if o == nil {
+		return noRules
+	}
+	return o.rules
+}
+
+func (o *options) caseFold() bool {
+	return o == nil || o.identCase == CaseFold
+}
+
+func (o *options) cluster() bool {
+	return o != nil && o.clusterIndexes
+}
+
+//把单个token翻译成pgsql
+func pgToken(token Token, opts *options) string {
+	switch token.Kind {
+	case TokenString:
+		return pgString(stringValue(token.Text))
+	case TokenVariable:
+		return pgVar(token.Text)
+	case TokenIdent:
+		if target, ok := opts.ruleSet().identifier(token); ok {
+			return target
+		}
+		//mssql中不是保留字的limit, offset等在pgsql中要加双引号
+		name := strings.TrimLeft(token.Text, "#")
+		if pgReservedWords[strings.ToLower(name)] {
+			return pgIdent(strings.ToLower(name), opts)
+		}
+		return name
+	case TokenQuotedIdent:
+		if target, ok := opts.ruleSet().identifier(token); ok {
+			return target
+		}
+		return pgIdent(strings.TrimLeft(identValue(token.Text), "#"), opts)
+	case TokenNumber:
+		return pgNumber(token.Text)
+	case TokenOperator:
+		if op, ok := pgOperators[token.Text]; ok {
+			return op
+		}
+	}
+	return token.Text
+}
+
+//mssql运算符 => pgsql运算符
+var pgOperators = map[string]string{
+	"!<": ">=",
+	"!>": "<=",
+	"^":  "#",
+}
+
+//$10.00 => 10.00, 0x1F => x'1F'::int, 较长的二进制转成bytea
+func pgNumber(text string) string {
+	if text[0] == '$' {
+		return text[1:]
+	}
+	if len(text) < 2 || text[1] != 'x' && text[1] != 'X' {
+		return text
+	}
+	hex := text[2:]
+	switch {
+	case len(hex) == 0:
+		return "''::bytea"
+	case len(hex) <= 8:
+		return fmt.Sprintf("x'%s'::int", hex)
+	case len(hex) <= 16:
+		return fmt.Sprintf("x'%s'::bigint", hex)
+	}
+	if len(hex)%2 == 1 {
+		hex = "0" + hex
+	}
+	return fmt.Sprintf(`'\x%s'::bytea`, hex)
+}
+
+//CasePolicy 混合大小写标识符的转换方式
+type CasePolicy int
+
+const (
+	CaseFold     CasePolicy = iota //转成小写
+	CasePreserve                   //加双引号保留大小写
+)
+
+//pgsql标识符, 只在必要时(保留字, 特殊字符, 需要保留大小写)加双引号
+func pgIdent(name string, opts *options) string {
+	if opts.caseFold() {
+		name = strings.ToLower(name)
+	}
+	if needsQuote(name) {
+		return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+	}
+	return name
+}
+
+func needsQuote(name string) bool {
+	if name == "" || pgReservedWords[name] {
+		return true
+	}
+	for i := 0; i < len(name); i++ {
+		b := name[i]
+		if b >= 'a' && b <= 'z' || b == '_' || b >= 0x80 {
+			continue
+		}
+		if i > 0 && (b >= '0' && b <= '9' || b == '$') {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+//#t, ##t临时表. pgsql的临时表用create temp table创建, 名字不需要#
+func isTempName(text string) bool {
+	return strings.HasPrefix(identValue(text), "#")
+}
+
+//去掉[]或""并还原转义
+func identValue(text string) string {
+	if text == "" {
+		return text
+	}
+	if text[0] == '[' {
+		return strings.Replace(text[1:len(text)-1], "]]", "]", -1)
+	}
+	if text[0] == '"' {
+		return strings.Replace(text[1:len(text)-1], `""`, `"`, -1)
+	}
+	return text
+}
+
+//pgsql保留字, 用作标识符时必须加双引号
+var pgReservedWords = map[string]bool{}
+
+func init() {
+	for _, word := range strings.Fields(`
+all analyse analyze and any array as asc asymmetric authorization binary both case
+cast check collate collation column concurrently constraint create cross
+current_catalog current_date current_role current_schema current_time
+current_timestamp current_user default deferrable desc distinct do else end except
+false fetch for foreign freeze from full grant group having ilike in initially inner
+intersect into is isnull join lateral leading left like limit localtime
+localtimestamp natural not notnull null offset on only or order outer overlaps
+placing primary references returning right select session_user similar some
+symmetric system_user table tablesample then to trailing true union unique user
+using variadic verbose when where window with`) {
+		pgReservedWords[word] = true
+	}
+}
+
+//按token翻译原始语句, token之间的空白和注释保持不变. start为s在源语句中的起始位置
+func pgText(s string, start int, tokens []Token, opts *options) string {
+	var sb strings.Builder
+	pos := 0
+	for _, v := range tokens {
+		sb.WriteString(s[pos : v.Start-start])
+		sb.WriteString(pgToken(v, opts))
+		pos = v.End - start
+	}
+	sb.WriteString(s[pos:])
+	return sb.String()
+}
+
+//@name => v_name
+func pgVar(name string) string {
+	if strings.HasPrefix(name, "@") && !strings.HasPrefix(name, "@@") {
+		return "v_" + name[1:]
+	}
+	return name
+}
+
+//去掉字符串的N前缀和引号, 并还原两个连续的引号
+func stringValue(text string) string {
+	if text[0] == 'N' || text[0] == 'n' {
+		text = text[1:]
+	}
+	quote := text[:1]
+	return strings.Replace(text[1:len(text)-1], quote+quote, quote, -1)
+}
+
+//pgsql字符串, 含有控制字符时使用E''
+func pgString(value string) string {
+	escape := false
+	for i := 0; i < len(value); i++ {
+		if isControl(value[i]) {
+			escape = true
+			break
+		}
+	}
+	if !escape {
+		return "'" + strings.Replace(value, "'", "''", -1) + "'"
+	}
+
+	var sb strings.Builder
+	sb.WriteString("E'")
+	for i := 0; i < len(value); i++ {
+		switch b := value[i]; b {
+		case '\'':
+			sb.WriteString("''")
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\b':
+			sb.WriteString(`\b`)
+		case '\f':
+			sb.WriteString(`\f`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		default:
+			if isControl(b) {
+				sb.WriteString(fmt.Sprintf(`\x%02X`, b))
+			} else {
+				sb.WriteByte(b)
+			}
+		}
+	}
+	sb.WriteString("'")
+	return sb.String()
+}
+
+//换行和tab可以直接出现在pgsql字符串中
+func isControl(b byte) bool {
+	return b < 0x20 && b != '\n' && b != '\r' && b != '\t' || b == 0x7f
+}
@@ -0,0 +1,679 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+//CreateProcedureStmt create [or alter] proc[edure] name [@param type [= default] [output], ...] [with options] as body.
+//body为as后面到批处理结尾的语句, begin ... end为一个SqlBlock
+type CreateProcedureStmt struct {
+	Span
+	Name     *TableName
+	OrAlter  bool
+	Params   []*Param
+	Body     []SqlStatement
+	Result   *SelectStmt  //body最后返回结果集的select, pgsql中翻译为returns table的函数
+	Columns  []*ColumnDef //结果集的列, 类型未知时为nil, 翻译为returns setof record
+	keywords map[string]Token
+}
+
+//Param 存储过程和函数的参数
+type Param struct {
+	Name     Token
+	Type     string
+	Default  Expr
+	Output   bool //output, pgsql中为inout
+	ReadOnly bool //表值参数
+}
+
+func isCreateProcedure(doc *SqlDocument) bool {
+	defer doc.tk.Reset(doc.tk.Mark())
+	if !doc.peekWord("create") {
+		return false
+	}
+	doc.tk.Pop()
+	if doc.peekWord("or") {
+		doc.tk.Pop()
+		if !doc.peekWord("alter") {
+			return false
+		}
+		doc.tk.Pop()
+	}
+	return doc.peekWord("proc") || doc.peekWord("procedure")
+}
+
+func parseCreateProcedure(doc *SqlDocument) (SqlStatement, error) {
+	stmt := &CreateProcedureStmt{keywords: map[string]Token{}}
+	stmt.keywords["create"], _ = doc.tk.PopToken()
+	if doc.peekWord("or") {
+		stmt.keywords["or alter"], _ = doc.popKeyword("or", "alter")
+		stmt.OrAlter = true
+	}
+	stmt.keywords["procedure"], _ = doc.tk.PopToken()
+	var err error
+	if stmt.Name, err = parseTableName(doc); err != nil {
+		return nil, err
+	}
+	if stmt.Params, err = parseParams(doc); err != nil {
+		return nil, err
+	}
+	if err := parseRoutineOptions(doc); err != nil {
+		return nil, err
+	}
+	if doc.peekWord("for") {
+		if _, err := doc.popKeyword("for", "replication"); err != nil {
+			return nil, err
+		}
+	}
+	if err := doc.expect("as"); err != nil {
+		return nil, err
+	}
+	if stmt.Body, err = parseRoutineBody(doc, stmt.Params); err != nil {
+		return nil, err
+	}
+	statements, _ := unwrapBlock(stmt.Body)
+	if len(statements) > 0 {
+		if sel, ok := statements[len(statements)-1].(*SelectStmt); ok && isResultSet(sel) {
+			if hasOutput(stmt.Params) { //pgsql的过程不能返回结果集, 有inout参数的函数也不能returns table
+				doc.warn(sel.Span.Start, "procedure with output parameters cannot return a result set in pgsql, the select has no destination")
+			} else {
+				stmt.Result = sel
+				stmt.Columns = resultColumns(doc, sel, sel.Span.Start)
+			}
+		}
+	}
+	return stmt, nil
+}
+
+//@param [as] type [= default] [output] [readonly], ..., 可以用括号括起来
+func parseParams(doc *SqlDocument) ([]*Param, error) {
+	paren := false
+	if token, _ := doc.tk.Peek(); token == "(" {
+		doc.tk.Pop()
+		paren = true
+	}
+	var params []*Param
+	for {
+		token, _ := doc.tk.PeekToken()
+		if token.Kind != TokenVariable {
+			if paren && len(params) == 0 && token.Text == ")" {
+				break
+			}
+			if len(params) == 0 && !paren {
+				return nil, nil
+			}
+			return nil, doc.parseError("parameter")
+		}
+		param := &Param{Name: token}
+		doc.tk.Pop()
+		if doc.peekWord("as") {
+			doc.tk.Pop()
+		}
+		var err error
+		if param.Type, err = parseDataType(doc); err != nil {
+			return nil, err
+		}
+		if doc.peekWord("varying") { //cursor varying
+			doc.tk.Pop()
+		}
+		if token, _ := doc.tk.Peek(); token == "=" {
+			doc.tk.Pop()
+			if param.Default, err = parseExpr(doc); err != nil {
+				return nil, err
+			}
+		}
+		for {
+			if doc.peekWord("out") || doc.peekWord("output") {
+				param.Output = true
+			} else if doc.peekWord("readonly") {
+				param.ReadOnly = true
+			} else {
+				break
+			}
+			doc.tk.Pop()
+		}
+		params = append(params, param)
+		if token, _ := doc.tk.Peek(); token != "," {
+			break
+		}
+		doc.tk.Pop()
+	}
+	if paren {
+		if err := doc.expect(")"); err != nil {
+			return nil, err
+		}
+	}
+	return params, nil
+}
+
+//with recompile, encryption, execute as owner, pgsql中没有, 记录为警告
+func parseRoutineOptions(doc *SqlDocument) error {
+	if !doc.peekWord("with") {
+		return nil
+	}
+	doc.tk.Pop()
+	for {
+		option, _ := doc.tk.PeekToken()
+		if !isName(option) && option.Kind != TokenKeyword {
+			return doc.parseError("option")
+		}
+		doc.tk.Pop()
+		text := option.Text
+		if strings.EqualFold(option.Text, "execute") || strings.EqualFold(option.Text, "exec") {
+			if err := doc.expect("as"); err != nil {
+				return err
+			}
+			token, _ := doc.tk.PeekToken()
+			if !isName(token) && token.Kind != TokenKeyword && token.Kind != TokenString {
+				return doc.parseError("caller", "self", "owner")
+			}
+			doc.tk.Pop()
+			text += " as " + token.Text
+		}
+		doc.warn(option, "option %s is not supported by pgsql, ignored", text)
+		if token, _ := doc.tk.Peek(); token != "," {
+			return nil
+		}
+		doc.tk.Pop()
+	}
+}
+
+//as后面到批处理结尾的语句, 参数作为外层块的变量
+func parseRoutineBody(doc *SqlDocument, params []*Param) ([]SqlStatement, error) {
+	outer := paramBlock(params)
+	body := &SqlBlock{}
+	doc.blocks = append(doc.blocks, outer, body)
+	defer func() { doc.blocks = doc.blocks[:len(doc.blocks)-2] }()
+	for !doc.eof() {
+		start, _ := doc.tk.PeekToken()
+		sqlStatement, err := parseStatement(doc, body)
+		if err != nil {
+			if sqlStatement, err = doc.recover(start, err); err != nil {
+				return nil, err
+			}
+		}
+		if sqlStatement != nil {
+			body.addSqlStatement(sqlStatement)
+		}
+	}
+	if len(body.SqlStatements) == 0 {
+		return nil, doc.parseError("begin")
+	}
+	return body.SqlStatements, nil
+}
+
+//参数作为变量放在外层的块中
+func paramBlock(params []*Param) *SqlBlock {
+	blk := &SqlBlock{}
+	for _, v := range params {
+		blk.SqlVars = append(blk.SqlVars, SqlVar{name: v.Name.Text, typ: v.Type})
+	}
+	return blk
+}
+
+func hasOutput(params []*Param) bool {
+	for _, v := range params {
+		if v.Output {
+			return true
+		}
+	}
+	return false
+}
+
+//返回结果集的select, 不是select into和变量赋值
+func isResultSet(stmt *SelectStmt) bool {
+	if stmt.Into != nil {
+		return false
+	}
+	for _, v := range stmt.Columns {
+		if v.Var.Text != "" {
+			return false
+		}
+	}
+	return true
+}
+
+//结果集的列和类型, 不能推断时记录警告, 翻译为returns setof record
+func resultColumns(doc *SqlDocument, stmt *SelectStmt, at Token) []*ColumnDef {
+	columns := inferColumns(doc, stmt)
+	if columns == nil {
+		doc.warn(at, "cannot infer the names and types of the result columns, translated to returns setof record")
+	}
+	return columns
+}
+
+//从create table记录的列和带别名的表达式中查找结果集的列和类型, 有一列找不到时返回nil
+func inferColumns(doc *SqlDocument, stmt *SelectStmt) []*ColumnDef {
+	tables := tableNames(stmt.From)
+	var columns []*ColumnDef
+	for _, item := range stmt.Columns {
+		switch expr := item.Expr.(type) {
+		case *ColumnRef:
+			parts := expr.Parts
+			name := parts[len(parts)-1]
+			var found []*ColumnDef
+			for _, table := range tables {
+				if len(parts) > 1 && !isTable(table, parts[len(parts)-2]) {
+					continue
+				}
+				if name.Text == "*" {
+					found = append(found, doc.columns[tableKey(table)]...)
+				} else if column := doc.column(table, name); column != nil {
+					found = append(found, column)
+					break
+				}
+			}
+			if len(found) == 0 || name.Text == "*" && len(parts) == 1 && len(tables) > 1 {
+				return nil
+			}
+			if item.Alias.Text != "" {
+				found = []*ColumnDef{{Name: item.Alias, Type: found[0].Type}}
+			}
+			columns = append(columns, found...)
+		default:
+			typ := resultType(expr)
+			if item.Alias.Text == "" || typ == "" {
+				return nil
+			}
+			columns = append(columns, &ColumnDef{Name: item.Alias, Type: typ})
+		}
+	}
+	return columns
+}
+
+//表达式在pgsql中的类型, 不确定时返回空
+func resultType(expr Expr) string {
+	switch v := expr.(type) {
+	case *Literal:
+		switch {
+		case v.Token.Kind == TokenString:
+			return "text"
+		case v.Token.Kind != TokenNumber:
+			return ""
+		case strings.ContainsAny(v.Token.Text, ".eE"):
+			return "numeric"
+		}
+		return "int"
+	case *VariableRef:
+		return v.Type
+	case *Cast:
+		return v.Type
+	case *ParenExpr:
+		return resultType(v.Expr)
+	case *FuncCall:
+		if name := v.funcName(); name == "count" || name == "count_big" {
+			return "bigint"
+		}
+	}
+	return ""
+}
+
+//from中的表, 不包括子查询
+func tableNames(refs []TableRef) []*TableName {
+	var tables []*TableName
+	for _, ref := range refs {
+		switch v := ref.(type) {
+		case *TableName:
+			tables = append(tables, v)
+		case *JoinExpr:
+			tables = append(tables, tableNames([]TableRef{v.Left, v.Right})...)
+		case *ParenTable:
+			tables = append(tables, tableNames([]TableRef{v.Table})...)
+		}
+	}
+	return tables
+}
+
+//name是否为表名或者别名
+func isTable(table *TableName, name Token) bool {
+	if table.Alias.Text != "" {
+		return strings.EqualFold(identValue(table.Alias.Text), identValue(name.Text))
+	}
+	return strings.EqualFold(tableKey(table), identValue(name.Text))
+}
+
+//body只有一个begin ... end时去掉外层的块, 返回其中的语句和end前的注释
+func unwrapBlock(body []SqlStatement) ([]SqlStatement, []Token) {
+	if len(body) == 1 {
+		if blk, ok := body[0].(*SqlBlock); ok {
+			return blk.SqlStatements, blk.End.Leading
+		}
+	}
+	return body, nil
+}
+
+//create or replace procedure, 最后的select返回结果集时为returns table的函数
+func (stmt *CreateProcedureStmt) PgSql() string {
+	w := newSqlWriter(stmt.Span, true)
+	w.write("CREATE OR REPLACE")
+	if stmt.Result != nil {
+		w.write("FUNCTION")
+	} else {
+		w.write("PROCEDURE")
+	}
+	stmt.Name.writeSql(w)
+	writePgParams(w, stmt.Params)
+	if stmt.Result != nil {
+		w.newline()
+		writeReturnsTable(w, stmt.Columns)
+	}
+	statements, comments := unwrapBlock(stmt.Body)
+	w.append("\nLANGUAGE plpgsql\nAS $$\n")
+	if stmt.Result != nil && stmt.Columns != nil {
+		w.append("#variable_conflict use_column\n")
+	}
+	w.append(pgRoutineBody(statements, comments, stmt.Result))
+	w.append("\n$$;")
+	return w.String()
+}
+
+func (stmt *CreateProcedureStmt) MsSql() string {
+	w := newSqlWriter(stmt.Span, false)
+	writeKeyword(w, stmt.keywords, "create")
+	if stmt.OrAlter {
+		writeKeyword(w, stmt.keywords, "or alter")
+	}
+	writeKeyword(w, stmt.keywords, "procedure")
+	stmt.Name.writeSql(w)
+	for i, v := range stmt.Params {
+		if i > 0 {
+			w.write(",")
+		}
+		v.writeSql(w)
+	}
+	w.append("\nAS\n")
+	w.append(msRoutineBody(stmt.Body))
+	return w.String()
+}
+
+func (param *Param) writeSql(w *sqlWriter) {
+	w.token(param.Name)
+	w.write(param.Type)
+	if param.Default != nil {
+		w.write("=")
+		param.Default.writeSql(w)
+	}
+	if param.Output {
+		w.write("output")
+	}
+	if param.ReadOnly {
+		w.write("readonly")
+	}
+}
+
+//(inout v_a int default 0, ...), pgsql中有默认值的参数后面的参数也要有默认值, 没有时加default null
+func writePgParams(w *sqlWriter, params []*Param) {
+	w.append("(")
+	hasDefault := false
+	for i, v := range params {
+		if i > 0 {
+			w.write(",")
+		}
+		if v.Output {
+			w.write("INOUT")
+		}
+		w.token(v.Name)
+		w.write(pgType(v.Type, w.opts))
+		if v.Default != nil {
+			w.write("DEFAULT")
+			if b, ok := boolLiteral(v.Default); ok && pgType(v.Type, w.opts) == "boolean" {
+				w.write(b)
+			} else {
+				v.Default.writeSql(w)
+			}
+			hasDefault = true
+		} else if hasDefault {
+			w.write("DEFAULT NULL")
+		}
+	}
+	w.write(")")
+}
+
+//returns table (columns), 不知道类型时returns setof record
+func writeReturnsTable(w *sqlWriter, columns []*ColumnDef) {
+	if columns == nil {
+		w.write("RETURNS SETOF record")
+		return
+	}
+	w.write("RETURNS TABLE (")
+	for i, v := range columns {
+		if i > 0 {
+			w.write(",")
+		}
+		w.quietly(func() { w.token(v.Name) })
+		w.write(pgType(v.Type, w.opts))
+	}
+	w.write(")")
+}
+
+//declare部分和begin ... end, 声明的变量都放到declare部分, 包括if, while等里面声明的变量.
+//result为返回结果集的select, 翻译为return query
+func pgRoutineBody(statements []SqlStatement, comments []Token, result SqlStatement) string {
+	var s string
+	for _, v := range statements {
+		sql := v.PgSql()
+		if sql == "" {
+			continue
+		}
+		if v == result {
+			sql = "RETURN QUERY " + sql
+		}
+		s += withComments(v, sql) + "\n"
+	}
+	s += commentLines(comments)
+	return pgDeclare(statements) + "BEGIN\n" + s + "END;"
+}
+
+//as后面的语句, begin ... end保留begin和end
+func msRoutineBody(statements []SqlStatement) string {
+	if len(statements) == 1 {
+		if blk, ok := statements[0].(*SqlBlock); ok {
+			return "BEGIN\n" + blk.MsSql() + "\nEND"
+		}
+	}
+	return strings.TrimSuffix(msSqlList(statements), "\n")
+}
+
+//CreateFunctionStmt create [or alter] function name (params) returns type | table | @t table (columns) [with options] as body.
+//标量函数和多语句表值函数的body为begin ... end, 内联表值函数为return (select ...)
+type CreateFunctionStmt struct {
+	Span
+	Name     *TableName
+	OrAlter  bool
+	Params   []*Param
+	Returns  string       //标量函数的返回类型, 表值函数为table
+	Table    Token        //多语句表值函数返回的表变量
+	Columns  []*ColumnDef //表值函数返回的列, 内联表值函数不知道类型时为nil
+	Body     []SqlStatement
+	Select   *SelectStmt //内联表值函数的select
+	keywords map[string]Token
+}
+
+func isCreateFunction(doc *SqlDocument) bool {
+	defer doc.tk.Reset(doc.tk.Mark())
+	if !doc.peekWord("create") {
+		return false
+	}
+	doc.tk.Pop()
+	if doc.peekWord("or") {
+		doc.tk.Pop()
+		if !doc.peekWord("alter") {
+			return false
+		}
+		doc.tk.Pop()
+	}
+	return doc.peekWord("function")
+}
+
+func parseCreateFunction(doc *SqlDocument) (SqlStatement, error) {
+	stmt := &CreateFunctionStmt{keywords: map[string]Token{}}
+	stmt.keywords["create"], _ = doc.tk.PopToken()
+	if doc.peekWord("or") {
+		stmt.keywords["or alter"], _ = doc.popKeyword("or", "alter")
+		stmt.OrAlter = true
+	}
+	stmt.keywords["function"], _ = doc.tk.PopToken()
+	var err error
+	if stmt.Name, err = parseTableName(doc); err != nil {
+		return nil, err
+	}
+	if token, _ := doc.tk.Peek(); token != "(" {
+		return nil, doc.parseError("(")
+	}
+	if stmt.Params, err = parseParams(doc); err != nil {
+		return nil, err
+	}
+	if stmt.keywords["returns"], err = doc.popKeyword("returns"); err != nil {
+		return nil, err
+	}
+	if token, _ := doc.tk.PeekToken(); token.Kind == TokenVariable {
+		stmt.Table = token
+		doc.tk.Pop()
+		if err := doc.expect("table"); err != nil {
+			return nil, err
+		}
+		if stmt.Columns, _, err = parseTableElements(doc); err != nil {
+			return nil, err
+		}
+		if err := checkComputed(doc, stmt.Columns...); err != nil {
+			return nil, err
+		}
+		stmt.Returns = "table"
+	} else if doc.peekWord("table") {
+		doc.tk.Pop()
+		stmt.Returns = "table"
+	} else if stmt.Returns, err = parseDataType(doc); err != nil {
+		return nil, err
+	}
+	if err := parseRoutineOptions(doc); err != nil {
+		return nil, err
+	}
+	if err := doc.expect("as"); err != nil {
+		return nil, err
+	}
+	if stmt.Returns == "table" && stmt.Table.Text == "" {
+		token, _ := doc.tk.PeekToken()
+		doc.blocks = append(doc.blocks, paramBlock(stmt.Params))
+		stmt.Select, err = parseInlineSelect(doc)
+		doc.blocks = doc.blocks[:len(doc.blocks)-1]
+		if err != nil {
+			return nil, err
+		}
+		stmt.Columns = resultColumns(doc, stmt.Select, token)
+		return stmt, nil
+	}
+	doc.routine = stmt
+	defer func() { doc.routine = nil }()
+	if stmt.Body, err = parseRoutineBody(doc, stmt.Params); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+//return (select ...) 或者 return select ...
+func parseInlineSelect(doc *SqlDocument) (*SelectStmt, error) {
+	if err := doc.expect("return"); err != nil {
+		return nil, err
+	}
+	paren := false
+	if token, _ := doc.tk.Peek(); token == "(" {
+		doc.tk.Pop()
+		paren = true
+	}
+	stmt, err := parseSelectStmt(doc)
+	if err != nil {
+		return nil, err
+	}
+	stmt.opts = doc.opts //单独翻译, 不是parseStatement解析的语句
+	if paren {
+		if err := doc.expect(")"); err != nil {
+			return nil, err
+		}
+	}
+	return stmt, nil
+}
+
+//是否为多语句表值函数返回的表变量
+func (stmt *CreateFunctionStmt) isReturnTable(table *TableName) bool {
+	return stmt.Table.Text != "" && len(table.Parts) == 1 && strings.EqualFold(table.Parts[0].Text, stmt.Table.Text)
+}
+
+//返回的表变量在pgsql中翻译为return next和return query, 只能insert, 不能查询和修改
+func checkReturnTable(doc *SqlDocument, table *TableName) error {
+	if doc.routine != nil && doc.routine.isReturnTable(table) {
+		return doc.tk.errorAt(table.Parts[0], fmt.Errorf("returned table %s can only be inserted into", table.Parts[0].Text))
+	}
+	return nil
+}
+
+//内联表值函数为sql函数, 其余为plpgsql函数. 多语句表值函数中对表变量的insert翻译为return query或return next
+func (stmt *CreateFunctionStmt) PgSql() string {
+	w := newSqlWriter(stmt.Span, true)
+	w.write("CREATE OR REPLACE FUNCTION")
+	stmt.Name.writeSql(w)
+	writePgParams(w, stmt.Params)
+	w.newline()
+	if stmt.Returns == "table" {
+		writeReturnsTable(w, stmt.Columns)
+	} else {
+		w.write("RETURNS " + pgType(stmt.Returns, w.opts))
+	}
+	if stmt.Select != nil {
+		w.append("\nLANGUAGE sql\nAS $$\n")
+		w.append(stmt.Select.PgSql())
+		w.append("\n$$;")
+		return w.String()
+	}
+	w.append("\nLANGUAGE plpgsql\nAS $$\n")
+	if stmt.Table.Text != "" {
+		w.append("#variable_conflict use_column\n")
+	}
+	statements, comments := unwrapBlock(stmt.Body)
+	w.append(pgRoutineBody(statements, comments, nil))
+	w.append("\n$$;")
+	return w.String()
+}
+
+func (stmt *CreateFunctionStmt) MsSql() string {
+	w := newSqlWriter(stmt.Span, false)
+	writeKeyword(w, stmt.keywords, "create")
+	if stmt.OrAlter {
+		writeKeyword(w, stmt.keywords, "or alter")
+	}
+	writeKeyword(w, stmt.keywords, "function")
+	stmt.Name.writeSql(w)
+	w.append("(")
+	for i, v := range stmt.Params {
+		if i > 0 {
+			w.write(",")
+		}
+		v.writeSql(w)
+	}
+	w.write(")")
+	w.newline()
+	writeKeyword(w, stmt.keywords, "returns")
+	switch {
+	case stmt.Table.Text != "":
+		w.token(stmt.Table)
+		w.write("table (")
+		for i, v := range stmt.Columns {
+			if i > 0 {
+				w.write(",")
+			}
+			v.writeSql(w)
+		}
+		w.write(")")
+	case stmt.Returns == "table":
+		w.write("table")
+	default:
+		w.write(stmt.Returns)
+	}
+	w.append("\nAS\n")
+	if stmt.Select != nil {
+		w.append("RETURN (" + stmt.Select.MsSql() + ")")
+	} else {
+		w.append(msRoutineBody(stmt.Body))
+	}
+	return w.String()
+}
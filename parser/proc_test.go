@@ -0,0 +1,312 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCreateProcedure(t *testing.T) {
+	s := `create table Orders (Id int identity not null, Name nvarchar(50), Amount money)
+GO
+-- 按金额查询
+CREATE OR ALTER PROCEDURE [dbo].[usp_GetOrders]
+	@MinAmount money = 0,
+	@Name nvarchar(50)
+AS
+BEGIN
+	SET NOCOUNT ON;
+	declare @n int
+	declare @s varchar(10)
+	set @n = 1
+	-- result
+	select o.Id, Name, total = cast(Amount as decimal(18, 2)) from Orders o where Amount > @MinAmount
+END
+GO
+create proc usp_Count (@Total int output, @Flag bit = 1)
+with recompile
+as
+set @Total = 10
+select @Total = count(*) from Orders`
+	doc := NewSqlDocument(s)
+	if _, err := Parse(doc); err != nil {
+		t.Fatal(err)
+	}
+	expected := `-- 按金额查询
+CREATE OR REPLACE FUNCTION dbo.usp_getorders(v_MinAmount numeric(19,4) DEFAULT 0, v_Name varchar(50) DEFAULT NULL)
+RETURNS TABLE (Id int, Name varchar(50), total decimal(18, 2))
+LANGUAGE plpgsql
+AS $$
+#variable_conflict use_column
+DECLARE
+v_n int;
+v_s varchar(10);
+BEGIN
+-- SET NOCOUNT ON
+v_n := 1;
+-- result
+RETURN QUERY select o.Id, Name, cast(Amount as decimal(18, 2)) as total from Orders as o where Amount > v_MinAmount;
+END;
+$$;`
+	if sql := doc.Batches[1].PgSql(); sql != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, sql)
+	}
+	expected = `CREATE OR REPLACE PROCEDURE usp_Count(INOUT v_Total int, v_Flag boolean DEFAULT true)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+v_Total := 10;
+select count(*) into v_Total from Orders;
+END;
+$$;`
+	if sql := doc.Batches[2].PgSql(); sql != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, sql)
+	}
+	expected = `create proc usp_Count @Total int output, @Flag bit = 1
+AS
+set @Total = 10
+select @Total = count(*) from Orders`
+	if sql := doc.Batches[2].MsSql(); sql != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, sql)
+	}
+	if len(doc.Warnings) != 1 || doc.Warnings[0].Message != "option recompile is not supported by pgsql, ignored" {
+		t.Errorf("wrong warnings: %v", doc.Warnings)
+	}
+}
+
+func TestProcedureResultSet(t *testing.T) {
+	s := `create table Orders (Id int, Name nvarchar(50))
+GO
+create procedure p1 as select * from Orders
+GO
+create procedure p2 as select Id, getdate() from Orders`
+	doc := NewSqlDocument(s)
+	if _, err := Parse(doc); err != nil {
+		t.Fatal(err)
+	}
+	expected := `CREATE OR REPLACE FUNCTION p1()
+RETURNS TABLE (Id int, Name varchar(50))
+LANGUAGE plpgsql
+AS $$
+#variable_conflict use_column
+BEGIN
+RETURN QUERY select * from Orders;
+END;
+$$;`
+	if sql := doc.Batches[1].PgSql(); sql != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, sql)
+	}
+	expected = `CREATE OR REPLACE FUNCTION p2()
+RETURNS SETOF record
+LANGUAGE plpgsql
+AS $$
+BEGIN
+RETURN QUERY select Id, now() from Orders;
+END;
+$$;`
+	if sql := doc.Batches[2].PgSql(); sql != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, sql)
+	}
+	if len(doc.Warnings) != 1 || doc.Warnings[0].Line != 5 {
+		t.Errorf("wrong warnings: %v", doc.Warnings)
+	}
+}
+
+func TestInlineFunctionColumns(t *testing.T) {
+	s := `create function fn_Const(@n int)
+returns table
+as
+return (select @n as n, 'x' as name, 1.5 as rate, cast(null as date) as d, count(*) as total from t1)`
+	doc := NewSqlDocument(s)
+	if _, err := Parse(doc); err != nil {
+		t.Fatal(err)
+	}
+	expected := `CREATE OR REPLACE FUNCTION fn_Const(v_n int)
+RETURNS TABLE (n int, name text, rate numeric, d date, total bigint)
+LANGUAGE sql
+AS $$
+select v_n as n, 'x' as name, 1.5 as rate, cast(null as date) as d, count(*) as total from t1;
+$$;`
+	if sql := doc.SqlStatements[0].PgSql(); sql != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, sql)
+	}
+	if len(doc.Warnings) != 0 {
+		t.Errorf("unexpected warnings: %v", doc.Warnings)
+	}
+}
+
+func TestCreateProcedureErrors(t *testing.T) {
+	for _, s := range []string{
+		"create procedure p",
+		"create procedure p as",
+		"create procedure p @a as select 1",
+		"create procedure p (@a int as select 1",
+		"create procedure p with execute select 1",
+	} {
+		doc := NewSqlDocument(s)
+		if _, err := Parse(doc); err == nil {
+			t.Errorf("%s: expected error", s)
+		}
+	}
+}
+
+func TestCreateFunction(t *testing.T) {
+	s := `create table Orders (Id int, Name nvarchar(50), Amount money)
+GO
+CREATE FUNCTION dbo.fn_Double(@x int)
+RETURNS int
+WITH SCHEMABINDING
+AS
+BEGIN
+	declare @y int
+	set @y = @x * 2
+	RETURN @y
+END
+GO
+create function dbo.fn_Orders(@min money = 0)
+returns table
+as
+return (select Id, Name from Orders where Amount > @min)
+GO
+create function fn_Split(@s nvarchar(max))
+returns @t table (id int not null, val nvarchar(100))
+as
+begin
+	insert into @t (val, id) values ('a', 1), ('b', 2)
+	insert into @t select Id, Name from Orders
+	insert @t (id) values (3)
+	return
+end`
+	doc := NewSqlDocument(s)
+	if _, err := Parse(doc); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{`CREATE OR REPLACE FUNCTION dbo.fn_Double(v_x int)
+RETURNS int
+LANGUAGE plpgsql
+AS $$
+DECLARE
+v_y int;
+BEGIN
+v_y := v_x * 2;
+RETURN v_y;
+END;
+$$;`, `CREATE OR REPLACE FUNCTION dbo.fn_Orders(v_min numeric(19,4) DEFAULT 0)
+RETURNS TABLE (Id int, Name varchar(50))
+LANGUAGE sql
+AS $$
+select Id, Name from Orders where Amount > v_min;
+$$;`, `CREATE OR REPLACE FUNCTION fn_Split(v_s text)
+RETURNS TABLE (id int, val varchar(100))
+LANGUAGE plpgsql
+AS $$
+#variable_conflict use_column
+BEGIN
+id := 1;
+val := 'a';
+RETURN NEXT;
+id := 2;
+val := 'b';
+RETURN NEXT;
+RETURN QUERY select Id, Name from Orders;
+id := 3;
+val := NULL;
+RETURN NEXT;
+RETURN;
+END;
+$$;`}
+	for i, v := range expected {
+		if sql := doc.Batches[i+1].PgSql(); sql != v {
+			t.Errorf("expected:\n%s\ngot:\n%s", v, sql)
+		}
+	}
+	ms := `create function dbo.fn_Orders(@min money = 0)
+returns table
+AS
+RETURN (select Id, Name from Orders where Amount > @min)`
+	if sql := doc.SqlStatements[2].MsSql(); sql != ms {
+		t.Errorf("expected:\n%s\ngot:\n%s", ms, sql)
+	}
+	for _, stmt := range []string{"update @t set val = 'x'", "delete from @t where id = 1", "select * from Orders o join @t t on t.id = o.Id"} {
+		s := "create function f()\nreturns @t table (id int, val nvarchar(100))\nas\nbegin\n" + stmt + "\nreturn\nend"
+		_, err := Parse(NewSqlDocument(s))
+		if e, ok := err.(*ParseError); !ok || e.Line != 5 || e.Err.Error() != "returned table @t can only be inserted into" {
+			t.Errorf("%s: wrong error %v", stmt, err)
+		}
+	}
+}
+
+func TestReturn(t *testing.T) {
+	s := "create procedure p as\nbegin\nif 1 = 1 return\nreturn 1\nend"
+	doc := NewSqlDocument(s)
+	if _, err := Parse(doc); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(doc.PgSql(), "RETURN;\nEND;") {
+		t.Errorf("return value not dropped:\n%s", doc.PgSql())
+	}
+	if len(doc.Warnings) != 1 || doc.Warnings[0].Line != 4 {
+		t.Errorf("wrong warnings: %v", doc.Warnings)
+	}
+}
+
+func TestProcedureDeclare(t *testing.T) {
+	s := `create procedure p @id int, @total int output
+as
+begin
+	-- 初始值
+	declare @x int = 5, @flag bit = 1, @name nvarchar(20)
+	if @id > 0
+	begin
+		declare @y int = @x * 2
+		set @total = @y
+	end
+	while @x > 0
+	begin
+		declare @z int
+		set @z = @x
+		set @x -= 1
+	end
+	select Id, Name from Orders
+end`
+	doc := NewSqlDocument(s)
+	if _, err := Parse(doc); err != nil {
+		t.Fatal(err)
+	}
+	expected := `CREATE OR REPLACE PROCEDURE p(v_id int, INOUT v_total int)
+LANGUAGE plpgsql
+AS $$
+DECLARE
+v_x int;
+v_flag boolean;
+v_name varchar(20);
+v_y int;
+v_z int;
+BEGIN
+-- 初始值
+v_x := 5;
+v_flag := true;
+IF v_id > 0 THEN
+v_y := v_x * 2;
+v_total := v_y;
+END IF;
+WHILE v_x > 0 LOOP
+v_z := v_x;
+v_x := v_x - 1;
+END LOOP;
+select Id, Name from Orders;
+END;
+$$;`
+	if sql := doc.PgSql(); sql != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, sql)
+	}
+	if !strings.Contains(doc.MsSql(), "declare @x int = 5, @flag bit = 1, @name nvarchar(20)\n") {
+		t.Errorf("initial values not kept in MsSql:\n%s", doc.MsSql())
+	}
+	if len(doc.Warnings) != 1 || !strings.Contains(doc.Warnings[0].Message, "cannot return a result set") {
+		t.Errorf("wrong warnings: %v", doc.Warnings)
+	}
+
+	if _, err := Parse(NewSqlDocument("declare @x int = ")); err == nil {
+		t.Error("expected error")
+	}
+}
@@ -0,0 +1,126 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+//RuleSet 用户定义的翻译规则, PgSql()先查规则再用内置的翻译. 名字不区分大小写
+type RuleSet struct {
+	//函数名 => pgsql函数名或者模板, 模板中$1, $2...为参数, 例如"fn_GetBizDate": "$2 || $1".
+	//函数名可以带schema, 不带时匹配任意schema
+	Functions map[string]string `json:"functions" yaml:"functions"`
+	//mssql类型 => pgsql类型, 目标不带长度时保留原来的长度, 例如"nvarchar": "varchar"
+	Types map[string]string `json:"types" yaml:"types"`
+	//表名, 列名等标识符 => pgsql标识符
+	Identifiers map[string]string `json:"identifiers" yaml:"identifiers"`
+}
+
+func NewRuleSet() *RuleSet {
+	return &RuleSet{Functions: map[string]string{}, Types: map[string]string{}, Identifiers: map[string]string{}}
+}
+
+//LoadRules 从文件读取规则, .json为json格式, 其余按yaml解析
+func LoadRules(filename string) (*RuleSet, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	format := "yaml"
+	if strings.EqualFold(filepath.Ext(filename), ".json") {
+		format = "json"
+	}
+	r, err := ParseRules(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return r, nil
+}
+
+//ParseRules 解析json或yaml格式的规则
+func ParseRules(data []byte, format string) (*RuleSet, error) {
+	r := NewRuleSet()
+	var err error
+	switch strings.ToLower(format) {
+	case "json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(r)
+	case "yaml", "yml":
+		err = yaml.UnmarshalStrict(data, r)
+	default:
+		return nil, fmt.Errorf("unknown rule format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+//复制规则, 名字转成小写. r为nil时返回空的规则
+func (r *RuleSet) normalize() *RuleSet {
+	active := NewRuleSet()
+	if r != nil {
+		for k, v := range r.Functions {
+			active.AddFunction(k, v)
+		}
+		for k, v := range r.Types {
+			active.AddType(k, v)
+		}
+		for k, v := range r.Identifiers {
+			active.AddIdentifier(k, v)
+		}
+	}
+	return active
+}
+
+//AddFunction 添加函数规则, target为新函数名或者模板
+func (r *RuleSet) AddFunction(name, target string) {
+	r.Functions[strings.ToLower(name)] = target
+}
+
+//AddType 添加类型规则, name可以带长度, 例如nvarchar(max)
+func (r *RuleSet) AddType(name, target string) {
+	r.Types[strings.ToLower(name)] = target
+}
+
+//AddIdentifier 添加标识符规则, name可以是[name]或者"name"
+func (r *RuleSet) AddIdentifier(name, target string) {
+	r.Identifiers[strings.ToLower(identValue(name))] = target
+}
+
+//函数规则的翻译, 先按带schema的名字查找. target中有括号或者参数时为模板, 否则只改函数名
+func (r *RuleSet) function(call *FuncCall) funcTranslator {
+	var parts []string
+	for _, v := range call.Name {
+		parts = append(parts, strings.ToLower(identValue(v.Text)))
+	}
+	target, ok := r.Functions[strings.Join(parts, ".")]
+	if !ok {
+		if target, ok = r.Functions[parts[len(parts)-1]]; !ok {
+			return nil
+		}
+	}
+	t := []byte(target)
+	for i := 0; i+1 < len(t); i++ {
+		if t[i] == '$' && isDigit(t[i+1]) {
+			t[i] = '%'
+		}
+	}
+	if templateArgs(string(t)) > 0 || strings.Contains(target, "(") {
+		return template(string(t))
+	}
+	return rename(target)
+}
+
+//标识符规则
+func (r *RuleSet) identifier(token Token) (string, bool) {
+	target, ok := r.Identifiers[strings.ToLower(identValue(token.Text))]
+	return target, ok
+}
@@ -0,0 +1,127 @@
+package parser
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRuleSet(t *testing.T) {
+	yml := `
+functions:
+  dbo.fn_GetBizDate: biz_date
+  fn_Concat: $2 || $1
+  getdate: clock_timestamp()
+types:
+  nvarchar: varchar
+  money: numeric(19, 4)
+identifiers:
+  Orders: order_header
+  "[Order Id]": order_id
+`
+	r, err := ParseRules([]byte(yml), "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]string{
+		"select dbo.fn_GetBizDate(@d), DBO.FN_CONCAT('a', b) from orders": "select biz_date(v_d), b || 'a' from order_header;",
+		"select getdate(), len(s) from t":                                 "select clock_timestamp(), length(rtrim(s)) from t;",
+		"select cast(a as nvarchar(10)), convert(money, b) from t":        "select cast(a as varchar(10)), cast(b as numeric(19, 4)) from t;",
+		"select [Order Id] from Orders o":                                 "select order_id from order_header as o;",
+		"select fn_Concat(a) from t":                                      "select fn_Concat(a) from t;",
+	}
+	for s, expected := range cases {
+		doc := NewSqlDocument(s)
+		doc.Rules = r
+		if _, err := Parse(doc); err != nil {
+			t.Fatal(err)
+		}
+		if sql := doc.SqlStatements[0].PgSql(); sql != expected {
+			t.Errorf("%s\nexpected:\n%s\ngot:\n%s", s, expected, sql)
+		}
+	}
+
+	if sql := parseOne(t, "select getdate() from Orders").PgSql(); sql != "select now() from Orders;" {
+		t.Errorf("rules used by another document: %s", sql)
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "rules.json")
+	data := `{"functions": {"fn_Add": "$1 + $2"}, "types": {"datetime": "timestamp(3)"}}`
+	if err := ioutil.WriteFile(filename, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := LoadRules(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.AddIdentifier("T1", "t_one")
+
+	s := "select fn_add(a, 1), cast(b as datetime) from t1"
+	doc := NewSqlDocument(s)
+	doc.Rules = r
+	if _, err := Parse(doc); err != nil {
+		t.Fatal(err)
+	}
+	expected := "select a + 1, cast(b as timestamp(3)) from t_one;"
+	if sql := doc.SqlStatements[0].PgSql(); sql != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, sql)
+	}
+
+	if _, err := ParseRules([]byte("functions: [a, b]"), "yaml"); err == nil {
+		t.Error("expected error for invalid rules")
+	}
+	if _, err := ParseRules([]byte("{}"), "xml"); err == nil {
+		t.Error("expected error for unknown format")
+	}
+	if _, err := ParseRules([]byte(`{"function": {"a": "b"}}`), "json"); err == nil {
+		t.Error("expected error for unknown json field")
+	}
+}
+
+func TestRulesPerDocument(t *testing.T) {
+	r := NewRuleSet()
+	r.AddFunction("getdate", "clock_timestamp()")
+	r.AddIdentifier("t1", "t_one")
+	s := "select getdate(), [Name] from t1"
+	cases := []struct {
+		rules    *RuleSet
+		policy   CasePolicy
+		expected string
+	}{
+		{r, CasePreserve, `select clock_timestamp(), "Name" from t_one;`},
+		{nil, CaseFold, "select now(), name from t1;"},
+	}
+	var wg sync.WaitGroup
+	for _, c := range cases {
+		c := c
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				p := NewStreamingParser(strings.NewReader(s))
+				p.Rules, p.IdentifierCase = c.rules, c.policy
+				stmt, err := p.Next()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if sql := stmt.PgSql(); sql != c.expected {
+					t.Errorf("expected:\n%s\ngot:\n%s", c.expected, sql)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
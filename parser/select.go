@@ -0,0 +1,990 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+//SelectStmt select语句, 集合运算的右边也是SelectStmt
+type SelectStmt struct {
+	Span
+	With     []*CommonTableExpr
+	Distinct bool
+	Top      *TopClause
+	Columns  []*SelectItem
+	Into     *TableName
+	From     []TableRef
+	Where    Expr
+	GroupBy  []Expr
+	Having   Expr
+	SetOps   []*SetOp //union, except, intersect
+	OrderBy  []*OrderItem
+	Offset   Expr
+	Fetch    Expr
+	keywords map[string]Token //子句的关键字, 保留原来的写法和注释
+}
+
+//CommonTableExpr with name(columns) as (select ...)
+type CommonTableExpr struct {
+	Name    Token
+	Columns []Token
+	Select  *SelectStmt
+}
+
+//TopClause top n, top (n) percent, top n with ties
+type TopClause struct {
+	Expr     Expr
+	Paren    bool
+	Percent  bool
+	WithTies bool
+	keywords map[string]Token
+}
+
+//SelectItem 选择列表中的一项, Alias为空时没有别名. Var不为空时是变量赋值@var = expr
+type SelectItem struct {
+	Expr  Expr
+	Alias Token
+	Var   Token
+	as    Token //as关键字
+	eq    bool  //alias = expr的写法
+}
+
+//SetOp 集合运算, Paren为true时右边用括号括起来
+type SetOp struct {
+	Op     Token //union, union all, except, intersect
+	Select *SelectStmt
+	Paren  bool
+}
+
+//OrderItem order by中的一项
+type OrderItem struct {
+	Expr Expr
+	Dir  Token //asc, desc, 为空时没有指定
+}
+
+//TableRef from中的表
+type TableRef interface {
+	node
+}
+
+//TableName 表名, 表变量或者表值函数
+type TableName struct {
+	Parts []Token //db.schema.name
+	Args  []Expr  //表值函数的参数, 为nil时不是函数
+	Alias Token
+	Hints []Expr //with (nolock)
+	as    Token
+	with  Token
+}
+
+//DerivedTable (select ...) alias
+type DerivedTable struct {
+	Select *SelectStmt
+	Alias  Token
+	as     Token
+}
+
+//ParenTable 括号中的join
+type ParenTable struct {
+	Table TableRef
+}
+
+//JoinExpr Left join Right on On, cross join和apply时On为nil
+type JoinExpr struct {
+	Left  TableRef
+	Type  Token //join, left outer join, cross apply, ...
+	Right TableRef
+	On    Expr
+	on    Token
+}
+
+func isSelect(doc *SqlDocument) bool {
+	return doc.peekWord("select") || doc.peekWord("with")
+}
+
+func parseSelect(doc *SqlDocument) (SqlStatement, error) {
+	return parseSelectStmt(doc)
+}
+
+//with ... select ... union select ... order by ...
+func parseSelectStmt(doc *SqlDocument) (*SelectStmt, error) {
+	stmt := &SelectStmt{keywords: map[string]Token{}}
+	if doc.peekWord("with") {
+		keyword, _ := doc.popKeyword("with")
+		stmt.keywords["with"] = keyword
+		ctes, err := parseCommonTableExprs(doc)
+		if err != nil {
+			return nil, err
+		}
+		stmt.With = ctes
+	}
+	if err := parseQuerySpec(doc, stmt); err != nil {
+		return nil, err
+	}
+
+	for doc.peekWord("union") || doc.peekWord("except") || doc.peekWord("intersect") {
+		op, _ := doc.tk.PopToken()
+		doc.popOptional(&op, "all")
+		setOp := &SetOp{Op: op}
+		if token, _ := doc.tk.Peek(); token == "(" {
+			doc.tk.Pop()
+			sub, err := parseSelectStmt(doc)
+			if err != nil {
+				return nil, err
+			}
+			if err := doc.expect(")"); err != nil {
+				return nil, err
+			}
+			setOp.Select = sub
+			setOp.Paren = true
+		} else {
+			sub := &SelectStmt{keywords: map[string]Token{}}
+			if err := parseQuerySpec(doc, sub); err != nil {
+				return nil, err
+			}
+			setOp.Select = sub
+		}
+		stmt.SetOps = append(stmt.SetOps, setOp)
+	}
+
+	if doc.peekWord("order") {
+		keyword, err := doc.popKeyword("order", "by")
+		if err != nil {
+			return nil, err
+		}
+		stmt.keywords["order by"] = keyword
+		if stmt.OrderBy, err = parseOrderItems(doc); err != nil {
+			return nil, err
+		}
+	}
+	if len(stmt.OrderBy) > 0 && doc.peekWord("offset") {
+		stmt.keywords["offset"], _ = doc.tk.PopToken()
+		expr, err := parseExpr(doc)
+		if err != nil {
+			return nil, err
+		}
+		stmt.Offset = expr
+		if stmt.keywords["rows"], err = doc.popRows(); err != nil {
+			return nil, err
+		}
+		if doc.peekWord("fetch") {
+			keyword, _ := doc.tk.PopToken()
+			if !doc.popOptional(&keyword, "next") && !doc.popOptional(&keyword, "first") {
+				return nil, doc.parseError("next", "first")
+			}
+			stmt.keywords["fetch"] = keyword
+			expr, err := parseExpr(doc)
+			if err != nil {
+				return nil, err
+			}
+			stmt.Fetch = expr
+			keyword, err = doc.popRows()
+			if err != nil {
+				return nil, err
+			}
+			if !doc.popOptional(&keyword, "only") {
+				return nil, doc.parseError("only")
+			}
+			stmt.keywords["only"] = keyword
+		}
+	}
+	return stmt, nil
+}
+
+func parseCommonTableExprs(doc *SqlDocument) ([]*CommonTableExpr, error) {
+	var ctes []*CommonTableExpr
+	for {
+		cte := &CommonTableExpr{}
+		name, _ := doc.tk.PeekToken()
+		if !isName(name) {
+			return nil, doc.parseError("name")
+		}
+		cte.Name = name
+		doc.tk.Pop()
+		if token, _ := doc.tk.Peek(); token == "(" {
+			columns, err := parseNameList(doc)
+			if err != nil {
+				return nil, err
+			}
+			cte.Columns = columns
+		}
+		if err := doc.expect("as"); err != nil {
+			return nil, err
+		}
+		if err := doc.expect("("); err != nil {
+			return nil, err
+		}
+		sub, err := parseSelectStmt(doc)
+		if err != nil {
+			return nil, err
+		}
+		cte.Select = sub
+		if err := doc.expect(")"); err != nil {
+			return nil, err
+		}
+		ctes = append(ctes, cte)
+		if token, _ := doc.tk.Peek(); token != "," {
+			return ctes, nil
+		}
+		doc.tk.Pop()
+	}
+}
+
+//select ... from ... where ... group by ... having ...
+func parseQuerySpec(doc *SqlDocument, stmt *SelectStmt) error {
+	keyword, err := doc.popKeyword("select")
+	if err != nil {
+		return err
+	}
+	stmt.keywords["select"] = keyword
+	if doc.peekWord("distinct") || doc.peekWord("all") {
+		keyword, _ := doc.tk.PopToken()
+		stmt.keywords["distinct"] = keyword
+		stmt.Distinct = strings.EqualFold(keyword.Text, "distinct")
+	}
+	if doc.peekWord("top") {
+		top, err := parseTop(doc)
+		if err != nil {
+			return err
+		}
+		stmt.Top = top
+		if doc.peekWord("distinct") || doc.peekWord("all") {
+			token, _ := doc.tk.PeekToken()
+			return doc.tk.errorAt(token, fmt.Errorf("%s must come before top", strings.ToLower(token.Text)))
+		}
+	}
+
+	for {
+		item, err := parseSelectItem(doc)
+		if err != nil {
+			return err
+		}
+		stmt.Columns = append(stmt.Columns, item)
+		if token, _ := doc.tk.Peek(); token != "," {
+			break
+		}
+		doc.tk.Pop()
+	}
+
+	if doc.peekWord("into") {
+		stmt.keywords["into"], _ = doc.tk.PopToken()
+		table, err := parseTableName(doc)
+		if err != nil {
+			return err
+		}
+		stmt.Into = table
+	}
+	if doc.peekWord("from") {
+		stmt.keywords["from"], _ = doc.tk.PopToken()
+		if stmt.From, err = parseTableSources(doc); err != nil {
+			return err
+		}
+		defer doc.pushScope(tableNames(stmt.From))()
+	}
+	if doc.peekWord("where") {
+		stmt.keywords["where"], _ = doc.tk.PopToken()
+		if stmt.Where, err = parseExpr(doc); err != nil {
+			return err
+		}
+	}
+	if doc.peekWord("group") {
+		keyword, err := doc.popKeyword("group", "by")
+		if err != nil {
+			return err
+		}
+		stmt.keywords["group by"] = keyword
+		exprs, err := parseExprList(doc)
+		if err != nil {
+			return err
+		}
+		stmt.GroupBy = exprs
+	}
+	if doc.peekWord("having") {
+		stmt.keywords["having"], _ = doc.tk.PopToken()
+		expr, err := parseExpr(doc)
+		if err != nil {
+			return err
+		}
+		stmt.Having = expr
+	}
+	return nil
+}
+
+func parseTop(doc *SqlDocument) (*TopClause, error) {
+	top := &TopClause{keywords: map[string]Token{}}
+	top.keywords["top"], _ = doc.tk.PopToken()
+	if token, _ := doc.tk.Peek(); token == "(" {
+		doc.tk.Pop()
+		expr, err := parseExpr(doc)
+		if err != nil {
+			return nil, err
+		}
+		if err := doc.expect(")"); err != nil {
+			return nil, err
+		}
+		top.Expr = expr
+		top.Paren = true
+	} else {
+		token, _ := doc.tk.PeekToken()
+		if token.Kind != TokenNumber && token.Kind != TokenVariable {
+			return nil, doc.parseError("number")
+		}
+		top.Expr, _ = parsePrefix(doc)
+	}
+	if doc.peekWord("percent") {
+		top.keywords["percent"], _ = doc.tk.PopToken()
+		top.Percent = true
+	}
+	if doc.peekWord("with") {
+		keyword, err := doc.popKeyword("with", "ties")
+		if err != nil {
+			return nil, err
+		}
+		top.keywords["with ties"] = keyword
+		top.WithTies = true
+	}
+	return top, nil
+}
+
+//expr [as] alias, alias = expr
+func parseSelectItem(doc *SqlDocument) (*SelectItem, error) {
+	item := &SelectItem{}
+	if token, _ := doc.tk.PeekToken(); isName(token) || token.Kind == TokenVariable {
+		mark := doc.tk.Mark()
+		doc.tk.Pop()
+		if eq, _ := doc.tk.Peek(); eq != "=" {
+			doc.tk.Reset(mark)
+		} else if doc.tk.Pop(); token.Kind == TokenVariable {
+			item.Var = token
+		} else {
+			item.Alias = token
+			item.eq = true
+		}
+	}
+	expr, err := parseExpr(doc)
+	if err != nil {
+		return nil, err
+	}
+	item.Expr = expr
+	if !item.eq && item.Var.Text == "" {
+		item.as, item.Alias = parseAlias(doc)
+	}
+	if token, _ := doc.tk.PeekToken(); item.Alias.Text == "" && token.Kind == TokenString { //expr 'alias'
+		item.Alias = token
+		doc.tk.Pop()
+	}
+	return item, nil
+}
+
+//[as] alias, 没有别名时返回空token
+func parseAlias(doc *SqlDocument) (Token, Token) {
+	var as Token
+	mark := doc.tk.Mark()
+	if doc.peekWord("as") {
+		as, _ = doc.tk.PopToken()
+	}
+	token, _ := doc.tk.PeekToken()
+	if isName(token) && (as.Text != "" || !isThrow(doc)) || as.Text != "" && token.Kind == TokenString {
+		doc.tk.Pop()
+		return as, token
+	}
+	doc.tk.Reset(mark)
+	return Token{}, Token{}
+}
+
+//可以作为名字的token
+func isName(token Token) bool {
+	return token.Kind == TokenIdent || token.Kind == TokenQuotedIdent
+}
+
+//(name, name, ...)
+func parseNameList(doc *SqlDocument) ([]Token, error) {
+	if err := doc.expect("("); err != nil {
+		return nil, err
+	}
+	var names []Token
+	for {
+		token, _ := doc.tk.PeekToken()
+		if !isName(token) && token.Kind != TokenKeyword {
+			return nil, doc.parseError("name")
+		}
+		names = append(names, token)
+		doc.tk.Pop()
+		if token, _ := doc.tk.Peek(); token != "," {
+			break
+		}
+		doc.tk.Pop()
+	}
+	if err := doc.expect(")"); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+//db.schema.name, #temp, @table
+//可以作为表名的保留字
+var tableFuncs = map[string]bool{
+	"openquery":                      true,
+	"openrowset":                     true,
+	"openxml":                        true,
+	"opendatasource":                 true,
+	"containstable":                  true,
+	"freetexttable":                  true,
+	"semantickeyphrasetable":         true,
+	"semanticsimilaritytable":        true,
+	"semanticsimilaritydetailstable": true,
+}
+
+func parseTableName(doc *SqlDocument) (*TableName, error) {
+	table := &TableName{}
+	for {
+		token, _ := doc.tk.PeekToken()
+		if token.Text == "." && len(table.Parts) > 0 { //db..name
+			table.Parts = append(table.Parts, Token{Start: token.Start, End: token.Start})
+			doc.tk.Pop()
+			continue
+		}
+		//保留字只能出现在.后面或者是openquery这样的表值函数
+		if !isName(token) && token.Kind != TokenVariable && (token.Kind != TokenKeyword || len(table.Parts) == 0 && !tableFuncs[strings.ToLower(token.Text)]) {
+			return nil, doc.parseError("table")
+		}
+		table.Parts = append(table.Parts, token)
+		doc.tk.Pop()
+		if dot, _ := doc.tk.Peek(); dot != "." {
+			return table, nil
+		}
+		doc.tk.Pop()
+	}
+}
+
+//table, table join table, ...
+func parseTableSources(doc *SqlDocument) ([]TableRef, error) {
+	var tables []TableRef
+	for {
+		table, err := parseTableSource(doc)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+		if token, _ := doc.tk.Peek(); token != "," {
+			return tables, nil
+		}
+		doc.tk.Pop()
+	}
+}
+
+//table [join table ...]
+func parseTableSource(doc *SqlDocument) (TableRef, error) {
+	left, err := parseTablePrimary(doc)
+	if err != nil {
+		return nil, err
+	}
+	for isJoin(doc) {
+		join := &JoinExpr{Left: left}
+		join.Type, _ = doc.tk.PopToken()
+		apply := false
+		switch strings.ToLower(join.Type.Text) {
+		case "left", "right", "full":
+			doc.popOptional(&join.Type, "outer")
+		case "cross", "outer":
+			apply = doc.popOptional(&join.Type, "apply")
+		}
+		if !apply && !strings.EqualFold(join.Type.Text, "join") && !doc.popOptional(&join.Type, "join") {
+			return nil, doc.parseError("join")
+		}
+		right, err := parseTablePrimary(doc)
+		if err != nil {
+			return nil, err
+		}
+		join.Right = right
+		if !apply && !strings.HasPrefix(strings.ToLower(join.Type.Text), "cross") {
+			if join.on, err = doc.popKeyword("on"); err != nil {
+				return nil, err
+			}
+			if join.On, err = parseExpr(doc); err != nil {
+				return nil, err
+			}
+		}
+		left = join
+	}
+	return left, nil
+}
+
+//当前是否为join, inner join, left outer join, cross apply等
+func isJoin(doc *SqlDocument) bool {
+	defer doc.tk.Reset(doc.tk.Mark())
+	token, _ := doc.tk.Peek()
+	switch strings.ToLower(token) {
+	case "join":
+		return true
+	case "inner", "left", "right", "full":
+		doc.tk.Pop()
+		doc.popOptional(&Token{}, "outer")
+		return doc.peekWord("join")
+	case "cross":
+		doc.tk.Pop()
+		return doc.peekWord("join") || doc.peekWord("apply")
+	case "outer":
+		doc.tk.Pop()
+		return doc.peekWord("apply")
+	}
+	return false
+}
+
+func parseTablePrimary(doc *SqlDocument) (TableRef, error) {
+	if token, _ := doc.tk.Peek(); token == "(" {
+		doc.tk.Pop()
+		if doc.peekWord("select") || doc.peekWord("with") {
+			table := &DerivedTable{}
+			sub, err := parseSelectStmt(doc)
+			if err != nil {
+				return nil, err
+			}
+			table.Select = sub
+			if err := doc.expect(")"); err != nil {
+				return nil, err
+			}
+			table.as, table.Alias = parseAlias(doc)
+			return table, nil
+		}
+		source, err := parseTableSource(doc)
+		if err != nil {
+			return nil, err
+		}
+		if err := doc.expect(")"); err != nil {
+			return nil, err
+		}
+		return &ParenTable{source}, nil
+	}
+
+	table, err := parseTableName(doc)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkReturnTable(doc, table); err != nil {
+		return nil, err
+	}
+	if token, _ := doc.tk.Peek(); token == "(" {
+		doc.tk.Pop()
+		table.Args = []Expr{}
+		if token, _ := doc.tk.Peek(); token != ")" {
+			if table.Args, err = parseExprList(doc); err != nil {
+				return nil, err
+			}
+		}
+		if err := doc.expect(")"); err != nil {
+			return nil, err
+		}
+	}
+	table.as, table.Alias = parseAlias(doc)
+	if err := parseTableHints(doc, table); err != nil {
+		return nil, err
+	}
+	return table, nil
+}
+
+//with (nolock, ...)
+func parseTableHints(doc *SqlDocument, table *TableName) error {
+	if !doc.peekWord("with") {
+		return nil
+	}
+	mark := doc.tk.Mark()
+	with, _ := doc.tk.PopToken()
+	if token, _ := doc.tk.Peek(); token != "(" { //下一条语句的with
+		doc.tk.Reset(mark)
+		return nil
+	}
+	doc.tk.Pop()
+	hints, err := parseExprList(doc)
+	if err != nil {
+		return err
+	}
+	if err := doc.expect(")"); err != nil {
+		return err
+	}
+	table.with = with
+	table.Hints = hints
+	return nil
+}
+
+//当前token是否为word
+func (doc *SqlDocument) peekWord(word string) bool {
+	token, _ := doc.tk.Peek()
+	return strings.EqualFold(token, word)
+}
+
+//弹出期望的token
+func (doc *SqlDocument) expect(text string) error {
+	_, err := doc.popKeyword(text)
+	return err
+}
+
+//依次弹出words, 返回合并后的关键字, 保留原来的大小写和第一个词前的注释
+func (doc *SqlDocument) popKeyword(words ...string) (Token, error) {
+	var keyword Token
+	for i, word := range words {
+		if i == 0 {
+			if !doc.peekWord(word) {
+				return Token{}, doc.parseError(word)
+			}
+			keyword, _ = doc.tk.PopToken()
+		} else if !doc.popOptional(&keyword, word) {
+			return Token{}, doc.parseError(word)
+		}
+	}
+	return keyword, nil
+}
+
+//下一个token为word时弹出并追加到keyword后面
+func (doc *SqlDocument) popOptional(keyword *Token, word string) bool {
+	if !doc.peekWord(word) {
+		return false
+	}
+	token, _ := doc.tk.PopToken()
+	keyword.Text += " " + token.Text
+	keyword.End = token.End
+	keyword.Trailing = token.Trailing
+	return true
+}
+
+//row或rows
+func (doc *SqlDocument) popRows() (Token, error) {
+	if doc.peekWord("row") || doc.peekWord("rows") {
+		return doc.tk.PopToken()
+	}
+	return Token{}, doc.parseError("rows")
+}
+
+func (stmt *SelectStmt) PgSql() string {
+	w := newSqlWriter(stmt.Span, true)
+	stmt.writeSql(w)
+	return w.String() + ";"
+}
+
+func (stmt *SelectStmt) MsSql() string {
+	w := newSqlWriter(stmt.Span, false)
+	stmt.writeSql(w)
+	return w.String()
+}
+
+//输出关键字, 没有记录时输出默认的写法. offset, only在mssql中不是保留字, 原样输出不加双引号
+func writeKeyword(w *sqlWriter, keywords map[string]Token, key string) {
+	if keyword, ok := keywords[key]; ok {
+		w.leading(keyword)
+		w.write(keyword.Text)
+		w.trailing(keyword)
+	} else {
+		w.write(key)
+	}
+}
+
+//pgsql没有top, 翻译成limit. 有集合运算时top只作用于第一个查询, 需要加括号
+func (stmt *SelectStmt) writeSql(w *sqlWriter) {
+	if w.pg && stmt.Into != nil { //select ... into t => create table t as select ..., plpgsql中select into是给变量赋值
+		w.write("create")
+		if stmt.Into.isTemp() {
+			w.write("temp")
+		}
+		w.write("table")
+		stmt.Into.writeSql(w)
+		w.write("as")
+	}
+	if len(stmt.With) > 0 {
+		writeKeyword(w, stmt.keywords, "with")
+		for i, v := range stmt.With {
+			if i > 0 {
+				w.write(",")
+			}
+			v.writeSql(w)
+		}
+	}
+	paren := w.pg && stmt.Top != nil && len(stmt.SetOps) > 0
+	if paren {
+		w.write("(")
+	}
+	writeKeyword(w, stmt.keywords, "select")
+	if keyword, ok := stmt.keywords["distinct"]; ok {
+		w.token(keyword)
+	}
+	if stmt.Top != nil && !w.pg {
+		stmt.Top.writeSql(w)
+	}
+	var vars []string
+	for i, v := range stmt.Columns {
+		if i > 0 {
+			w.write(",")
+		}
+		v.writeSql(w)
+		if v.Var.Text != "" {
+			vars = append(vars, pgVar(v.Var.Text))
+		}
+	}
+	if w.pg && len(vars) > 0 { //select @a = x => select x into v_a
+		w.write("into " + strings.Join(vars, ", "))
+	}
+	if stmt.Into != nil && !w.pg {
+		writeKeyword(w, stmt.keywords, "into")
+		stmt.Into.writeSql(w)
+	}
+	stmt.writeTableExpr(w)
+	if paren {
+		stmt.Top.writePgSql(w, stmt.writeCount)
+		w.write(")")
+	}
+	for _, v := range stmt.SetOps {
+		v.writeSql(w)
+	}
+	if len(stmt.OrderBy) > 0 {
+		writeKeyword(w, stmt.keywords, "order by")
+		writeOrderItems(w, stmt.OrderBy)
+	}
+	if stmt.Offset != nil {
+		writeKeyword(w, stmt.keywords, "offset")
+		stmt.Offset.writeSql(w)
+		writeKeyword(w, stmt.keywords, "rows")
+	}
+	if stmt.Fetch != nil {
+		writeKeyword(w, stmt.keywords, "fetch")
+		stmt.Fetch.writeSql(w)
+		writeKeyword(w, stmt.keywords, "only")
+	}
+	if w.pg && stmt.Top != nil && !paren {
+		stmt.Top.writePgSql(w, stmt.writeCount)
+	}
+}
+
+//from ... where ... group by ... having ...
+func (stmt *SelectStmt) writeTableExpr(w *sqlWriter) {
+	if len(stmt.From) > 0 {
+		writeKeyword(w, stmt.keywords, "from")
+		writeTableSources(w, stmt.From)
+	}
+	if stmt.Where != nil {
+		writeKeyword(w, stmt.keywords, "where")
+		stmt.Where.writeSql(w)
+	}
+	if len(stmt.GroupBy) > 0 {
+		writeKeyword(w, stmt.keywords, "group by")
+		writeExprList(w, stmt.GroupBy)
+	}
+	if stmt.Having != nil {
+		writeKeyword(w, stmt.keywords, "having")
+		stmt.Having.writeSql(w)
+	}
+}
+
+//top n percent时计算总行数的from子句, 有distinct或group by时从子查询中计算
+func (stmt *SelectStmt) writeCount(w *sqlWriter) {
+	w.quietly(func() {
+		if !stmt.Distinct && len(stmt.GroupBy) == 0 && stmt.Having == nil {
+			stmt.writeTableExpr(w)
+			return
+		}
+		w.write("from (select")
+		if stmt.Distinct {
+			w.write("distinct")
+		}
+		for i, v := range stmt.Columns {
+			if i > 0 {
+				w.write(",")
+			}
+			v.writeSql(w)
+		}
+		stmt.writeTableExpr(w)
+		w.write(") as t")
+	})
+}
+
+func writeTableSources(w *sqlWriter, tables []TableRef) {
+	for i, v := range tables {
+		if i > 0 {
+			w.write(",")
+		}
+		v.writeSql(w)
+	}
+}
+
+func (cte *CommonTableExpr) writeSql(w *sqlWriter) {
+	w.token(cte.Name)
+	if len(cte.Columns) > 0 {
+		writeNameList(w, cte.Columns)
+	}
+	w.write("as (")
+	cte.Select.writeSql(w)
+	w.write(")")
+}
+
+func writeNameList(w *sqlWriter, names []Token) {
+	w.append("(")
+	for i, v := range names {
+		if i > 0 {
+			w.write(",")
+		}
+		w.token(v)
+	}
+	w.write(")")
+}
+
+func (top *TopClause) writeSql(w *sqlWriter) {
+	writeKeyword(w, top.keywords, "top")
+	if top.Paren {
+		w.write("(")
+		top.Expr.writeSql(w)
+		w.write(")")
+	} else {
+		top.Expr.writeSql(w)
+	}
+	if top.Percent {
+		writeKeyword(w, top.keywords, "percent")
+	}
+	if top.WithTies {
+		writeKeyword(w, top.keywords, "with ties")
+	}
+}
+
+//top n => limit n
+//top n percent => limit (select ceil(count(*) * n / 100.0) from ...), count写入计算行数的from子句
+//top n with ties => fetch first n rows with ties
+func (top *TopClause) writePgSql(w *sqlWriter, count func(w *sqlWriter)) {
+	for _, key := range []string{"top", "percent", "with ties"} {
+		w.leading(top.keywords[key])
+	}
+	if top.WithTies {
+		w.write("fetch first")
+	} else {
+		w.write("limit")
+	}
+	switch {
+	case top.Percent:
+		w.write("(select ceil(count(*) *")
+		writeOperand(w, top.Expr, true)
+		w.write("/ 100.0)")
+		count(w)
+		w.write(")")
+	case top.WithTies:
+		if _, ok := top.Expr.(*Literal); ok {
+			top.Expr.writeSql(w)
+		} else {
+			w.write("(")
+			top.Expr.writeSql(w)
+			w.write(")")
+		}
+	default:
+		top.Expr.writeSql(w)
+	}
+	if top.WithTies {
+		w.write("rows with ties")
+	}
+	for _, key := range []string{"top", "percent", "with ties"} {
+		w.trailing(top.keywords[key])
+	}
+}
+
+func (item *SelectItem) writeSql(w *sqlWriter) {
+	if item.Var.Text != "" && !w.pg {
+		w.token(item.Var)
+		w.write("=")
+		item.Expr.writeSql(w)
+		return
+	}
+	if item.eq && !w.pg {
+		w.token(item.Alias)
+		w.write("=")
+		item.Expr.writeSql(w)
+		return
+	}
+	item.Expr.writeSql(w)
+	writeAlias(w, item.as, item.Alias)
+}
+
+//pgsql中总是使用as
+func writeAlias(w *sqlWriter, as, alias Token) {
+	if alias.Text == "" {
+		return
+	}
+	if as.Text != "" {
+		w.token(as)
+	} else if w.pg {
+		w.write("as")
+	}
+	if alias.Kind == TokenString && w.pg {
+		w.write(pgIdent(stringValue(alias.Text), w.opts))
+		return
+	}
+	w.token(alias)
+}
+
+//pgsql中带top的查询翻译成limit后要加括号
+func (op *SetOp) writeSql(w *sqlWriter) {
+	w.token(op.Op)
+	paren := op.Paren || w.pg && op.Select.Top != nil
+	if paren {
+		w.write("(")
+	}
+	op.Select.writeSql(w)
+	if paren {
+		w.write(")")
+	}
+}
+
+//#t临时表
+func (table *TableName) isTemp() bool {
+	return len(table.Parts) > 0 && isTempName(table.Parts[len(table.Parts)-1].Text)
+}
+
+func (table *TableName) writeSql(w *sqlWriter) {
+	for i, v := range table.Parts {
+		if i > 0 {
+			w.write(".")
+		}
+		w.token(v)
+	}
+	if table.Args != nil {
+		w.append("(")
+		writeExprList(w, table.Args)
+		w.write(")")
+	}
+	writeAlias(w, table.as, table.Alias)
+	if len(table.Hints) > 0 && !w.pg { //pgsql没有表提示
+		w.token(table.with)
+		w.write("(")
+		writeExprList(w, table.Hints)
+		w.write(")")
+	}
+}
+
+func (table *DerivedTable) writeSql(w *sqlWriter) {
+	w.write("(")
+	table.Select.writeSql(w)
+	w.write(")")
+	writeAlias(w, table.as, table.Alias)
+}
+
+func (table *ParenTable) writeSql(w *sqlWriter) {
+	w.write("(")
+	table.Table.writeSql(w)
+	w.write(")")
+}
+
+//cross apply => cross join lateral, outer apply => left join lateral ... on true
+func (join *JoinExpr) writeSql(w *sqlWriter) {
+	join.Left.writeSql(w)
+	typ := strings.ToLower(join.Type.Text)
+	switch {
+	case w.pg && typ == "cross apply":
+		w.leading(join.Type)
+		w.write("cross join lateral")
+	case w.pg && typ == "outer apply":
+		w.leading(join.Type)
+		w.write("left join lateral")
+	default:
+		w.token(join.Type)
+	}
+	join.Right.writeSql(w)
+	if join.On != nil {
+		w.token(join.on)
+		join.On.writeSql(w)
+	} else if w.pg && typ == "outer apply" {
+		w.write("on true")
+	}
+}
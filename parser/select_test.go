@@ -0,0 +1,149 @@
+package parser
+
+import (
+	"testing"
+)
+
+func parseOne(t *testing.T, s string) SqlStatement {
+	doc := NewSqlDocument(s)
+	if _, err := Parse(doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.SqlStatements) != 1 {
+		t.Fatalf("expected 1 statement, got %d", len(doc.SqlStatements))
+	}
+	return doc.SqlStatements[0]
+}
+
+func TestSelectStmt(t *testing.T) {
+	s := `with cte(id, total) as (select id, sum(amount) from orders group by id having sum(amount) > 10)
+select distinct top (10) o.id, total = c.total, case when o.flag = 1 then 'y' else 'n' end flag
+from dbo.[Orders] o with (nolock)
+left outer join cte c on c.id = o.id
+cross apply (select top 1 * from items i where i.order_id = o.id) x
+where o.id > 0 and o.name like 'a%'
+union all
+select 1, 2, 'n' from t2
+order by 1 desc
+offset 5 rows fetch next 10 rows only`
+	stmt, ok := parseOne(t, s).(*SelectStmt)
+	if !ok {
+		t.Fatal("expected SelectStmt")
+	}
+	if len(stmt.With) != 1 || !stmt.Distinct || stmt.Top == nil || !stmt.Top.Paren ||
+		len(stmt.Columns) != 3 || len(stmt.From) != 1 || stmt.Where == nil ||
+		len(stmt.SetOps) != 1 || len(stmt.OrderBy) != 1 || stmt.Offset == nil || stmt.Fetch == nil {
+		t.Fatalf("wrong select: %#v", stmt)
+	}
+	if stmt.Columns[1].Alias.Text != "total" || stmt.Columns[2].Alias.Text != "flag" {
+		t.Fatalf("wrong aliases: %#v", stmt.Columns)
+	}
+	join, ok := stmt.From[0].(*JoinExpr)
+	if !ok || join.Type.Text != "cross apply" {
+		t.Fatalf("wrong join: %#v", stmt.From[0])
+	}
+
+	expected := `with cte(id, total) as (select id, sum(amount) from orders group by id having sum(amount) > 10) ` +
+		`select distinct top (10) o.id, total = c.total, case when o.flag = 1 then 'y' else 'n' end flag ` +
+		`from dbo.[Orders] o with (nolock) left outer join cte c on c.id = o.id ` +
+		`cross apply (select top 1 * from items i where i.order_id = o.id) x ` +
+		`where o.id > 0 and o.name like 'a%' union all select 1, 2, 'n' from t2 ` +
+		`order by 1 desc offset 5 rows fetch next 10 rows only`
+	if stmt.MsSql() != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, stmt.MsSql())
+	}
+}
+
+func TestSelectPgSql(t *testing.T) {
+	cases := map[string]string{
+		"select [Name] = a.x, b 'Total Sum' from t with (nolock) outer apply f(a.id) y":         `select a.x as name, b as "total sum" from t left join lateral f(a.id) as y on true;`,
+		"select a.* from t1 a cross join t2, t3":                                                `select a.* from t1 as a cross join t2, t3;`,
+		"select * from (t1 join t2 on t1.id = t2.id)":                                           `select * from (t1 join t2 on t1.id = t2.id);`,
+		"select count(*) from t1 where x in (select y from t2)":                                 `select count(*) from t1 where x in (select y from t2);`,
+		"select limit, Offset, x.window from t order by a offset 1 rows fetch next 2 rows only": `select "limit", "offset", x."window" from t order by a offset 1 rows fetch next 2 rows only;`,
+	}
+	for s, expected := range cases {
+		if sql := parseOne(t, s).PgSql(); sql != expected {
+			t.Errorf("%s\nexpected:\n%s\ngot:\n%s", s, expected, sql)
+		}
+	}
+}
+
+func TestSelectComments(t *testing.T) {
+	s := `select a, -- first
+  b /* second */
+from t1 -- end`
+	stmt := parseOne(t, s)
+	expected := "select a, -- first\nb /* second */ from t1;"
+	if sql := stmt.PgSql(); sql != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, sql)
+	}
+}
+
+func TestTopPgSql(t *testing.T) {
+	cases := map[string]string{
+		"select top 10 * from t order by x":                                 "select * from t order by x limit 10;",
+		"select top (@n) a from t where a > 1":                              "select a from t where a > 1 limit v_n;",
+		"select top 10 percent * from t where a = 1 order by a":             "select * from t where a = 1 order by a limit (select ceil(count(*) * 10 / 100.0) from t where a = 1);",
+		"select distinct top 50 percent a from t":                           "select distinct a from t limit (select ceil(count(*) * 50 / 100.0) from (select distinct a from t) as t);",
+		"select top 5 with ties a from t order by a desc":                   "select a from t order by a desc fetch first 5 rows with ties;",
+		"select top (@n) with ties a from t order by a":                     "select a from t order by a fetch first (v_n) rows with ties;",
+		"select top 1 a from t union all select top 2 b from t2 order by 1": "(select a from t limit 1) union all (select b from t2 limit 2) order by 1;",
+		"select * from (select top 1 * from t order by a) as x":             "select * from (select * from t order by a limit 1) as x;",
+	}
+	for s, expected := range cases {
+		if sql := parseOne(t, s).PgSql(); sql != expected {
+			t.Errorf("%s\nexpected:\n%s\ngot:\n%s", s, expected, sql)
+		}
+	}
+}
+
+func TestSelectInto(t *testing.T) {
+	s := `declare @id int
+set @id = 1
+select * into #tmp from t5 where id = @id
+select a, b into dbo.t4 from #tmp
+select a into [#x] from t5
+select @id = max(id) from t5`
+	doc := NewSqlDocument(s)
+	if _, err := Parse(doc); err != nil {
+		t.Fatal(err)
+	}
+	expected := `DO $$
+DECLARE
+v_id int;
+BEGIN
+v_id := 1;
+create temp table tmp as select * from t5 where id = v_id;
+create table dbo.t4 as select a, b from tmp;
+create temp table x as select a from t5;
+select max(id) into v_id from t5;
+END $$;`
+	if sql := doc.PgSql(); sql != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, sql)
+	}
+	if sql := doc.SqlStatements[2].MsSql(); sql != "select * into #tmp from t5 where id = @id" {
+		t.Errorf("got %s", sql)
+	}
+	if sql := parseOne(t, "create table #t (a int)").PgSql(); sql != "create temp table t (\n    a int\n);" {
+		t.Errorf("got %s", sql)
+	}
+}
+
+func TestMalformedFrom(t *testing.T) {
+	cases := map[string]int{
+		"select a from where x = 1":               14,
+		"select a from order by a":                14,
+		"select a from t join on t.id":            21,
+		"select top 50 percent distinct a from t": 22,
+	}
+	for s, offset := range cases {
+		_, err := Parse(NewSqlDocument(s))
+		if e, ok := err.(*ParseError); !ok || e.Offset != offset {
+			t.Errorf("%s: expected parse error at %d, got %v", s, offset, err)
+		}
+	}
+	if sql := parseOne(t, "select * from sys.objects o, openquery(srv, 'select 1') q").PgSql(); sql != "select * from sys.objects as o, openquery(srv, 'select 1') as q;" {
+		t.Errorf("got %s", sql)
+	}
+}
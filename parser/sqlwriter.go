@@ -0,0 +1,130 @@
+package parser
+
+import (
+	"strings"
+)
+
+//sqlWriter 从语法树输出sql, 并保留token上的注释
+type sqlWriter struct {
+	sb     strings.Builder
+	pg     bool   //为true时输出pgsql
+	span   Span   //语句的范围, 首尾token上的注释由withComments输出
+	glued  bool   //下一次写入前不加空格
+	quiet  bool   //不输出注释
+	indent string //--注释换行后的缩进
+	opts   *options
+	pseudo map[string]Token //output中的inserted和deleted在pgsql中对应的表名
+}
+
+func newSqlWriter(span Span, pg bool) *sqlWriter {
+	return &sqlWriter{span: span, pg: pg, opts: span.opts}
+}
+
+func (w *sqlWriter) String() string {
+	return strings.TrimRight(w.sb.String(), " \n")
+}
+
+//写入s, 需要时在前面加空格
+func (w *sqlWriter) write(s string) {
+	if s == "" {
+		return
+	}
+	if w.glued {
+		w.glued = false
+		w.sb.WriteString(s)
+		return
+	}
+	if n := w.sb.Len(); n > 0 {
+		last := w.sb.String()[n-1]
+		if last != ' ' && last != '\n' && last != '(' && last != '.' &&
+			s[0] != ')' && s[0] != ',' && s[0] != '.' {
+			w.sb.WriteByte(' ')
+		}
+	}
+	w.sb.WriteString(s)
+}
+
+//紧接着写入s, 前面不加空格
+func (w *sqlWriter) append(s string) {
+	w.sb.WriteString(s)
+}
+
+//下一次写入紧接着前面的内容, 用于-x这样的一元运算符
+func (w *sqlWriter) glue() {
+	w.glued = true
+}
+
+//写入token, pgsql时翻译token
+func (w *sqlWriter) token(t Token) {
+	w.leading(t)
+	if w.pg {
+		w.write(pgToken(t, w.opts))
+	} else {
+		w.write(t.Text)
+	}
+	w.trailing(t)
+}
+
+//写入原始文本s, 起始位置为start, tokens为其中的token
+func (w *sqlWriter) raw(s string, start int, tokens []Token) {
+	if len(tokens) == 0 {
+		return
+	}
+	w.leading(tokens[0])
+	if w.pg {
+		w.write(pgText(s, start, tokens, w.opts))
+	} else {
+		w.write(s)
+	}
+	w.trailing(tokens[len(tokens)-1])
+}
+
+func (w *sqlWriter) leading(t Token) {
+	if w.quiet || t.Start == w.span.Start.Start {
+		return
+	}
+	for _, v := range t.Leading {
+		w.comment(v)
+	}
+}
+
+func (w *sqlWriter) trailing(t Token) {
+	if w.quiet || t.Start == w.span.End.Start {
+		return
+	}
+	for _, v := range t.Trailing {
+		w.comment(v)
+	}
+}
+
+//不输出注释地调用f, 用于重复输出的部分
+func (w *sqlWriter) quietly(f func()) {
+	quiet := w.quiet
+	w.quiet = true
+	f()
+	w.quiet = quiet
+}
+
+//--注释后面必须换行
+func (w *sqlWriter) comment(c Token) {
+	w.write(c.Text)
+	if strings.HasPrefix(c.Text, "--") {
+		w.sb.WriteString("\n" + w.indent)
+	}
+}
+
+//换行并按w.indent缩进, 已经换行时只调整缩进
+func (w *sqlWriter) newline() {
+	s := strings.TrimRight(w.sb.String(), " ")
+	w.sb.Reset()
+	w.sb.WriteString(s)
+	if !strings.HasSuffix(s, "\n") {
+		w.sb.WriteByte('\n')
+	}
+	w.sb.WriteString(w.indent)
+}
+
+//node 可以输出为sql的语法树节点
+type node interface {
+	writeSql(w *sqlWriter)
+}
@@ -0,0 +1,161 @@
+package parser
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+//StreamingParser 从io.Reader中逐条解析语句, 只保留当前语句的源语句和token.
+//批处理之间的GO以*GoCmd返回
+type StreamingParser struct {
+	Recover        bool       //同SqlDocument.Recover, 出错的语句以UnparsedStatement返回
+	Rules          *RuleSet   //同SqlDocument.Rules, 在第一次调用Next之前设置
+	IdentifierCase CasePolicy //同SqlDocument.IdentifierCase, 在第一次调用Next之前设置
+	ClusterIndexes bool       //同SqlDocument.ClusterIndexes, 在第一次调用Next之前设置
+	doc            *SqlDocument
+}
+
+func NewStreamingParser(r io.Reader) *StreamingParser {
+	return &StreamingParser{doc: &SqlDocument{tk: NewReaderTokener(bufio.NewReader(r))}}
+}
+
+//Next 返回下一条语句或*GoCmd, 全部解析完后返回io.EOF
+func (p *StreamingParser) Next() (SqlStatement, error) {
+	doc := p.doc
+	doc.Recover = p.Recover
+	if doc.opts == nil {
+		doc.opts = newOptions(p.Rules, p.IdentifierCase, p.ClusterIndexes)
+	}
+	for {
+		doc.tk.release()
+		doc.Errors = nil
+		doc.Warnings = nil
+		if doc.eof() {
+			token, _ := doc.tk.PeekToken()
+			doc.comments = token.Leading
+			if token.Kind == TokenGo {
+				doc.SqlVars = nil
+				doc.procedural = false
+				cmd := parseGo(doc)
+				if cmd.count() > 1 {
+					doc.warn(token, "GO %d: the batch is not repeated in streaming mode", cmd.Count)
+				}
+				return cmd, nil
+			}
+			return nil, io.EOF
+		}
+		if doc.tk.err != nil {
+			return nil, doc.tk.share(doc.tk.newParseError())
+		}
+		start, _ := doc.tk.PeekToken()
+		sqlStatement, err := parseStatement(doc, nil)
+		if err != nil {
+			sqlStatement, err = doc.recover(start, err)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if sqlStatement != nil {
+			doc.checkResultSets(sqlStatement)
+			return sqlStatement, nil
+		}
+	}
+}
+
+//Warnings 最近一次返回的语句的警告
+func (p *StreamingParser) Warnings() []*Warning {
+	return p.doc.Warnings
+}
+
+//Comments 最近一次返回*GoCmd或io.EOF时, 前面的注释
+func (p *StreamingParser) Comments() []Token {
+	return p.doc.comments
+}
+
+//PgSql 把剩下的语句翻译后逐条写入w, 不缓存整个批处理. 变量都在语句之前声明时输出与SqlDocument.PgSql相同,
+//否则在已经输出begin之后声明的变量放到嵌套的declare ... begin ... end中. GO n不能重复输出, 只输出一次并加上注释, Next返回*GoCmd时记录警告.
+//出错时先写入已经翻译的部分再返回错误
+func (p *StreamingParser) PgSql(w io.Writer) error {
+	out := &streamWriter{w: bufio.NewWriter(w)}
+	for {
+		sqlStatement, err := p.Next()
+		if err != nil && err != io.EOF {
+			out.w.Flush()
+			return err
+		}
+		cmd, ok := sqlStatement.(*GoCmd)
+		if err == io.EOF || ok {
+			out.endBatch(cmd, p.Comments())
+			if err == io.EOF {
+				break
+			}
+			continue
+		}
+		out.statement(sqlStatement)
+	}
+	return out.w.Flush()
+}
+
+//streamWriter 逐条输出语句, 只记录当前批处理的DO块状态
+type streamWriter struct {
+	w       *bufio.Writer
+	written bool            //已经有输出, 下一次输出前换行
+	do      bool            //已经输出DO $$
+	begun   bool            //当前块已经输出begin
+	declare bool            //正在输出declare部分
+	nested  int             //begin之后再声明变量时嵌套的块数
+	seen    map[string]bool //批处理中已经声明的变量
+}
+
+func (out *streamWriter) line(s string) {
+	if s == "" {
+		return
+	}
+	if out.written {
+		out.w.WriteString("\n")
+	}
+	out.w.WriteString(s)
+	out.written = true
+}
+
+func (out *streamWriter) statement(sqlStatement SqlStatement) {
+	if !out.do && isProcedural([]SqlStatement{sqlStatement}) {
+		out.line("DO $$")
+		out.do, out.begun, out.declare, out.nested, out.seen = true, false, false, 0, map[string]bool{}
+	}
+	if out.do {
+		if s := pgDeclareVars([]SqlStatement{sqlStatement}, out.seen); s != "" {
+			if !out.declare {
+				if out.begun {
+					out.nested++
+				}
+				out.line("DECLARE")
+				out.declare, out.begun = true, false
+			}
+			out.line(strings.TrimSuffix(s, "\n"))
+		}
+	}
+	s := strings.TrimSuffix(pgSqlList([]SqlStatement{sqlStatement}), "\n")
+	if s != "" && out.do && !out.begun {
+		out.line("BEGIN")
+		out.declare, out.begun = false, true
+	}
+	out.line(s)
+}
+
+func (out *streamWriter) endBatch(cmd *GoCmd, comments []Token) {
+	if out.do && !out.begun {
+		out.line("BEGIN")
+	}
+	out.line(strings.TrimSuffix(commentLines(comments), "\n"))
+	if out.do {
+		out.line(strings.TrimSuffix(strings.Repeat("END;\n", out.nested), "\n"))
+		out.line("END $$;")
+	}
+	if cmd.count() > 1 {
+		out.line(fmt.Sprintf("-- GO %d: the batch is not repeated in streaming mode", cmd.count()))
+	}
+	out.do = false
+}
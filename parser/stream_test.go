@@ -0,0 +1,277 @@
+package parser
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+//把s重复n次, 不在内存中生成整个脚本
+type repeatReader struct {
+	s   string
+	n   int
+	pos int
+}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	if r.n == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.s[r.pos:])
+	r.pos += n
+	if r.pos == len(r.s) {
+		r.pos = 0
+		r.n--
+	}
+	return n, nil
+}
+
+func TestStreamingParser(t *testing.T) {
+	s := `
+-- 查询t1
+select * from t1;
+declare @i int
+set @i=1
+begin
+select * from t2
+end
+while @i < 10 begin select * from t2 end
+insert into t3(name,age)
+values('xyz', 1)
+-- 结尾
+`
+	doc := NewSqlDocument(s)
+	if _, err := Parse(doc); err != nil {
+		t.Fatal(err)
+	}
+	p := NewStreamingParser(strings.NewReader(s))
+	var n int
+	for {
+		_, err := p.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		n++
+	}
+	if n != len(doc.SqlStatements) {
+		t.Fatalf("expected %d statements, got %d", len(doc.SqlStatements), n)
+	}
+
+	var buf bytes.Buffer
+	if err := NewStreamingParser(strings.NewReader(s)).PgSql(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != doc.PgSql() {
+		t.Fatalf("expected\n%s\ngot\n%s", doc.PgSql(), buf.String())
+	}
+}
+
+func TestStreamingParserPgSql(t *testing.T) {
+	s := `select * from t0
+declare @i int
+set @i = 1
+-- 后声明的变量
+declare @s varchar(10)
+set @s = 'x'
+GO
+declare @j int
+set @j = 2
+set @x 1`
+	var buf bytes.Buffer
+	err := NewStreamingParser(strings.NewReader(s)).PgSql(&buf)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	expected := `select * from t0;
+DO $$
+DECLARE
+v_i int;
+BEGIN
+v_i := 1;
+DECLARE
+-- 后声明的变量
+v_s varchar(10);
+BEGIN
+v_s := 'x';
+END;
+END $$;
+DO $$
+DECLARE
+v_j int;
+BEGIN
+v_j := 2;`
+	if buf.String() != expected {
+		t.Fatalf("expected\n%s\ngot\n%s", expected, buf.String())
+	}
+}
+
+func TestStreamingParserRecover(t *testing.T) {
+	s := "select * from t1\nset @x 1\nselect * from t2"
+	p := NewStreamingParser(strings.NewReader(s))
+	p.Recover = true
+	var a []string
+	for {
+		sqlStatement, err := p.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		a = append(a, sqlStatement.MsSql())
+	}
+	if len(a) != 3 || a[1] != "set @x 1" {
+		t.Fatalf("unexpected statements %q", a)
+	}
+}
+
+func TestStreamingParserErrStat(t *testing.T) {
+	s := "select * from t1\nset @x 1\nselect * from t2\nset @y 2\nselect * from t3"
+	p := NewStreamingParser(strings.NewReader(s))
+	p.Recover = true
+	var errs []*ParseError
+	for {
+		sqlStatement, err := p.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v, ok := sqlStatement.(*UnparsedStatement); ok {
+			errs = append(errs, v.Err)
+		}
+	}
+	if len(errs) != 2 {
+		t.Fatalf("expected 2 errors, got %d", len(errs))
+	}
+	//release之后错误引用的源语句不变
+	for i, v := range []string{"set @x << 1", "set @y << 2"} {
+		if stat := string(errs[i].Stat()); !strings.Contains(stat, v) {
+			t.Errorf("expected %q in:\n%s", v, stat)
+		}
+	}
+}
+
+func TestStreamingParserBacktrack(t *testing.T) {
+	//回溯时丢弃的错误不引用缓存, release时不用复制
+	p := NewStreamingParser(strings.NewReader("select top (1) a from t where x = 1\nselect 2"))
+	if _, err := p.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if p.doc.tk.shared {
+		t.Error("statement buffer is shared without a returned error")
+	}
+}
+
+func TestStreamingParserGoCount(t *testing.T) {
+	p := NewStreamingParser(strings.NewReader("select 1\ngo 3\nselect 2"))
+	p.Next()
+	if cmd, err := p.Next(); err != nil || cmd.(*GoCmd).Count != 3 {
+		t.Fatalf("expected GO 3, got %v %v", cmd, err)
+	}
+	if w := p.Warnings(); len(w) != 1 || w[0].Line != 2 || w[0].Message != "GO 3: the batch is not repeated in streaming mode" {
+		t.Errorf("unexpected warnings %v", w)
+	}
+}
+
+func TestStreamingParserWarnings(t *testing.T) {
+	s := "create index ix on t (a) with (online = on)\nselect * from t"
+	p := NewStreamingParser(strings.NewReader(s))
+	var counts []int
+	for {
+		if _, err := p.Next(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		counts = append(counts, len(p.Warnings()))
+	}
+	if len(counts) != 2 || counts[0] != 1 || counts[1] != 0 {
+		t.Fatalf("unexpected warning counts %v", counts)
+	}
+}
+
+func TestStreamingParserResultSetInDoBlock(t *testing.T) {
+	s := "declare @i int = 1\nselect * from t\nGO\nselect 2"
+	p := NewStreamingParser(strings.NewReader(s))
+	var counts []int
+	for {
+		if _, err := p.Next(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		counts = append(counts, len(p.Warnings()))
+	}
+	if len(counts) != 4 || counts[1] != 1 || counts[3] != 0 {
+		t.Fatalf("unexpected warning counts %v", counts)
+	}
+}
+
+func TestStreamingParserBounded(t *testing.T) {
+	stmt := `
+select a, b from (select * from t1 union all
+select * from t2) x
+/* comment */
+begin
+declare @i int
+set @i=1
+end
+`
+	r := &repeatReader{s: stmt, n: 100000} //约9MB
+	p := NewStreamingParser(r)
+	var n, maxBuf, maxTokens int
+	for {
+		_, err := p.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		n++
+		if c := cap(p.doc.tk.statement); c > maxBuf {
+			maxBuf = c
+		}
+		if c := cap(p.doc.tk.tokens); c > maxTokens {
+			maxTokens = c
+		}
+	}
+	if n != 200000 {
+		t.Fatalf("expected 200000 statements, got %d", n)
+	}
+	if maxBuf > 1<<20 || maxTokens > 1024 {
+		t.Fatalf("buffer not bounded: %d bytes, %d tokens", maxBuf, maxTokens)
+	}
+}
+
+//记录第一次写入时还没有读取的重复次数
+type firstWriter struct {
+	r         *repeatReader
+	remaining int
+	n         int
+}
+
+func (w *firstWriter) Write(p []byte) (int, error) {
+	if w.n == 0 {
+		w.remaining = w.r.n
+	}
+	w.n += len(p)
+	return len(p), nil
+}
+
+func TestStreamingParserPgSqlBounded(t *testing.T) {
+	r := &repeatReader{s: "declare @i int\nset @i = 1\nselect * from t1\n", n: 10000}
+	w := &firstWriter{r: r}
+	if err := NewStreamingParser(r).PgSql(w); err != nil {
+		t.Fatal(err)
+	}
+	if w.remaining == 0 || w.n == 0 {
+		t.Fatalf("output not written before the end of input: %d remaining, %d bytes", w.remaining, w.n)
+	}
+}
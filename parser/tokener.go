@@ -1,142 +1,681 @@
 package parser
 
 import (
+	"bytes"
 	"errors"
+	"io"
+	"sort"
+	"strings"
 )
 
+type TokenKind int
+
+const (
+	TokenEOF TokenKind = iota
+	TokenKeyword
+	TokenIdent
+	TokenQuotedIdent
+	TokenString
+	TokenNumber
+	TokenOperator
+	TokenVariable
+	TokenPunct
+	TokenComment
+	TokenGo //单独一行的GO, 和结尾一样终止语句, Text为空
+)
+
+var tokenKindNames = []string{
+	"EOF",
+	"keyword",
+	"identifier",
+	"quoted identifier",
+	"string",
+	"number",
+	"operator",
+	"variable",
+	"punctuation",
+	"comment",
+	"GO",
+}
+
+func (k TokenKind) String() string {
+	return tokenKindNames[k]
+}
+
+//Token 词法单元, Text为源语句中的原始文本
+type Token struct {
+	Kind     TokenKind
+	Text     string
+	Start    int     //起始字节偏移, 从0开始
+	End      int     //结束字节偏移
+	Line     int     //起始行号, 从1开始
+	Column   int     //起始列号, 从1开始
+	Leading  []Token //前面的注释
+	Trailing []Token //同一行后面的注释
+}
+
+//Tokener 一次性切分token并缓存, 前瞻时通过Mark/Reset回退.
+//从io.Reader读取时按需读入, release后丢弃已解析的部分
 type Tokener struct {
-	statement  []byte
-	pos        int
-	prevToken  string
-	curToken   string
-	flushToken bool
-	err        error
+	statement []byte    //从base开始的源语句
+	base      int       //statement[0]在源语句中的位置
+	src       io.Reader //为nil时statement就是全部的源语句
+	last      Token     //release时丢弃的最后一个token
+	pos       int       //词法分析到的位置
+	line      int       //pos所在行
+	lineStart int       //pos所在行的起始位置
+	tok       Token     //正在切分的token
+	tokens    []Token   //已切分的token
+	cur       int       //当前token在tokens中的下标
+	eof       bool      //tokens最后一个为结尾
+	err       error
+	shared    bool //statement被ParseError引用
+
+	quotedIdentifier bool //SET QUOTED_IDENTIFIER, 为true时"..."是标识符
 }
 
 var ErrInvalidStatement = errors.New("Invalid command")
+var ErrUnterminatedComment = errors.New("Unterminated comment")
 
 func NewTokener(statement []byte) *Tokener {
 	return &Tokener{
-		statement, 0, "", "", true, nil,
+		statement:        statement,
+		last:             Token{Line: 1, Column: 1},
+		line:             1,
+		quotedIdentifier: true,
+	}
+}
+
+//从r中按需读取源语句
+func NewReaderTokener(r io.Reader) *Tokener {
+	tk := NewTokener(nil)
+	tk.src = r
+	return tk
+}
+
+const readSize = 64 << 10
+
+//确保pos+n之前的字节已读入, 返回是否足够
+func (tk *Tokener) ensure(n int) bool {
+	for tk.pos+n > tk.base+len(tk.statement) {
+		if tk.src == nil {
+			return false
+		}
+		if len(tk.statement)+readSize > cap(tk.statement) {
+			buf := make([]byte, len(tk.statement), 2*cap(tk.statement)+readSize)
+			copy(buf, tk.statement)
+			tk.statement = buf
+		}
+		n, err := tk.src.Read(tk.statement[len(tk.statement) : len(tk.statement)+readSize])
+		tk.statement = tk.statement[:len(tk.statement)+n]
+		if err == io.EOF {
+			tk.src = nil
+		} else if err != nil {
+			tk.src = nil
+			tk.err = err
+		}
+	}
+	return true
+}
+
+//pos开始的最多n个字节
+func (tk *Tokener) peekBytes(n int) []byte {
+	tk.ensure(n)
+	end := tk.pos + n - tk.base
+	if end > len(tk.statement) {
+		end = len(tk.statement)
 	}
+	return tk.statement[tk.pos-tk.base : end]
+}
+
+//源语句中[start, end)之间的部分
+func (tk *Tokener) slice(start, end int) []byte {
+	return tk.statement[start-tk.base : end-tk.base]
+}
+
+//丢弃当前token之前的token和源语句, 之前的Mark失效
+func (tk *Tokener) release() {
+	if tk.cur == 0 {
+		return
+	}
+	tk.last = tk.tokens[tk.cur-1]
+	n := copy(tk.tokens, tk.tokens[tk.cur:])
+	tk.tokens = tk.tokens[:n]
+	tk.cur = 0
+
+	keep := tk.pos
+	if n > 0 {
+		keep = tk.tokens[0].Start
+	}
+	if tk.shared { //换一块缓存, 保留ParseError引用的源语句
+		buf := make([]byte, len(tk.statement)-(keep-tk.base), cap(tk.statement))
+		copy(buf, tk.statement[keep-tk.base:])
+		tk.statement = buf
+		tk.shared = false
+	} else {
+		n = copy(tk.statement, tk.statement[keep-tk.base:])
+		tk.statement = tk.statement[:n]
+	}
+	tk.base = keep
 }
 
 //查看下一个token, 不弹出
 func (tk *Tokener) Peek() (string, error) {
-	if tk.err != nil {
-		return "", tk.err
+	token, err := tk.PeekToken()
+	return token.Text, err
+}
+
+//弹出当前的token
+func (tk *Tokener) Pop() {
+	tk.PopToken()
+}
+
+//查看下一个token及其类型和位置, 不弹出
+func (tk *Tokener) PeekToken() (Token, error) {
+	if err := tk.fill(); err != nil {
+		return Token{}, err
 	}
+	return tk.tokens[tk.cur], nil
+}
+
+//弹出并返回当前的token
+func (tk *Tokener) PopToken() (Token, error) {
+	if err := tk.fill(); err != nil {
+		return Token{}, err
+	}
+	token := tk.tokens[tk.cur]
+	if tk.cur < len(tk.tokens)-1 || !tk.eof {
+		tk.cur++
+	}
+	return token, nil
+}
+
+//记录当前位置, 用于前瞻后回退
+func (tk *Tokener) Mark() int {
+	return tk.cur
+}
 
-	if tk.flushToken == true {
+//回退到Mark记录的位置
+func (tk *Tokener) Reset(mark int) {
+	tk.cur = mark
+}
+
+//确保当前token已切分
+func (tk *Tokener) fill() error {
+	for tk.cur >= len(tk.tokens) {
+		if tk.err != nil {
+			return tk.err
+		}
+		if tk.eof {
+			tk.cur = len(tk.tokens) - 1
+			break
+		}
 		token, err := tk.next()
 		if err != nil {
 			tk.err = err
-			return "", err
+			return err
+		}
+		if n := len(tk.tokens); n > 0 && isSeparator(tk.tokens[n-1]) { //分隔符上的注释移到下一个token上
+			prev := &tk.tokens[n-1]
+			token.Leading = append(append(prev.Leading, prev.Trailing...), token.Leading...)
+			prev.Leading, prev.Trailing = nil, nil
 		}
-		tk.prevToken = tk.curToken
-		tk.curToken = token
-		tk.flushToken = false
+		tk.tokens = append(tk.tokens, token)
+		tk.eof = token.Kind == TokenEOF
 	}
+	return nil
+}
 
-	return tk.curToken, nil
+//当前token的起始位置
+func (tk *Tokener) tokenPos() int {
+	return tk.curToken().Start
 }
 
-//弹出当前的token
-func (tk *Tokener) Pop() {
-	tk.flushToken = true
+//当前token, 词法出错时为出错处
+func (tk *Tokener) curToken() Token {
+	if tk.fill() != nil {
+		return tk.tok
+	}
+	return tk.tokens[tk.cur]
+}
+
+//起始位置在[start, end)之间的token
+func (tk *Tokener) tokensBetween(start, end int) []Token {
+	i := sort.Search(len(tk.tokens), func(i int) bool { return tk.tokens[i].Start >= start })
+	j := sort.Search(len(tk.tokens), func(i int) bool { return tk.tokens[i].Start >= end })
+	return tk.tokens[i:j]
+}
+
+//上一个弹出的token
+func (tk *Tokener) lastToken() Token {
+	if tk.cur == 0 {
+		return tk.last
+	}
+	return tk.tokens[tk.cur-1]
+}
+
+//上一个弹出的token的结束位置
+func (tk *Tokener) lastEnd() int {
+	return tk.lastToken().End
 }
 
 func (tk *Tokener) popByte() {
-	tk.pos++
-	if tk.pos > len(tk.statement) {
-		tk.pos = len(tk.statement)
+	if b, eof := tk.peekByte(); eof == false {
+		if b == '\n' {
+			tk.line++
+			tk.lineStart = tk.pos + 1
+		}
+		tk.pos++
 	}
 }
 
 func (tk *Tokener) peekByte() (byte, bool) {
-	if tk.pos == len(tk.statement) {
+	if !tk.ensure(1) {
 		return 0, true
 	}
-	return tk.statement[tk.pos], false
+	return tk.statement[tk.pos-tk.base], false
+}
+
+//切分下一个token, 并把注释挂到token的Leading和Trailing上
+func (tk *Tokener) next() (Token, error) {
+	var leading []Token
+	for {
+		token, err := tk.lex()
+		if err != nil {
+			return Token{}, err
+		}
+		if token.Kind != TokenComment {
+			token.Leading = leading
+			for token.Kind != TokenEOF && tk.isTrailingComment() {
+				comment, err := tk.lex()
+				if err != nil {
+					return Token{}, err
+				}
+				token.Trailing = append(token.Trailing, comment)
+			}
+			return token, nil
+		}
+		leading = append(leading, token)
+	}
 }
 
-func (tk *Tokener) next() (string, error) {
+func (tk *Tokener) lex() (Token, error) {
 	if tk.err != nil {
-		return "", tk.err
+		return Token{}, tk.err
+	}
+	kind, err := tk.nextMetaState()
+	if err != nil {
+		return Token{}, err
+	}
+	tk.tok.Kind = kind
+	tk.tok.Text = string(tk.slice(tk.tok.Start, tk.pos))
+	tk.tok.End = tk.pos
+	if kind == TokenGo {
+		tk.tok.Text = ""
+	}
+	if kind == TokenIdent && isKeyword(tk.tok.Text) {
+		tk.tok.Kind = TokenKeyword
+	}
+	return tk.tok, nil
+}
+
+//同一行的后面是否紧跟注释
+func (tk *Tokener) isTrailingComment() bool {
+	for n := 1; tk.ensure(n); n++ {
+		b := tk.statement[tk.pos-tk.base+n-1]
+		if b == ' ' || b == '\t' {
+			continue
+		}
+		tk.ensure(n + 1)
+		return isCommentStart(tk.statement[tk.pos-tk.base+n-1:])
 	}
-	return tk.nextMetaState()
+	return false
 }
 
-func (tk *Tokener) nextMetaState() (string, error) { //词法分析 得到单词
+func (tk *Tokener) nextMetaState() (TokenKind, error) { //词法分析 得到单词
 	for { //skip blank
 		b, eof := tk.peekByte()
-		if eof == true {
-			return "", nil
-		}
-		if isBlank(b) == false { //\n \t ' '
+		if eof == true || isBlank(b) == false { //\n \t ' '
 			break
 		}
 		tk.popByte() //pos ++
 	}
+	tk.tok = Token{Start: tk.pos, Line: tk.line, Column: tk.pos - tk.lineStart + 1}
 	//get char
-	b, _ := tk.peekByte()
-	if isSymbol(b) {
+	b, eof := tk.peekByte()
+	if eof == true {
+		return TokenEOF, nil
+	} else if isCommentStart(tk.peekBytes(2)) {
+		return tk.nextCommentState()
+	} else if isNumberStart(tk.peekBytes(3)) {
+		return tk.nextNumberState()
+	} else if isPunct(b) {
 		tk.popByte() //pos ++
-		return string(b), nil
+		return TokenPunct, nil
+	} else if isSymbol(b) {
+		return tk.nextOperatorState()
 	} else if b == '"' || b == '\'' {
-		return tk.nextQuoteState() //得到“”字符串中的数据，如“123”得到123
+		return tk.nextQuoteState() //得到引号包围的字符串, 保留引号
+	} else if b == '[' {
+		return tk.nextBracketState() //[dbo].[Order Details]
+	} else if n := tk.goLen(); n > 0 {
+		for ; n > 0; n-- {
+			tk.popByte()
+		}
+		return TokenGo, nil
+	} else if rest := tk.peekBytes(2); (b == 'N' || b == 'n') && len(rest) > 1 && rest[1] == '\'' {
+		tk.popByte()
+		return tk.nextQuoteState() //N'...' unicode字符串
 	} else {
 		return tk.nextTokenState() //得到单词也即标识符名
 	}
 }
 
-func (tk *Tokener) nextTokenState() (string, error) { //得到单词
-	var tmp []byte
+//-- 到行尾, 或者/* */, 块注释可以嵌套
+func (tk *Tokener) nextCommentState() (TokenKind, error) {
+	if b, _ := tk.peekByte(); b == '-' {
+		for {
+			b, eof := tk.peekByte()
+			if eof == true || b == '\n' || b == '\r' {
+				return TokenComment, nil
+			}
+			tk.popByte()
+		}
+	}
+
+	depth := 0
+	for {
+		rest := tk.peekBytes(2)
+		if len(rest) == 0 {
+			tk.err = ErrUnterminatedComment
+			return TokenEOF, tk.err
+		}
+		if len(rest) > 1 && rest[0] == '/' && rest[1] == '*' {
+			depth++
+			tk.popByte()
+		} else if len(rest) > 1 && rest[0] == '*' && rest[1] == '/' {
+			depth--
+			tk.popByte()
+			if depth == 0 {
+				tk.popByte()
+				return TokenComment, nil
+			}
+		}
+		tk.popByte()
+	}
+}
+
+//pos处是否为单独一行的GO [count], 返回GO [count]的长度
+func (tk *Tokener) goLen() int {
+	for i := tk.lineStart; i < tk.pos; i++ { //前面只能是空白
+		if i >= tk.base && !isBlank(tk.statement[i-tk.base]) {
+			return 0
+		}
+	}
+	s := tk.peekBytes(3)
+	if len(s) < 2 || !strings.EqualFold(string(s[:2]), "go") {
+		return 0
+	}
+	n, end := 2, 2
+	skip := func() {
+		for s = tk.peekBytes(n + 1); len(s) > n && (s[n] == ' ' || s[n] == '\t'); s = tk.peekBytes(n + 1) {
+			n++
+		}
+	}
+	skip()
+	if n > end { //GO count
+		for ; len(s) > n && isDigit(s[n]); s = tk.peekBytes(n + 1) {
+			n++
+			end = n
+		}
+		skip()
+	}
+	s = tk.peekBytes(n + 2)
+	if len(s) == n || s[n] == '\n' || s[n] == '\r' || isCommentStart(s[n:]) {
+		return end
+	}
+	return 0
+}
+
+func (tk *Tokener) nextTokenState() (TokenKind, error) { //得到单词
+	first, _ := tk.peekByte()
+	for {
+		b, eof := tk.peekByte()
+		if eof == true || isBlank(b) || isSymbol(b) || b == '[' || isCommentStart(tk.peekBytes(2)) { //终止条件
+			break
+		}
+		tk.popByte()
+	}
+	if first == '@' {
+		return TokenVariable, nil
+	}
+	return TokenIdent, nil
+}
+
+//123, 1.5, .5, 1.5e3, 1E-3, 0x1F, $10.00
+func (tk *Tokener) nextNumberState() (TokenKind, error) {
+	b, _ := tk.peekByte()
+	if b == '$' {
+		tk.popByte()
+	}
+	if rest := tk.peekBytes(2); b == '0' && len(rest) > 1 && (rest[1] == 'x' || rest[1] == 'X') {
+		tk.popByte()
+		tk.popByte()
+		for {
+			b, eof := tk.peekByte()
+			if eof == true || !isHexDigit(b) {
+				return TokenNumber, nil
+			}
+			tk.popByte()
+		}
+	}
+
+	tk.popDigits()
+	if b, _ := tk.peekByte(); b == '.' {
+		tk.popByte()
+		tk.popDigits()
+	}
+	if b, _ := tk.peekByte(); b == 'e' || b == 'E' {
+		exp := tk.peekBytes(3)[1:]
+		sign := len(exp) > 0 && (exp[0] == '+' || exp[0] == '-')
+		if sign {
+			exp = exp[1:]
+		}
+		if len(exp) > 0 && isDigit(exp[0]) {
+			tk.popByte()
+			if sign {
+				tk.popByte()
+			}
+			tk.popDigits()
+		}
+	}
+	return TokenNumber, nil
+}
+
+func (tk *Tokener) popDigits() {
 	for {
 		b, eof := tk.peekByte()
-		if eof == true || isBlank(b) || isSymbol(b) { //终止条件
-			return string(tmp), nil
+		if eof == true || !isDigit(b) {
+			return
 		}
-		tmp = append(tmp, b) //不停的拼接字符成单词
 		tk.popByte()
 	}
 }
 
-func (tk *Tokener) nextQuoteState() (string, error) {
+//优先匹配两个字符的运算符
+func (tk *Tokener) nextOperatorState() (TokenKind, error) {
+	rest := tk.peekBytes(2)
+	for _, op := range operators {
+		if len(rest) >= len(op) && string(rest[:len(op)]) == op {
+			for range op {
+				tk.popByte()
+			}
+			return TokenOperator, nil
+		}
+	}
+	tk.popByte()
+	return TokenOperator, nil
+}
+
+//引号内两个连续的引号表示一个引号, 如'O''Brien'
+func (tk *Tokener) nextQuoteState() (TokenKind, error) {
 	quote, _ := tk.peekByte() //引号
 	tk.popByte()
 
-	var tmp []byte
 	for {
 		b, eof := tk.peekByte()
 		if eof == true {
 			tk.err = ErrInvalidStatement
-			return "", tk.err
+			return TokenEOF, tk.err
 		}
+		tk.popByte()
 		if b == quote { //找到匹配的引号 即“”成对，停止找
+			if b, _ := tk.peekByte(); b != quote {
+				break
+			}
 			tk.popByte()
-			break
 		}
-		tmp = append(tmp, b)
+	}
+
+	if quote == '"' && tk.quotedIdentifier {
+		return TokenQuotedIdent, nil
+	}
+	return TokenString, nil
+}
+
+//方括号内两个连续的]表示一个], 如[a]]b]
+func (tk *Tokener) nextBracketState() (TokenKind, error) {
+	tk.popByte()
+
+	for {
+		b, eof := tk.peekByte()
+		if eof == true {
+			tk.err = ErrInvalidStatement
+			return TokenEOF, tk.err
+		}
 		tk.popByte()
+		if b == ']' {
+			if b, _ := tk.peekByte(); b != ']' {
+				break
+			}
+			tk.popByte()
+		}
 	}
+	return TokenQuotedIdent, nil
+}
 
-	return string(tmp), nil
+//SET QUOTED_IDENTIFIER改变了"的含义, 丢弃已前瞻切分的token, 从当前位置重新切分
+func (tk *Tokener) SetQuotedIdentifier(on bool) {
+	tk.quotedIdentifier = on
+	if tk.cur >= len(tk.tokens) {
+		return
+	}
+	prev := tk.lastToken()
+	tk.pos = prev.End
+	if n := len(prev.Trailing); n > 0 {
+		tk.pos = prev.Trailing[n-1].End
+	}
+	tk.line = prev.Line
+	tk.lineStart = prev.Start - prev.Column + 1
+	if i := bytes.LastIndexByte(tk.slice(prev.Start, tk.pos), '\n'); i >= 0 {
+		tk.line += bytes.Count(tk.slice(prev.Start, tk.pos), []byte("\n"))
+		tk.lineStart = prev.Start + i + 1
+	}
+	tk.tokens = tk.tokens[:tk.cur]
+	tk.eof = false
+	tk.err = nil
 }
 
+//在当前token前插入"<< "标记出错位置
 func (tk *Tokener) ErrStat() []byte {
-	tmp := make([]byte, len(tk.statement)+3)
-	copy(tmp, tk.statement[:tk.pos])
-	copy(tmp[tk.pos:], []byte("<< "))
-	copy(tmp[tk.pos+3:], tk.statement[tk.pos:])
+	return markError(tk.statement, tk.tokenPos()-tk.base)
+}
+
+//在statement的pos处插入"<< "
+func markError(statement []byte, pos int) []byte {
+	if pos < 0 { //已经release
+		pos = 0
+	}
+	tmp := make([]byte, len(statement)+3)
+	copy(tmp, statement[:pos])
+	copy(tmp[pos:], []byte("<< "))
+	copy(tmp[pos+3:], statement[pos:])
 	return tmp
 }
 
+var operators = []string{
+	"<>", "!=", "!<", "!>", ">=", "<=",
+	"+=", "-=", "*=", "/=", "%=", "&=", "|=", "^=",
+	"=", "<", ">", "!", "+", "-", "*", "/", "%", "&", "|", "^", "~",
+}
+
 func isSymbol(b byte) bool {
-	return b == '>' || b == '<' || b == '=' || b == '*' ||
-		b == ',' || b == '(' || b == ')' || b == '.'
+	return strings.IndexByte("=<>!+-*/%&|^~", b) >= 0 || isPunct(b)
+}
+
+func isPunct(b byte) bool {
+	return b == ',' || b == '(' || b == ')' || b == '.' || b == ';'
+}
+
+//, ( .后面总是跟着别的token
+func isSeparator(token Token) bool {
+	return token.Kind == TokenPunct && (token.Text == "," || token.Text == "(" || token.Text == ".")
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+func isHexDigit(b byte) bool {
+	return isDigit(b) || b >= 'a' && b <= 'f' || b >= 'A' && b <= 'F'
+}
+
+//数字, .5, 或者$开头的money
+func isNumberStart(s []byte) bool {
+	if len(s) > 0 && s[0] == '$' {
+		s = s[1:]
+	}
+	if len(s) > 1 && s[0] == '.' {
+		s = s[1:]
+	}
+	return len(s) > 0 && isDigit(s[0])
+}
+
+func isCommentStart(s []byte) bool {
+	return len(s) > 1 && (s[0] == '-' && s[1] == '-' || s[0] == '/' && s[1] == '*')
 }
 
 func isBlank(b byte) bool {
-	return b == '\n' || b == ' ' || b == '\t'
+	return b == '\n' || b == ' ' || b == '\t' || b == '\r'
+}
+
+//T-SQL保留字
+var reservedWords = map[string]bool{}
+
+func init() {
+	for _, word := range strings.Fields(`
+add all alter and any as asc authorization backup begin between break browse bulk by
+cascade case check checkpoint close clustered coalesce collate column commit compute
+constraint contains containstable continue convert create cross current current_date
+current_time current_timestamp current_user cursor database dbcc deallocate declare
+default delete deny desc disk distinct distributed double drop dump else end errlvl
+escape except exec execute exists exit external fetch file fillfactor for foreign
+freetext freetexttable from full function goto grant group having holdlock identity
+identity_insert identitycol if in index inner insert intersect into is join key kill
+left like lineno load merge national nocheck nonclustered not null nullif of off
+offsets on open opendatasource openquery openrowset openxml option or order outer
+over percent pivot plan precision primary print proc procedure public raiserror read
+readtext reconfigure references replication restore restrict return revert revoke
+right rollback rowcount rowguidcol rule save schema securityaudit select
+semantickeyphrasetable semanticsimilaritydetailstable semanticsimilaritytable
+session_user set setuser shutdown some statistics system_user table tablesample
+textsize then to top tran transaction trigger truncate try_convert tsequal union
+unique unpivot update updatetext use user values varying view waitfor when where
+while with within writetext`) {
+		reservedWords[word] = true
+	}
+}
+
+func isKeyword(word string) bool {
+	return reservedWords[strings.ToLower(word)]
 }
@@ -0,0 +1,236 @@
+package parser
+
+import (
+	"testing"
+)
+
+func tokenize(t *testing.T, s string) []Token {
+	tk := NewTokener([]byte(s))
+	var tokens []Token
+	for {
+		token, err := tk.PopToken()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token.Kind == TokenEOF {
+			return tokens
+		}
+		tokens = append(tokens, token)
+	}
+}
+
+func TestTokenKind(t *testing.T) {
+	tokens := tokenize(t, "select @i, name, 'begin', \"col\", 12 from t1 where a>=1")
+	expected := []struct {
+		kind TokenKind
+		text string
+	}{
+		{TokenKeyword, "select"},
+		{TokenVariable, "@i"},
+		{TokenPunct, ","},
+		{TokenIdent, "name"},
+		{TokenPunct, ","},
+		{TokenString, "'begin'"},
+		{TokenPunct, ","},
+		{TokenQuotedIdent, "\"col\""},
+		{TokenPunct, ","},
+		{TokenNumber, "12"},
+		{TokenKeyword, "from"},
+		{TokenIdent, "t1"},
+		{TokenKeyword, "where"},
+		{TokenIdent, "a"},
+		{TokenOperator, ">="},
+		{TokenNumber, "1"},
+	}
+	if len(tokens) != len(expected) {
+		t.Fatalf("expected %d tokens, got %v", len(expected), tokens)
+	}
+	for i, v := range expected {
+		if tokens[i].Kind != v.kind || tokens[i].Text != v.text {
+			t.Errorf("token %d: expected %s %q, got %s %q", i, v.kind, v.text, tokens[i].Kind, tokens[i].Text)
+		}
+	}
+}
+
+func TestTokenPosition(t *testing.T) {
+	s := "select *\n  from t1\r\nwhere"
+	tokens := tokenize(t, s)
+	expected := []struct {
+		start, end, line, column int
+	}{
+		{0, 6, 1, 1},
+		{7, 8, 1, 8},
+		{11, 15, 2, 3},
+		{16, 18, 2, 8},
+		{20, 25, 3, 1},
+	}
+	for i, v := range expected {
+		token := tokens[i]
+		if token.Start != v.start || token.End != v.end || token.Line != v.line || token.Column != v.column {
+			t.Errorf("token %q: expected %v, got %d %d %d %d", token.Text, v, token.Start, token.End, token.Line, token.Column)
+		}
+		if s[token.Start:token.End] != token.Text {
+			t.Errorf("token %q does not match source %q", token.Text, s[token.Start:token.End])
+		}
+	}
+}
+
+func TestTokenMarkReset(t *testing.T) {
+	tk := NewTokener([]byte("insert into t1 values(1)"))
+	mark := tk.Mark()
+	tk.Pop()
+	tk.Pop()
+	if token, _ := tk.Peek(); token != "t1" {
+		t.Fatalf("expected t1, got %q", token)
+	}
+	tk.Reset(mark)
+	if token, _ := tk.Peek(); token != "insert" {
+		t.Fatalf("expected insert, got %q", token)
+	}
+}
+
+func TestTokenComments(t *testing.T) {
+	tokens := tokenize(t, "-- a\n/* b /* c */ */ select -- d\n* from--e\nt1")
+	if len(tokens) != 4 {
+		t.Fatalf("expected 4 tokens, got %v", tokens)
+	}
+	if len(tokens[0].Leading) != 2 || tokens[0].Leading[0].Text != "-- a" || tokens[0].Leading[1].Text != "/* b /* c */ */" {
+		t.Errorf("wrong leading comments: %v", tokens[0].Leading)
+	}
+	if len(tokens[0].Trailing) != 1 || tokens[0].Trailing[0].Text != "-- d" {
+		t.Errorf("wrong trailing comments: %v", tokens[0].Trailing)
+	}
+	if tokens[2].Text != "from" || len(tokens[2].Trailing) != 1 || tokens[2].Trailing[0].Text != "--e" {
+		t.Errorf("wrong trailing comments: %v", tokens[2])
+	}
+}
+
+func TestTokenString(t *testing.T) {
+	tokens := tokenize(t, `'O''Brien' N'中文' n'' "a""b" ''''`)
+	expected := []struct {
+		kind TokenKind
+		text string
+	}{
+		{TokenString, `'O''Brien'`},
+		{TokenString, `N'中文'`},
+		{TokenString, `n''`},
+		{TokenQuotedIdent, `"a""b"`},
+		{TokenString, `''''`},
+	}
+	if len(tokens) != len(expected) {
+		t.Fatalf("expected %d tokens, got %v", len(expected), tokens)
+	}
+	for i, v := range expected {
+		if tokens[i].Kind != v.kind || tokens[i].Text != v.text {
+			t.Errorf("token %d: expected %s %q, got %s %q", i, v.kind, v.text, tokens[i].Kind, tokens[i].Text)
+		}
+	}
+}
+
+func TestQuotedIdentifierOff(t *testing.T) {
+	tk := NewTokener([]byte(`"a" "b"`))
+	if token, _ := tk.PeekToken(); token.Kind != TokenQuotedIdent {
+		t.Fatalf("expected quoted identifier, got %s", token.Kind)
+	}
+	tk.Pop()
+	tk.Peek()
+	tk.Reset(0)
+	tk.Pop()
+	tk.SetQuotedIdentifier(false)
+	if token, _ := tk.PeekToken(); token.Kind != TokenString || token.Text != `"b"` {
+		t.Fatalf("expected string \"b\", got %s %q", token.Kind, token.Text)
+	}
+}
+
+func TestTokenBracket(t *testing.T) {
+	tokens := tokenize(t, "[dbo].[Order Details] [a]]b]x")
+	expected := []string{"[dbo]", ".", "[Order Details]", "[a]]b]", "x"}
+	if len(tokens) != len(expected) {
+		t.Fatalf("expected %d tokens, got %v", len(expected), tokens)
+	}
+	for i, v := range expected {
+		if tokens[i].Text != v {
+			t.Errorf("token %d: expected %q, got %q", i, v, tokens[i].Text)
+		}
+	}
+	if tokens[2].Kind != TokenQuotedIdent {
+		t.Errorf("expected quoted identifier, got %s", tokens[2].Kind)
+	}
+}
+
+func TestTokenOperatorNumber(t *testing.T) {
+	tokens := tokenize(t, "a<=b<>c!=d!<1.5e3+-.5*$10.00/0x1F%t.b;@i+=1E-3&x|y^~z")
+	expected := []struct {
+		kind TokenKind
+		text string
+	}{
+		{TokenIdent, "a"},
+		{TokenOperator, "<="},
+		{TokenIdent, "b"},
+		{TokenOperator, "<>"},
+		{TokenIdent, "c"},
+		{TokenOperator, "!="},
+		{TokenIdent, "d"},
+		{TokenOperator, "!<"},
+		{TokenNumber, "1.5e3"},
+		{TokenOperator, "+"},
+		{TokenOperator, "-"},
+		{TokenNumber, ".5"},
+		{TokenOperator, "*"},
+		{TokenNumber, "$10.00"},
+		{TokenOperator, "/"},
+		{TokenNumber, "0x1F"},
+		{TokenOperator, "%"},
+		{TokenIdent, "t"},
+		{TokenPunct, "."},
+		{TokenIdent, "b"},
+		{TokenPunct, ";"},
+		{TokenVariable, "@i"},
+		{TokenOperator, "+="},
+		{TokenNumber, "1E-3"},
+		{TokenOperator, "&"},
+		{TokenIdent, "x"},
+		{TokenOperator, "|"},
+		{TokenIdent, "y"},
+		{TokenOperator, "^"},
+		{TokenOperator, "~"},
+		{TokenIdent, "z"},
+	}
+	if len(tokens) != len(expected) {
+		t.Fatalf("expected %d tokens, got %v", len(expected), tokens)
+	}
+	for i, v := range expected {
+		if tokens[i].Kind != v.kind || tokens[i].Text != v.text {
+			t.Errorf("token %d: expected %s %q, got %s %q", i, v.kind, v.text, tokens[i].Kind, tokens[i].Text)
+		}
+	}
+}
+
+func TestTokenGo(t *testing.T) {
+	cases := map[string]bool{
+		"go":               true,
+		"  GO 5  \nselect": true,
+		"go -- comment":    true,
+		"go\r\n":           true,
+		"select 1 go":      false,
+		"go 5 6":           false,
+		"go5":              false,
+		"gone":             false,
+		"go.t1":            false,
+	}
+	for s, expected := range cases {
+		tokens := tokenize(t, s)
+		var found bool
+		for _, v := range tokens {
+			if v.Kind == TokenGo {
+				found = true
+				if v.Text != "" {
+					t.Errorf("%q: GO token text should be empty, got %q", s, v.Text)
+				}
+			}
+		}
+		if found != expected {
+			t.Errorf("%q: expected GO %v, got %v", s, expected, found)
+		}
+	}
+}
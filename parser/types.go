@@ -0,0 +1,60 @@
+package parser
+
+import (
+	"strings"
+)
+
+//mssql类型 => pgsql类型, 可以被RuleSet.Types覆盖
+var pgTypes = map[string]string{
+	"nvarchar(max)":    "text",
+	"varchar(max)":     "text",
+	"varbinary(max)":   "bytea",
+	"nvarchar":         "varchar",
+	"nchar":            "char",
+	"ntext":            "text",
+	"sysname":          "varchar(128)",
+	"sql_variant":      "text",
+	"hierarchyid":      "varchar",
+	"datetime":         "timestamp",
+	"datetime2":        "timestamp",
+	"smalldatetime":    "timestamp(0)",
+	"datetimeoffset":   "timestamptz",
+	"bit":              "boolean",
+	"tinyint":          "smallint",
+	"float":            "double precision",
+	"money":            "numeric(19,4)",
+	"smallmoney":       "numeric(10,4)",
+	"uniqueidentifier": "uuid",
+	"image":            "bytea",
+	"binary":           "bytea",
+	"varbinary":        "bytea",
+	"rowversion":       "bytea",
+	"timestamp":        "bytea", //mssql的timestamp是rowversion
+}
+
+//没有长度的pgsql类型, 翻译时去掉原来的长度
+var unsizedTypes = map[string]bool{
+	"text": true, "bytea": true, "boolean": true, "smallint": true, "uuid": true, "double precision": true,
+}
+
+//mssql类型 => pgsql类型, 先查用户的规则再查pgTypes.
+//先按完整的类型查找, 再按去掉长度的类型查找, 目标不带长度时保留原来的长度
+func pgType(typ string, opts *options) string {
+	base, size := typ, ""
+	if i := strings.IndexByte(typ, '('); i >= 0 {
+		base, size = strings.TrimSpace(typ[:i]), typ[i:]
+	}
+	base = identValue(base) //[nvarchar](50)
+	for _, types := range []map[string]string{opts.ruleSet().Types, pgTypes} {
+		if target, ok := types[strings.ToLower(base+size)]; ok {
+			return target
+		}
+		if target, ok := types[strings.ToLower(base)]; ok {
+			if size == "" || strings.Contains(target, "(") || unsizedTypes[target] {
+				return target
+			}
+			return target + size
+		}
+	}
+	return base + size
+}
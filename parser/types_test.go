@@ -0,0 +1,46 @@
+package parser
+
+import (
+	"testing"
+)
+
+func TestPgType(t *testing.T) {
+	cases := map[string]string{
+		"NVARCHAR(MAX)":    "text",
+		"nvarchar(50)":     "varchar(50)",
+		"[nvarchar](50)":   "varchar(50)",
+		"nchar(2)":         "char(2)",
+		"DATETIME":         "timestamp",
+		"datetime2(3)":     "timestamp(3)",
+		"datetimeoffset":   "timestamptz",
+		"bit":              "boolean",
+		"uniqueidentifier": "uuid",
+		"money":            "numeric(19,4)",
+		"image":            "bytea",
+		"varbinary(100)":   "bytea",
+		"varbinary(max)":   "bytea",
+		"tinyint":          "smallint",
+		"float":            "double precision",
+		"int":              "int",
+		"decimal(18, 2)":   "decimal(18, 2)",
+	}
+	for typ, expected := range cases {
+		if got := pgType(typ, nil); got != expected {
+			t.Errorf("%s: expected %s, got %s", typ, expected, got)
+		}
+	}
+
+	r := NewRuleSet()
+	r.AddType("datetime", "timestamptz")
+	r.AddType("nvarchar(max)", "varchar")
+	opts := newOptions(r, CaseFold, false)
+	if got := pgType("datetime", opts); got != "timestamptz" {
+		t.Errorf("override not applied: %s", got)
+	}
+	if got := pgType("nvarchar(max)", opts); got != "varchar" {
+		t.Errorf("override not applied: %s", got)
+	}
+	if got := pgType("nvarchar(10)", opts); got != "varchar(10)" {
+		t.Errorf("built-in mapping lost: %s", got)
+	}
+}